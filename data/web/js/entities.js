@@ -70,6 +70,74 @@ var entities = new function() {
         }
     };
 
+    /////////////////////////////////////////////////////////////////////////////
+    // semantics guessed for unknown words, for a human to accept or reject
+
+    this.suggestion_list = [];
+
+    function suggestion_list_to_html() {
+        var t_head = "<thead><tr><th>NAME</th><th>SUGGESTED SEMANTIC</th><th>CONFIDENCE</th><th>BECAUSE OF</th><th></th></tr></thead>";
+        var t_body = "<tbody>";
+        $.each(self.suggestion_list, function(i, suggestion) {
+            var e_id = utility.escapeHtml(suggestion.word);
+            var e_sem = utility.escapeHtml(suggestion.semantic);
+            t_body += "<tr>";
+            t_body += "<td>" + e_id + "</td>";
+            t_body += "<td>" + e_sem + "</td>";
+            t_body += "<td>" + Math.round(suggestion.confidence * 100) + "%</td>";
+            t_body += "<td>" + utility.escapeHtml(suggestion.neighbour_list.join(", ")) + "</td>";
+            t_body += "<td><div style='float: right;'>";
+            t_body += "<a href='#' onclick=\"entities.accept_suggestion('" + e_id + "');\"><span class='glyphicon glyphicon-ok' title='accept'></span></a>&nbsp;&nbsp;";
+            t_body += "<a href='#' onclick=\"entities.reject_suggestion('" + e_id + "');\"><span class='glyphicon glyphicon-remove' title='reject'></span></a>";
+            t_body += "</div></td>";
+            t_body += "</tr>";
+        });
+        t_body += "</tbody>";
+        $("#entityTable").html(t_head + t_body);
+    }
+
+    // show the suggestions
+    this.suggestions = function() {
+        $.get("/entities/suggestions/" + encodeURIComponent(session),
+            function (data) {
+                if (typeof data === 'string' || data instanceof String) {
+                    self.process_result(data);
+                } else if (data && data.length >= 0) {
+                    self.suggestion_list = data;
+                    suggestion_list_to_html();
+                }
+            });
+    };
+
+    // accept a suggestion: save it as an entity
+    this.accept_suggestion = function(word) {
+        var suggestion = utility.getObjectFromList(self.suggestion_list, "word", word);
+        if (suggestion) {
+            $.get("/entities/save/" + encodeURIComponent(session) + "/" + encodeURIComponent(suggestion.word) + "/" + encodeURIComponent(suggestion.semantic),
+                function (data) {
+                    self.suggestions();
+                });
+        }
+    };
+
+    // reject a suggestion
+    this.reject_suggestion = function(word) {
+        $.ajax({
+            url: "/entities/suggestions/" + encodeURIComponent(session) + "/" + encodeURIComponent(word),
+            type: 'DELETE',
+            success: function(data) {
+                self.suggestions();
+            },
+            error: function (jqXHR, textStatus, errorThrown) {
+                if (jqXHR && jqXHR.responseText) {
+                    utility.showErrorMessage(jqXHR.responseText);
+                } else {
+                    utility.showErrorMessage(textStatus);
+                }
+            }
+        });
+    };
+
     // onkeypress from UI
     this.find_keypress = function(event) {
         if (event && event.keyCode == 13) {
@@ -42,7 +42,11 @@ var query = new function() {
             $.each(list, function (i, _item) {
                 var item = list[list.length - (i+1)];
                 if (item && item.text) {
-                    table_str += "<tr><td>" + utility.escapeHtml(item.text) + "</td><td>" +
+                    var text_str = utility.escapeHtml(item.text);
+                    if (item.answer && item.answer.length > 0) { // short answer with its supporting evidence
+                        text_str = "<b>" + utility.escapeHtml(item.answer) + "</b><br/><small>" + text_str + "</small>";
+                    }
+                    table_str += "<tr><td>" + text_str + "</td><td>" +
                         utility.escapeHtml(item.topic) + "</td><td>" +
                         utility.escapeHtml(item.timestamp) + "</td>";
                     if (item.text.trim().length > 0 && item.text.indexOf('ok, got that and stored') == -1) {
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"path/filepath"
+	"k-ai/db"
+	"k-ai/util"
+	"k-ai/nlu/aiml"
+	"k-ai/environment"
+	"k-ai/db/db_model"
+)
+
+//
+// check the AIML files for mistakes and for patterns that compete across modules
+// (see nlu/aiml/aiml_lint.go), exits with 1 if there are errors
+// with -db the categories of the db and the patterns of the kb schemas are checked instead
+// (the Cassandra of data/properties.ini)
+//
+func main() {
+	dir := flag.String("dir", "", "the directory of the .aiml files (default: data/aiml)")
+	use_db := flag.Bool("db", false, "check the categories and kb schema patterns of the db instead of the files")
+	quiet := flag.Bool("q", false, "only report errors, not warnings")
+	flag.Parse()
+
+	if *use_db {
+		issue_list, summary, err := lintDb()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		report(issue_list, summary, *quiet)
+		return
+	}
+
+	if len(*dir) == 0 {
+		*dir = util.GetDataPath() + "/aiml"
+	}
+	file_list, err := filepath.Glob(filepath.Join(*dir, "*.aiml"))
+	if err != nil || len(file_list) == 0 {
+		fmt.Printf("no .aiml files in %s\n", *dir)
+		os.Exit(1)
+	}
+
+	report(aiml.LintFiles(file_list), fmt.Sprintf("%d files", len(file_list)), *quiet)
+}
+
+// lint the categories and kb schemas of the db, and a summary of what was linted
+func lintDb() ([]aiml.LintIssue, string, error) {
+	env := environment.ReadConfig()
+	err := db.Cassandra.InitCassandraConnection(env.CassandraServer, env.Keyspace, env.ReplicationFactor)
+	if err != nil { return nil, "", err }
+	category_list, err := db_model.GetAimlCategoryList("")
+	if err != nil { return nil, "", err }
+	schema_list, err := db_model.GetSchemaList()
+	if err != nil { return nil, "", err }
+	return aiml.LintDb(category_list, schema_list), fmt.Sprintf("%d categories and %d schemas", len(category_list),
+		len(schema_list)), nil
+}
+
+// print the issues found, exits with 1 if there are errors
+func report(issue_list []aiml.LintIssue, summary string, quiet bool) {
+	num_errors := 0
+	num_warnings := 0
+	for _, issue := range issue_list {
+		if issue.Severity == aiml.LintError {
+			num_errors += 1
+		} else {
+			num_warnings += 1
+			if quiet {
+				continue
+			}
+		}
+		fmt.Println(issue.String())
+	}
+	fmt.Printf("%s: %d errors, %d warnings\n", summary, num_errors, num_warnings)
+	if num_errors > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"k-ai/util"
+	"k-ai/environment"
+	"k-ai/nlu/model"
+	"k-ai/nlu/parser"
+	"k-ai/nlu/anaphora"
+)
+
+//
+// evaluate anaphora resolution against an annotated corpus
+//
+// by default the recorded parses of the corpus are used, -live uses the Spacy parser
+// from properties.ini instead, and -record (with -live) stores the new parses in the corpus.
+// gold links refer to pronouns by their token index in the (recorded) parse.
+//
+func main() {
+	corpus_file := flag.String("corpus", util.GetDataPath() + "/anaphora/corpus.json", "the annotated corpus")
+	live := flag.Bool("live", false, "parse the corpus using the Spacy parser instead of the recorded parses")
+	record := flag.Bool("record", false, "save the live parses in the corpus (requires -live)")
+	min_precision := flag.Float64("min-precision", 0.0, "fail if the overall precision is below this")
+	min_recall := flag.Float64("min-recall", 0.0, "fail if the overall recall is below this")
+	flag.Parse()
+
+	corpus, err := anaphora.LoadCorpus(*corpus_file)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	parse := anaphora.RecordedParse
+	if *live {
+		parser.SpacyEndpoint = environment.ReadConfig().SpacyEndpoint
+		parse = func(entry anaphora.CorpusEntry) (model.SentenceList, error) {
+			return parser.ParseText(entry.Text)
+		}
+		if *record {
+			for i, entry := range corpus {
+				corpus[i].Parse, err = parse(entry)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+			}
+			err = anaphora.SaveCorpus(*corpus_file, corpus)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+	}
+
+	result, err := anaphora.LL.Evaluate(corpus, parse)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	fmt.Print(result.String())
+
+	err = result.CheckThreshold(*min_precision, *min_recall)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
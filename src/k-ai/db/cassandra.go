@@ -270,6 +270,54 @@ func (c *CCassandra) Delete(cf string, whereSet map[string]interface{}) string {
 	return str
 }
 
+/**
+ * setup a lightweight transaction, a statement that only applies if its condition holds
+ * @param str an insert, update or delete statement
+ * @param condition the condition, e.g. IF NOT EXISTS
+ * @return the conditional statement
+ */
+func (c *CCassandra) Conditional(str string, condition string) string {
+	return strings.TrimSuffix(str, ";") + " " + condition + ";"
+}
+
+/**
+ * execute a lightweight transaction (see Conditional), it isn't retried: a retry of one that applied wouldn't apply
+ * @return true if it applied
+ */
+func (c *CCassandra) ExecuteConditional(str string) (bool, error) {
+	return c.Session.Query(str).MapScanCAS(make(map[string]interface{}))
+}
+
+/**
+ * setup an update of a counter column
+ * @param cf the column family of the counter
+ * @param column the counter column
+ * @param delta what to add to the counter, can be negative
+ * @return the update statement
+ */
+func (c *CCassandra) Increment(cf string, column string, delta int64, whereSet map[string]interface{}) string {
+	str := "UPDATE " + c.keyspace + "." + cf + " SET " + column + "=" + column
+	if delta < 0 {
+		str += "-" + strconv.FormatInt(-delta, 10)
+	} else {
+		str += "+" + strconv.FormatInt(delta, 10)
+	}
+	counter := 0
+	for name, value := range whereSet {
+		if counter == 0 {
+			str += " WHERE "
+		}
+		if counter > 0 {
+			str += " AND "
+		}
+		str += name + "="
+		str += typeToString(value)
+		counter += 1
+	}
+	str += ";"
+	return str
+}
+
 /**
  * setup a simple select for a column family
  * @param cf the column family to select from
@@ -95,3 +95,29 @@ func TestCqlGeneration3(t *testing.T) {
 	util_ut.IsTrue(t, strings.Contains(resultStr, "VALUES (4,'Peter');") || strings.Contains(resultStr, "VALUES ('Peter',4);"))
 }
 
+
+// test counter update
+func TestCqlGeneration4(t *testing.T) {
+
+	cassandra := CCassandra{ keyspace: "test" }
+
+	wv := make(map[string]interface{},0)
+	wv["name"] = "users"
+
+	resultStr := cassandra.Increment("statistics", "value", 1, wv)
+	util_ut.IsTrue(t, resultStr == "UPDATE test.statistics SET value=value+1 WHERE name='users';")
+	resultStr = cassandra.Increment("statistics", "value", -3, wv)
+	util_ut.IsTrue(t, resultStr == "UPDATE test.statistics SET value=value-3 WHERE name='users';")
+}
+
+// test lightweight transactions
+func TestCqlGeneration5(t *testing.T) {
+
+	cassandra := CCassandra{ keyspace: "test" }
+
+	wv := make(map[string]interface{},0)
+	wv["name"] = "users"
+
+	resultStr := cassandra.Conditional(cassandra.Delete("statistics", wv), "IF EXISTS")
+	util_ut.IsTrue(t, resultStr == "DELETE FROM test.statistics WHERE name='users' IF EXISTS;")
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package db_model
+
+import (
+	"errors"
+	"strings"
+	"k-ai/db"
+	"k-ai/util"
+	"k-ai/nlu/model"
+	"github.com/gocql/gocql"
+)
+
+// create table if not exists <ks>.aiml_category (
+//    module text, id uuid, patterns text, that text, topic text, template text,
+//    primary key((module), id)
+// );
+//
+// create table if not exists <ks>.aiml_change (
+//    name text, id timeuuid,
+//    primary key((name))
+// );
+//
+// aiml_change holds a single row, a new id for every change of the AIML patterns (their categories or
+// the kb schemas), so other instances know to reload theirs (see aiml.AimlManager.StartReloads)
+
+// the name of the aiml_change row
+const aimlChangeName = "aiml"
+
+// save an AIML category (insert or update)
+func SaveAimlCategory(category model.AimlCategory) error {
+	if len(category.Module) == 0 || util.IsEmpty(&category.Id) || len(category.PatternList) == 0 {
+		return errors.New("SaveAimlCategory() invalid parameter(s)")
+	}
+	value_map := make(map[string]interface{})
+	value_map["module"] = category.Module
+	value_map["id"] = category.Id
+	value_map["patterns"] = strings.Join(category.PatternList, "\n")
+	value_map["that"] = category.That
+	value_map["topic"] = category.Topic
+	value_map["template"] = category.Template
+	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("aiml_category", value_map))
+}
+
+// remove an AIML category
+func DeleteAimlCategory(module string, id gocql.UUID) error {
+	if len(module) == 0 || util.IsEmpty(&id) {
+		return errors.New("DeleteAimlCategory() invalid parameter(s)")
+	}
+	where_map := make(map[string]interface{})
+	where_map["module"] = module
+	where_map["id"] = id
+	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("aiml_category", where_map))
+}
+
+// record that the AIML patterns changed, returns the id of the change
+func SaveAimlChange() (gocql.UUID, error) {
+	id := gocql.TimeUUID()
+	value_map := make(map[string]interface{})
+	value_map["name"] = aimlChangeName
+	value_map["id"] = id
+	return id, db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("aiml_change", value_map))
+}
+
+// the id of the latest change of the AIML patterns, an empty id if they never changed
+func GetAimlChange() (gocql.UUID, error) {
+	var id gocql.UUID
+	where_map := make(map[string]interface{})
+	where_map["name"] = aimlChangeName
+	cql_str := db.Cassandra.SelectPaginated("aiml_change", []string{"id"}, where_map, "", 0, 0)
+	iter := db.Cassandra.Session.Query(cql_str).Iter()
+	iter.Scan(&id)
+	return id, iter.Close()
+}
+
+// the AIML categories of a module, or of all modules if module is empty
+func GetAimlCategoryList(module string) ([]model.AimlCategory, error) {
+	category_list := make([]model.AimlCategory, 0)
+
+	cols := []string{"module", "id", "patterns", "that", "topic", "template"}
+	where_map := make(map[string]interface{})
+	if len(module) > 0 {
+		where_map["module"] = module
+	}
+	cql_str := db.Cassandra.SelectPaginated("aiml_category", cols, where_map, "", 0, 0)
+	iter := db.Cassandra.Session.Query(cql_str).Iter()
+
+	var id gocql.UUID
+	var category_module, patterns, that, topic, template string
+	for iter.Scan(&category_module, &id, &patterns, &that, &topic, &template) {
+		category_list = append(category_list, model.AimlCategory{Id: id, Module: category_module,
+			PatternList: strings.Split(patterns, "\n"), That: that, Topic: topic, Template: template})
+	}
+	return category_list, iter.Close()
+}
@@ -70,6 +70,33 @@ func addIndex(sentence_id *gocql.UUID, word string, tag string, shard int,
 	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("word_unindex", unindexValueSet))
 }
 
+// return what a resolved third person pronoun refers to, or nil if t_token isn't one
+func getReferentList(t_token *model.Token) []string {
+	if t_token.Tag == "PRP" || t_token.Tag == "PRP$" {
+		return t_token.GetReferentList()
+	}
+	return nil
+}
+
+// replace resolved pronouns by what they refer to for searching, one noun for each member of a group
+func resolveReferents(token_list []model.Token) []model.Token {
+	resolved_list := make([]model.Token, 0)
+	for _, t_token := range token_list {
+		referent_list := getReferentList(&t_token)
+		if len(referent_list) == 0 {
+			resolved_list = append(resolved_list, t_token)
+			continue
+		}
+		for _, referent := range referent_list {
+			r_token := t_token
+			r_token.Text = referent
+			r_token.Tag = "NN" // referents are indexed as nouns
+			resolved_list = append(resolved_list, r_token)
+		}
+	}
+	return resolved_list
+}
+
 // index a text string into the system
 func IndexText(topic string, shard int, sentence_list []model.Sentence, score_dropoff float64) error {
 
@@ -77,6 +104,10 @@ func IndexText(topic string, shard int, sentence_list []model.Sentence, score_dr
 		offset := 0
 		score := 1.0
 
+		// the index entries written, a word of a sentence, counted once done (see statistics.go)
+		entry_set := make(map[string]bool, 0)
+		defer func() { countStatistic(StatIndexEntries, int64(len(entry_set))) }()
+
 		for _, sentence := range sentence_list {
 
 			if util.IsEmpty(&sentence.Id) { return errors.New("invalid guid for sentence") }
@@ -89,6 +120,7 @@ func IndexText(topic string, shard int, sentence_list []model.Sentence, score_dr
 
 					err := addIndex(&sentence.Id, stemmed, t_token.Tag, shard, topic, offset, score)
 					if err != nil { return err }
+					entry_set[sentence.Id.String() + ":" + stemmed] = true
 
 					////////////////////////////////////////////////////////////////////////
 					// also index sub parts of compound words like "New York" -> "New" and "York"
@@ -112,6 +144,7 @@ func IndexText(topic string, shard int, sentence_list []model.Sentence, score_dr
 								// add an index for parts of the words
 								err := addIndex(&sentence.Id, part_lcase, t_token.Tag, shard,topic, offset, score * 0.5)
 								if err != nil { return err }
+								entry_set[sentence.Id.String() + ":" + part_lcase] = true
 							}
 						}
 					}
@@ -125,6 +158,21 @@ func IndexText(topic string, shard int, sentence_list []model.Sentence, score_dr
 							// add an index for parts of the words
 							err := addIndex(&sentence.Id, token_semantic, t_token.Tag, shard,topic, offset, score * 0.5)
 							if err != nil { return err }
+							entry_set[sentence.Id.String() + ":" + token_semantic] = true
+						}
+					}
+
+				} else if referent_list := getReferentList(&t_token); len(referent_list) > 0 {
+
+					////////////////////////////////////////////////////////////////////////
+					// a resolved pronoun is indexed as a mention of what it refers to (all members of a group)
+
+					for _, referent := range referent_list {
+						referent_stemmed := lexicon.Lexi.GetStem(referent)
+						if !lexicon.Lexi.IsUndesirable(referent_stemmed) {
+							err := addIndex(&sentence.Id, referent_stemmed, "NN", shard, topic, offset, score * 0.5)
+							if err != nil { return err }
+							entry_set[sentence.Id.String() + ":" + referent_stemmed] = true
 						}
 					}
 
@@ -137,6 +185,8 @@ func IndexText(topic string, shard int, sentence_list []model.Sentence, score_dr
 
 		} // for each sentence
 
+		// and the meaning of each sentence for similarity searches
+		return saveSentenceVectors(topic, sentence_list)
 	}
 	return nil
 }
@@ -184,15 +234,58 @@ func compatible_tag(tag1 string, tag2 string) bool {
 // return how many valid tokens there are in the tokenList
 func GetNumSearchTokens(token_list []model.Token) int {
 	count := 0
-	for _, t_token := range token_list { // for each token
+	for _, t_token := range resolveReferents(token_list) { // for each token
 		stemmed := lexicon.Lexi.GetStem(t_token.Text) // unstem it
-		if len(stemmed) > 0 && !lexicon.Lexi.IsUndesirable(stemmed) { // must be index-able
+		if len(stemmed) > 0 && !lexicon.Lexi.IsUndesirable(stemmed) && t_token.Dep != "aux" { // must be index-able
 			count += 1
 		}
 	}
 	return count
 }
 
+// the score of an index found through a synonym of a query word, relative to the word itself
+const SynonymScore = 0.5
+
+// the most synonyms of a query word looked up, each costs an index read
+const MaxSynonymsPerWord = 5
+
+// read the indexes of a stemmed query word and, if use_synonyms is set, those of its first
+// MaxSynonymsPerWord synonyms (scored lower than the word itself)
+// a word that is a semantic also finds the semantics below it, e.g. location finds city (see IndexText)
+func readIndexesForWord(stemmed string, topic string, shard int, use_synonyms bool) ([]Index, error) {
+	indexes, err := readIndexes(stemmed, topic, shard)
+	if err != nil { return nil, err }
+	seen := map[string]bool{stemmed: true}
+	for _, sub_semantic := range lexicon.Lexi.GetSubSemantics(stemmed) {
+		seen[sub_semantic] = true
+		sub_indexes, err := readIndexes(sub_semantic, topic, shard)
+		if err != nil { return nil, err }
+		indexes = append(indexes, sub_indexes...)
+	}
+	if !use_synonyms {
+		return indexes, nil
+	}
+	num_synonyms := 0
+	for _, synonym := range lexicon.Lexi.GetSynonymList(stemmed) {
+		synonym_stemmed := lexicon.Lexi.GetStem(synonym)
+		if seen[synonym_stemmed] || lexicon.Lexi.IsUndesirable(synonym_stemmed) {
+			continue
+		}
+		if num_synonyms >= MaxSynonymsPerWord {
+			break
+		}
+		num_synonyms += 1
+		seen[synonym_stemmed] = true
+		synonym_indexes, err := readIndexes(synonym_stemmed, topic, shard)
+		if err != nil { return nil, err }
+		for _, index := range synonym_indexes {
+			index.Score *= SynonymScore
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes, nil
+}
+
 /**
  * read a set of indexes using words as a filter for a specific set of meta-data
  * @param organisation_id the id of the organisation to read from
@@ -201,12 +294,25 @@ func GetNumSearchTokens(token_list []model.Token) int {
  * @return a list of URLs that matched
  */
 func ReadIndexesWithFilterForTokens(token_list []model.Token, topic string, shard int) (map[gocql.UUID][]model.IndexMatch, error) {
+	return ReadIndexesForTokens(token_list, topic, shard, false)
+}
+
+/**
+ * read a set of indexes using words as a filter, each word matching its stem or, if use_synonyms is set,
+ * any of its synonyms (see SynonymScore)
+ * @param tokenList a parsed + filtered set of tokens to search through the indexes
+ * @param shard the shard of the index
+ * @param use_synonyms expand the query with synonyms
+ * @return a list of URLs that matched
+ */
+func ReadIndexesForTokens(token_list []model.Token, topic string, shard int, use_synonyms bool) (map[gocql.UUID][]model.IndexMatch, error) {
 	combined_indexes := make(map[gocql.UUID][]model.IndexMatch, 0)
 	i := 0
-	for _, t_token := range token_list { // for each token
+	for _, t_token := range resolveReferents(token_list) { // for each token
 		stemmed := lexicon.Lexi.GetStem(t_token.Text) // unstem it
-		if len(stemmed) > 0 && !lexicon.Lexi.IsUndesirable(stemmed) { // must be index-able
-			indexes, err := readIndexes(stemmed, topic, shard) // read the indexes
+		// auxiliary verbs are never indexed (see IndexText) so don't look for them
+		if len(stemmed) > 0 && !lexicon.Lexi.IsUndesirable(stemmed) && t_token.Dep != "aux" { // must be index-able
+			indexes, err := readIndexesForWord(stemmed, topic, shard, use_synonyms) // read the indexes
  			if err != nil {
 				return nil, err
 			}
@@ -215,14 +321,8 @@ func ReadIndexesWithFilterForTokens(token_list []model.Token, topic string, shar
 			} else if i == 0 { // first index all items are just added
 				for _, index := range indexes {
 					if compatible_tag(t_token.Tag, index.Tag) {
-						if list, ok := combined_indexes[index.Sentence_id]; ok {
-							list = append(list, *model.Convert(index.Sentence_id, index.Word, index.Tag, index.Shard, index.Offset,
-																index.Topic, index.Score, i))
-						} else {
-							combined_indexes[index.Sentence_id] = make([]model.IndexMatch, 0)
-							combined_indexes[index.Sentence_id] = append(combined_indexes[index.Sentence_id],
-								*model.Convert(index.Sentence_id, index.Word, index.Tag, index.Shard, index.Offset, index.Topic, index.Score, i))
-						}
+						combined_indexes[index.Sentence_id] = append(combined_indexes[index.Sentence_id],
+							*model.Convert(index.Sentence_id, index.Word, index.Tag, index.Shard, index.Offset, index.Topic, index.Score, i))
 					}
 				}
 
@@ -232,9 +332,8 @@ func ReadIndexesWithFilterForTokens(token_list []model.Token, topic string, shar
 				for _, index := range indexes {
 					if compatible_tag(t_token.Tag, index.Tag) {
 						if list, ok := combined_indexes[index.Sentence_id]; ok {
-							new_combined_indexes[index.Sentence_id] = make([]model.IndexMatch, 0)
-							for _, item := range list {
-								new_combined_indexes[index.Sentence_id] = append(new_combined_indexes[index.Sentence_id], item)
+							if _, seen := new_combined_indexes[index.Sentence_id]; !seen {
+								new_combined_indexes[index.Sentence_id] = append(make([]model.IndexMatch, 0), list...)
 							}
 							new_combined_indexes[index.Sentence_id] = append(new_combined_indexes[index.Sentence_id],
 								*model.Convert(index.Sentence_id, index.Word, index.Tag, index.Shard, index.Offset, index.Topic, index.Score, i))
@@ -255,6 +354,22 @@ func ReadIndexesWithFilterForTokens(token_list []model.Token, topic string, shar
 }
 
 
+// the score of a matching sentence: the sum of the best score of each query word
+// (so a sentence matched through synonyms scores lower than one matching the words themselves)
+func MatchScore(index_list []model.IndexMatch) float64 {
+	best_map := make(map[int]float64, 0)
+	for _, index := range index_list {
+		if best, ok := best_map[index.KeywordIndex]; !ok || index.Score > best {
+			best_map[index.KeywordIndex] = index.Score
+		}
+	}
+	score := 0.0
+	for _, best := range best_map {
+		score += best
+	}
+	return score
+}
+
 // read the list of un-indexes for a url / origin / kb
 func readUnindexes(sentence_id gocql.UUID) ([]UnIndex,error) {
 	return_list := make([]UnIndex,0)
@@ -299,11 +414,17 @@ func RemoveIndexes(sentence_id gocql.UUID, topic string) error {
 	unindex_list, err := readUnindexes(sentence_id)
 	if err != nil { return err }
 
-	for _, unindex := range unindex_list {
+	for i, unindex := range unindex_list {
 		// delete each word index
 		err = deleteIndex(topic, &unindex)
-		if err != nil { return err }
+		if err != nil {
+			countStatistic(StatIndexEntries, -int64(i))
+			return err
+		}
 	}
+	countStatistic(StatIndexEntries, -int64(len(unindex_list)))
+	err = removeSentenceVector(sentence_id, topic)
+	if err != nil { return err }
 	return deleteUnIndex(sentence_id)
 }
 
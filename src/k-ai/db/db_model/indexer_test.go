@@ -379,3 +379,71 @@ func TestPronounReplacement1(t *testing.T) {
 
 }
 
+
+// test a pronoun referring to a group is indexed, and searched, by all of its members
+func TestIndexerGroupReferent1(t *testing.T) {
+
+	// They watched the boats.  (They = Peter and Sherry)
+	const theyWatchedTheBoats = `[{"tokenList":[{"index":0,"list":[1],"tag":"PRP","text":"They","dep":"nsubj","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBD","text":"watched","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NNS","text":"boats","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":4,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+	sl1 := jsonToSentenceList(t, theyWatchedTheBoats)
+	sl1[0].TokenList[0].Anaphora = "Peter and Sherry"
+	sl1[0].TokenList[0].AnaphoraList = []string{"Peter", "Sherry"}
+
+	// searching for a resolved group pronoun searches for each member
+	resolved_list := resolveReferents(sl1[0].TokenList)
+	util_ut.IsTrue(t, len(resolved_list) == 6)
+	util_ut.IsTrue(t, resolved_list[0].Text == "Peter" && resolved_list[1].Text == "Sherry")
+
+	// init cassandra
+	db.DropKeyspace("localhost", "kai_ai_index_test_7")
+	db.Cassandra.InitCassandraConnection("localhost", "kai_ai_index_test_7", 1)
+
+	err := IndexText("topic8", 0, sl1, 1.0)
+	util_ut.Check(t, err)
+
+	for _, name := range []string{"Peter", "Sherry"} {
+		token_list := []model.Token{{Text: name, Tag: "NNP"}, {Text: "boats", Tag: "NNS"}}
+		index_map, err := ReadIndexesWithFilterForTokens(token_list, "topic8", 0)
+		util_ut.Check(t, err)
+		util_ut.IsTrue(t, len(index_map) == 1)
+		contains(t, index_map, sl1[0].Id)
+	}
+
+	db.DropKeyspace("localhost", "kai_ai_index_test_7")
+}
+
+
+// test query expansion with synonyms (car, car-ferry, ferry are synonyms)
+func TestIndexerSynonyms1(t *testing.T) {
+
+	// exact hits score higher than synonym hits
+	exact_list := []model.IndexMatch{{Score: 1.0, KeywordIndex: 0}, {Score: 0.5, KeywordIndex: 0}, {Score: 1.0, KeywordIndex: 1}}
+	synonym_list := []model.IndexMatch{{Score: 1.0 * SynonymScore, KeywordIndex: 0}, {Score: 1.0, KeywordIndex: 1}}
+	util_ut.IsTrue(t, MatchScore(exact_list) == 2.0)
+	util_ut.IsTrue(t, MatchScore(synonym_list) < MatchScore(exact_list))
+
+	const peterTookTheFerry = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBD","text":"took","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NN","text":"ferry","dep":"dobj","synid":-1,"semantic":""}]}]`
+	const peterTookTheCar = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBD","text":"took","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NN","text":"car","dep":"dobj","synid":-1,"semantic":""}]}]`
+
+	// init cassandra
+	db.DropKeyspace("localhost", "kai_ai_index_test_8")
+	db.Cassandra.InitCassandraConnection("localhost", "kai_ai_index_test_8", 1)
+
+	sl1 := jsonToSentenceList(t, peterTookTheFerry)
+	sl2 := jsonToSentenceList(t, peterTookTheCar)
+	util_ut.Check(t, IndexText("topic9", 0, sl1, 1.0))
+	util_ut.Check(t, IndexText("topic9", 0, sl2, 1.0))
+
+	token_list := []model.Token{{Text: "Peter", Tag: "NNP"}, {Text: "car", Tag: "NN"}}
+	index_map, err := ReadIndexesForTokens(token_list, "topic9", 0, false)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(index_map) == 1)
+	contains(t, index_map, sl2[0].Id)
+
+	index_map, err = ReadIndexesForTokens(token_list, "topic9", 0, true)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(index_map) == 2)
+	util_ut.IsTrue(t, MatchScore(index_map[sl2[0].Id]) > MatchScore(index_map[sl1[0].Id]))
+
+	db.DropKeyspace("localhost", "kai_ai_index_test_8")
+}
@@ -43,7 +43,7 @@ func (k *KBEntry) Save() error {
 	value_map["id"] = k.Id
 	value_map["topic"] = k.Topic
 
-	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("knowledge_base", value_map))
+	return insertCounted("knowledge_base", value_map, StatKBEntries)
 }
 
 // load a KB item from db
@@ -105,7 +105,7 @@ func (k *KBEntry) Delete() error {
 	where_map["topic"] = k.Topic
 	where_map["id"] = k.Id
 
-	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("knowledge_base", where_map))
+	return deleteCounted("knowledge_base", where_map, StatKBEntries)
 }
 
 
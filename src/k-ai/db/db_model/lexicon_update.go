@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package db_model
+
+import (
+	"os"
+	"sort"
+	"time"
+	"sync"
+	"errors"
+	"k-ai/db"
+	"k-ai/logger"
+	"k-ai/nlu/lexicon"
+	"github.com/gocql/gocql"
+)
+
+//
+// Lexicon updates in the database
+//
+// Every change to the lexicon is stored in lexicon_update with the instance that made it and a
+// timeuuid of that instance's clock.  Each instance applies its own changes straight away and
+// periodically reads, instance by instance, the changes made after the last one it saw of that
+// instance.  Only ids of the same instance are compared, so the clocks of instances needn't agree.
+// An instance keeps its name (and its partition) across restarts, see LexiconInstance.
+// Compaction (at startup and every LexiconCompactInterval) keeps only the latest change for each
+// word of each instance, it never decides between the changes of two instances.
+//
+// The updates of the legacy lexicon_updates.txt are copied into the partition of their own instance
+// (legacyLexiconInstance) the first time, the file itself is left alone.
+//
+
+// how often the updates are compacted
+const LexiconCompactInterval = time.Hour
+
+// the name of this server instance, the origin of its updates, unique among the instances sharing the db
+// it stays the same after a restart: InstanceName of properties.ini, or the host name if that isn't set
+var LexiconInstance = hostName()
+
+// the instance of the updates copied from lexicon_updates.txt
+const legacyLexiconInstance = "lexicon_updates.txt"
+
+// the id of the latest update applied to the lexicon, by instance
+var lexiconLastSeen = make(map[string]gocql.UUID, 0)
+// the time of the latest update of this instance, its ids always go up
+var lexiconLastTime time.Time
+var lexiconUpdateLock sync.Mutex
+
+// a lexicon update as stored
+type StoredLexiconUpdate struct {
+	Id gocql.UUID
+	lexicon.LexiconUpdate
+}
+
+// the host name, the name of an instance unless properties.ini names it
+func hostName() string {
+	name, err := os.Hostname()
+	if err != nil || len(name) == 0 {
+		return "kai"
+	}
+	return name
+}
+
+// sort updates oldest first
+func sortLexiconUpdates(update_list []StoredLexiconUpdate) {
+	sort.SliceStable(update_list, func(i, j int) bool {
+		return update_list[i].Id.Timestamp() < update_list[j].Id.Timestamp()
+	})
+}
+
+// a new id for an update of this instance, later than all before it even if the clock goes back
+// the lock must be held
+func nextLexiconUpdateId(t time.Time) gocql.UUID {
+	if !t.After(lexiconLastTime) {
+		t = lexiconLastTime.Add(100 * time.Nanosecond)  // the resolution of a timeuuid
+	}
+	lexiconLastTime = t
+	return gocql.UUIDFromTime(t)
+}
+
+// store a lexicon update and apply it to the lexicon
+// the time and instance of the update are set here
+func SaveLexiconUpdate(update lexicon.LexiconUpdate) error {
+	err := update.Validate()
+	if err != nil { return errors.New("SaveLexiconUpdate(): " + err.Error()) }
+
+	lexiconUpdateLock.Lock()
+	defer lexiconUpdateLock.Unlock()
+	id := nextLexiconUpdateId(time.Now())
+	update.When = id.Time().UnixNano()
+	update.Instance = LexiconInstance
+	err = insertLexiconUpdate(id, update)
+	if err != nil { return err }
+	lexiconLastSeen[LexiconInstance] = id  // no need to read it back
+	return lexicon.Lexi.ApplyUpdate(update)
+}
+
+// write an update to the db
+func insertLexiconUpdate(id gocql.UUID, update lexicon.LexiconUpdate) error {
+	value_map := make(map[string]interface{})
+	value_map["instance"] = update.Instance
+	value_map["id"] = id
+	value_map["kind"] = update.Kind
+	value_map["word"] = update.Word
+	value_map["operation"] = update.Operation
+	value_map["value"] = update.Value
+	value_map["origin"] = update.Origin
+	value_map["scope"] = update.Scope
+	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("lexicon_update", value_map))
+}
+
+// the instances that have updates in the db
+func lexiconUpdateInstances() ([]string, error) {
+	instance_list := make([]string, 0)
+	select_str := db.Cassandra.SelectPaginated("lexicon_update", []string{"distinct instance"}, nil, "", 0, 0)
+	iter := db.Cassandra.Session.Query(select_str).Iter()
+	var instance string
+	for iter.Scan(&instance) {
+		instance_list = append(instance_list, instance)
+	}
+	return instance_list, iter.Close()
+}
+
+// read the updates of an instance made after the update since (nil for all), oldest first
+func ReadLexiconUpdates(instance string, since *gocql.UUID) ([]StoredLexiconUpdate, error) {
+	update_list := make([]StoredLexiconUpdate, 0)
+
+	columns := []string{"id", "kind", "word", "operation", "value", "origin", "scope"}
+	where_map := make(map[string]interface{}, 0)
+	where_map["instance"] = instance
+
+	select_str := db.Cassandra.SelectPaginated("lexicon_update", columns, where_map, "id", since, 0)
+	iter := db.Cassandra.Session.Query(select_str).Iter()
+
+	var id gocql.UUID
+	var kind, word, operation, value, origin, scope string
+	for iter.Scan(&id, &kind, &word, &operation, &value, &origin, &scope) {
+		update_list = append(update_list, StoredLexiconUpdate{Id: id, LexiconUpdate: lexicon.LexiconUpdate{Kind: kind,
+			When: id.Time().UnixNano(), Word: word, Operation: operation, Value: value, Origin: origin,
+			Instance: instance, Scope: scope}})
+	}
+	return update_list, iter.Close()
+}
+
+// read the updates of all instances, oldest first
+func ReadAllLexiconUpdates() ([]StoredLexiconUpdate, error) {
+	instance_list, err := lexiconUpdateInstances()
+	if err != nil { return nil, err }
+	update_list := make([]StoredLexiconUpdate, 0)
+	for _, instance := range instance_list {
+		instance_update_list, err := ReadLexiconUpdates(instance, nil)
+		if err != nil { return nil, err }
+		update_list = append(update_list, instance_update_list...)
+	}
+	sortLexiconUpdates(update_list)
+	return update_list, nil
+}
+
+// the updates of a list (oldest first) that a later update of the same word by the same instance replaces
+func supersededLexiconUpdates(update_list []StoredLexiconUpdate) []StoredLexiconUpdate {
+	latest_map := make(map[string]gocql.UUID, 0)
+	for _, update := range update_list {
+		latest_map[update.Instance + "|" + update.Kind + "|" + update.Key()] = update.Id
+	}
+	superseded_list := make([]StoredLexiconUpdate, 0)
+	for _, update := range update_list {
+		if update.Id != latest_map[update.Instance + "|" + update.Kind + "|" + update.Key()] {
+			superseded_list = append(superseded_list, update)
+		}
+	}
+	return superseded_list
+}
+
+// remove all but the latest update for each word of each instance, returns the number of updates removed
+func CompactLexiconUpdates() (int, error) {
+	update_list, err := ReadAllLexiconUpdates()
+	if err != nil { return 0, err }
+	num_removed := 0
+	for _, update := range supersededLexiconUpdates(update_list) {
+		where_map := make(map[string]interface{})
+		where_map["instance"] = update.Instance
+		where_map["id"] = update.Id
+		err = db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("lexicon_update", where_map))
+		if err != nil { return num_removed, err }
+		num_removed += 1
+	}
+	return num_removed, nil
+}
+
+// apply the updates other instances have made since we last looked to the lexicon
+func ApplyLexiconUpdates() error {
+	lexiconUpdateLock.Lock()
+	defer lexiconUpdateLock.Unlock()
+
+	instance_list, err := lexiconUpdateInstances()
+	if err != nil { return err }
+	update_list := make([]StoredLexiconUpdate, 0)
+	for _, instance := range instance_list {
+		var since *gocql.UUID
+		if last_seen, ok := lexiconLastSeen[instance]; ok {
+			since = &last_seen
+		}
+		instance_update_list, err := ReadLexiconUpdates(instance, since)
+		if err != nil { return err }
+		update_list = append(update_list, instance_update_list...)
+	}
+	// the updates of different instances in the order they were made, as far as their clocks tell
+	sortLexiconUpdates(update_list)
+	for _, update := range update_list {
+		err = lexicon.Lexi.ApplyUpdate(update.LexiconUpdate)
+		if err != nil { return err }
+		lexiconLastSeen[update.Instance] = update.Id
+		// made by us before a restart: our new ids go on from there, even if the clock went back
+		if update.Instance == LexiconInstance && update.Id.Time().After(lexiconLastTime) {
+			lexiconLastTime = update.Id.Time()
+		}
+	}
+	return nil
+}
+
+// copy the updates of the legacy lexicon_updates.txt file into the db, unless that was done before
+func importLegacyLexiconUpdates() error {
+	imported_list, err := ReadLexiconUpdates(legacyLexiconInstance, nil)
+	if err != nil { return err }
+	if len(imported_list) > 0 {
+		return nil
+	}
+	update_list, err := lexicon.ReadLegacyUpdates()
+	if err != nil { return err }
+	for _, update := range update_list {
+		update.Instance = legacyLexiconInstance
+		err = insertLexiconUpdate(gocql.UUIDFromTime(time.Unix(0, update.When)), update)
+		if err != nil { return err }
+	}
+	if len(update_list) > 0 {
+		logger.Log.Info("lexicon: copied %d updates from lexicon_updates.txt to the db", len(update_list))
+	}
+	return nil
+}
+
+// move the updates of instances named by a random id (older versions took a new one at every start) into
+// the partition of this instance, so there's a partition per instance rather than per start
+// the updates keep their ids: moved twice (by two instances at once), they're the same rows
+func adoptOldLexiconInstances() error {
+	instance_list, err := lexiconUpdateInstances()
+	if err != nil { return err }
+	for _, instance := range instance_list {
+		if _, err := gocql.ParseUUID(instance); err != nil || instance == LexiconInstance {
+			continue // named, not an old random id
+		}
+		update_list, err := ReadLexiconUpdates(instance, nil)
+		if err != nil { return err }
+		for _, update := range update_list {
+			update.Instance = LexiconInstance
+			err = insertLexiconUpdate(update.Id, update.LexiconUpdate)
+			if err != nil { return err }
+		}
+		where_map := make(map[string]interface{})
+		where_map["instance"] = instance
+		err = db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("lexicon_update", where_map))
+		if err != nil { return err }
+		logger.Log.Info("lexicon: moved %d updates of instance %s to %s", len(update_list), instance, LexiconInstance)
+	}
+	return nil
+}
+
+// compact the updates, logging what was done
+func compactLexiconUpdates() error {
+	num_removed, err := CompactLexiconUpdates()
+	if err != nil { return err }
+	if num_removed > 0 {
+		logger.Log.Info("lexicon: compacted %d updates", num_removed)
+	}
+	return nil
+}
+
+// bring the lexicon up to date with the db and keep checking for updates from other instances
+// every interval, compacting the updates every LexiconCompactInterval, forever
+func StartLexiconUpdates(interval time.Duration) error {
+	err := importLegacyLexiconUpdates()
+	if err != nil { return err }
+	err = adoptOldLexiconInstances()
+	if err != nil { return err }
+	err = compactLexiconUpdates()
+	if err != nil { return err }
+	err = ApplyLexiconUpdates()
+	if err != nil { return err }
+
+	if interval > 0 {
+		go func() {
+			last_compacted := time.Now()
+			for {
+				time.Sleep(interval)
+				err := ApplyLexiconUpdates()
+				if err != nil {
+					logger.Log.Error("lexicon: applying updates: %s", err.Error())
+				}
+				if time.Since(last_compacted) > LexiconCompactInterval {
+					err = compactLexiconUpdates()
+					if err != nil {
+						logger.Log.Error("lexicon: compacting updates: %s", err.Error())
+					}
+					last_compacted = time.Now()
+				}
+			}
+		}()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package db_model
+
+import (
+	"time"
+	"testing"
+	"k-ai/db"
+	"k-ai/nlu/lexicon"
+	"k-ai/util_ut"
+	"github.com/gocql/gocql"
+)
+
+// test lexicon updates are stored, read back, applied and compacted
+func TestLexiconUpdate1(t *testing.T) {
+
+	// init cassandra
+	db.DropKeyspace("localhost", "kai_ai_lexicon_update_test")
+	db.Cassandra.InitCassandraConnection("localhost", "kai_ai_lexicon_update_test", 1)
+
+	save := lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Word: "Zorblax", Operation: lexicon.OpSave,
+		Value: "animal", Origin: "unit test"}
+	util_ut.Check(t, SaveLexiconUpdate(save))
+	util_ut.IsTrue(t, lexicon.Lexi.GetSemantic("Zorblax") == "animal")
+
+	save.Value = "plant"
+	util_ut.Check(t, SaveLexiconUpdate(save))
+	util_ut.IsTrue(t, lexicon.Lexi.GetSemantic("Zorblax") == "plant")
+
+	update_list, err := ReadLexiconUpdates(LexiconInstance, nil)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(update_list) == 2)
+	util_ut.IsTrue(t, update_list[0].When < update_list[1].When && update_list[1].Value == "plant")
+	util_ut.IsTrue(t, update_list[0].Origin == "unit test" && update_list[0].Instance == LexiconInstance)
+
+	// an instance whose clock is far behind ours still has its update applied
+	other := lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Word: "Quibble", Operation: lexicon.OpSave,
+		Value: "animal", Origin: "unit test", Instance: "other instance"}
+	util_ut.Check(t, ApplyLexiconUpdates())
+	util_ut.Check(t, insertLexiconUpdate(gocql.UUIDFromTime(time.Now().Add(-time.Hour)), other))
+	util_ut.Check(t, ApplyLexiconUpdates())
+	util_ut.IsTrue(t, lexicon.Lexi.GetSemantic("Quibble") == "animal")
+
+	// only the latest update for a word survives compaction
+	num_removed, err := CompactLexiconUpdates()
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, num_removed == 1)
+	update_list, err = ReadAllLexiconUpdates()
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(update_list) == 2 && update_list[0].Word == "Quibble" && update_list[1].Value == "plant")
+
+	// updates made elsewhere are applied
+	lexicon.Lexi.RemoveSemantic("Zorblax")
+	delete(lexiconLastSeen, LexiconInstance)
+	util_ut.Check(t, ApplyLexiconUpdates())
+	util_ut.IsTrue(t, lexicon.Lexi.GetSemantic("Zorblax") == "plant")
+
+	// the legacy file is copied once, and left alone
+	legacy_list, err := lexicon.ReadLegacyUpdates()
+	util_ut.Check(t, err)
+	util_ut.Check(t, importLegacyLexiconUpdates())
+	util_ut.Check(t, importLegacyLexiconUpdates())
+	update_list, err = ReadLexiconUpdates(legacyLexiconInstance, nil)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(update_list) == len(legacy_list) && len(update_list) > 0)
+	legacy_list_after, err := lexicon.ReadLegacyUpdates()
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(legacy_list_after) == len(legacy_list))
+
+	// the partition of an instance named by an old random id becomes part of this instance's
+	old_instance := gocql.TimeUUID().String()
+	old := lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Word: "Quibble", Operation: lexicon.OpSave,
+		Value: "plant", Origin: "unit test", Instance: old_instance}
+	old_id := gocql.TimeUUID()
+	util_ut.Check(t, insertLexiconUpdate(old_id, old))
+	util_ut.Check(t, adoptOldLexiconInstances())
+	update_list, err = ReadLexiconUpdates(old_instance, nil)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(update_list) == 0)
+	update_list, err = ReadLexiconUpdates(LexiconInstance, &old_id)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(update_list) == 0)
+	update_list, err = ReadLexiconUpdates(LexiconInstance, nil)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, update_list[len(update_list) - 1].Id == old_id && update_list[len(update_list) - 1].Value == "plant")
+
+	lexicon.Lexi.RemoveSemantic("Quibble")
+	lexicon.Lexi.RemoveSemantic("Zorblax")
+	db.DropKeyspace("localhost", "kai_ai_lexicon_update_test")
+}
+
+// test the ids of an instance's updates always go up, and which updates compaction removes
+func TestLexiconUpdate2(t *testing.T) {
+	lexiconUpdateLock.Lock()
+	now := time.Now()
+	id_1 := nextLexiconUpdateId(now)
+	id_2 := nextLexiconUpdateId(now.Add(-time.Minute))  // the clock went back
+	lexiconUpdateLock.Unlock()
+	util_ut.IsTrue(t, id_2.Timestamp() > id_1.Timestamp())
+
+	update := func(instance string, minutes int, word string, value string) StoredLexiconUpdate {
+		return StoredLexiconUpdate{Id: gocql.UUIDFromTime(now.Add(time.Duration(minutes) * time.Minute)),
+			LexiconUpdate: lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Word: word, Value: value, Instance: instance}}
+	}
+	update_list := []StoredLexiconUpdate{update("b", 3, "cat", "animal"), update("a", 1, "cat", "plant"),
+		update("a", 2, "dog", "animal"), update("a", 4, "cat", "pet")}
+	sortLexiconUpdates(update_list)
+	util_ut.IsTrue(t, update_list[0].Instance == "a" && update_list[2].Instance == "b")
+	// only an update of the same instance replaces one, their clocks may not agree
+	superseded_list := supersededLexiconUpdates(update_list)
+	util_ut.IsTrue(t, len(superseded_list) == 1 && superseded_list[0].Value == "plant")
+}
@@ -16,6 +16,7 @@ import (
 	"k-ai/db"
 	"k-ai/util"
 	"errors"
+	"sort"
 	"encoding/json"
 	"k-ai/nlu/model"
 	"k-ai/nlu/tokenizer"
@@ -50,7 +51,7 @@ func SaveText(sentence_list []model.Sentence, topic string) error {
 		value_map_2["id"] = sentence.Id
 		value_map_2["topic"] = topic
 		value_map_2["json_data"] = string(json_str)
-		err = db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("sentence_by_id", value_map_2))
+		err = insertCounted("sentence_by_id", value_map_2, StatFactoids)
 		if err != nil { return err }
 	}
 	return nil
@@ -69,7 +70,7 @@ func DeleteText(id *gocql.UUID, topic string) error {
 
 	where_map2 := make(map[string]interface{})
 	where_map2["id"] = id
-	err = db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("sentence_by_id", where_map2))
+	err = deleteCounted("sentence_by_id", where_map2, StatFactoids)
 	if err != nil { return err }
 
 	return nil
@@ -98,21 +99,53 @@ func GetText(sentence_id *gocql.UUID) (*model.Sentence, error) {
 	return nil, iter.Close()
 }
 
-// find a piece of text using the indexes
-func FindText(tokenList []model.Token, topic string) (*model.ATResultList, error) {
-	index_list, err := ReadIndexesWithFilterForTokens(tokenList, topic, 0)
+// find the sentences matching a set of tokens using the indexes, optionally matching synonyms of the tokens
+func FindSentences(tokenList []model.Token, topic string, use_synonyms bool) ([]model.Sentence, error) {
+	index_list, err := ReadIndexesForTokens(tokenList, topic, 0, use_synonyms)
 	if err != nil { return nil, err }
-	rs := model.ATResultList{ResultList: make([]model.ATResult,0)}
+	sentence_list := make([]model.Sentence, 0)
+	score_list := make([]float64, 0)
 
 	// go through each index and get the associated text if possible
-	for sentence_id, _ := range index_list {
+	for sentence_id, match_list := range index_list {
 		sentence, err := GetText(&sentence_id)
 		if err == nil && sentence != nil && len(sentence.TokenList) > 0 {
-			str := tokenizer.ToString(sentence.TokenList)
-			rs.ResultList = append(rs.ResultList,
-				model.ATResult{Text: str, Sentence_id: sentence_id, Topic: sentence.Topic})
+			sentence_list = append(sentence_list, *sentence)
+			score_list = append(score_list, MatchScore(match_list))
 		}
 	}
-	return &rs, nil
+	// best matches first
+	sort.Sort(byScore{sentence_list, score_list})
+	return sentence_list, nil
+}
+
+// convert a list of sentences to ask results
+func SentencesToResults(sentence_list []model.Sentence) *model.ATResultList {
+	rs := model.ATResultList{ResultList: make([]model.ATResult,0)}
+	for _, sentence := range sentence_list {
+		str := tokenizer.ToString(sentence.TokenList)
+		rs.ResultList = append(rs.ResultList,
+			model.ATResult{Text: str, Sentence_id: sentence.Id, Topic: sentence.Topic})
+	}
+	return &rs
 }
 
+// sort sentences by their match scores, highest first
+type byScore struct {
+	sentence_list []model.Sentence
+	score_list    []float64
+}
+
+func (s byScore) Len() int           { return len(s.sentence_list) }
+func (s byScore) Less(i, j int) bool { return s.score_list[i] > s.score_list[j] }
+func (s byScore) Swap(i, j int) {
+	s.sentence_list[i], s.sentence_list[j] = s.sentence_list[j], s.sentence_list[i]
+	s.score_list[i], s.score_list[j] = s.score_list[j], s.score_list[i]
+}
+
+// find a piece of text using the indexes, optionally matching synonyms of the tokens
+func FindText(tokenList []model.Token, topic string, use_synonyms bool) (*model.ATResultList, error) {
+	sentence_list, err := FindSentences(tokenList, topic, use_synonyms)
+	if err != nil { return nil, err }
+	return SentencesToResults(sentence_list), nil
+}
@@ -16,6 +16,7 @@ import (
 	"k-ai/db"
 	"k-ai/nlu/lexicon"
 	"k-ai/util_ut"
+	"k-ai/nlu/glove"
 )
 
 // perform further index tests multiple keyword
@@ -108,3 +109,84 @@ func TestTextSemantics(t *testing.T) {
 	db.DropKeyspace("localhost", "kai_ai_sem_1")
 }
 
+// sentences can be found by their meaning when there are word vectors
+func TestSimilarText1(t *testing.T) {
+
+	// init cassandra
+	db.DropKeyspace("localhost", "kai_ai_similar")
+	db.Cassandra.InitCassandraConnection("localhost", "kai_ai_similar", 1)
+	glove.Vectors = glove.CreateMapSystem(map[string][]float64{"car": {1.0, 0.1, 0.0}, "automobile": {0.95, 0.15, 0.0},
+		"fast": {0.1, 1.0, 0.0}, "quick": {0.15, 0.9, 0.05}, "banana": {-1.0, 0.0, 0.2}, "yellow": {-0.9, 0.1, 0.3}})
+	defer func() { glove.Vectors = nil }()
+
+	// The car is fast.  Bananas are yellow.
+	sentenceListStr := `[{"tokenList":[{"index":0,"list":[1],"tag":"DT","text":"The","dep":"det","synid":-1,"semantic":""},{"index":1,"list":[2],"tag":"NN","text":"car","dep":"nsubj","synid":-1,"semantic":""},{"index":2,"list":[],"tag":"VBZ","text":"is","dep":"ROOT","synid":-1,"semantic":""},{"index":3,"list":[2],"tag":"JJ","text":"fast","dep":"acomp","synid":-1,"semantic":""},{"index":4,"list":[2],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]},` +
+		`{"tokenList":[{"index":0,"list":[1],"tag":"NNS","text":"banana","dep":"nsubj","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBP","text":"are","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[1],"tag":"JJ","text":"yellow","dep":"acomp","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+	sentenceList := jsonToSentenceList(t, sentenceListStr)
+	util_ut.Check(t, SaveText(sentenceList, "unit test"))
+	util_ut.Check(t, IndexText("unit test", 0, sentenceList, 1.0))
+
+	// is the automobile quick?
+	questionStr := `[{"tokenList":[{"index":0,"list":[],"tag":"VBZ","text":"is","dep":"ROOT","synid":-1,"semantic":""},{"index":1,"list":[2],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":2,"list":[0],"tag":"NN","text":"automobile","dep":"nsubj","synid":-1,"semantic":""},{"index":3,"list":[0],"tag":"JJ","text":"quick","dep":"acomp","synid":-1,"semantic":""},{"index":4,"list":[0],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+	question := jsonToSentenceList(t, questionStr)[0]
+	similar_list, score_list, err := FindSimilarSentences(question.TokenList, "unit test")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(similar_list) == 1 && similar_list[0].Id == sentenceList[0].Id && score_list[0] >= SimilarityThreshold)
+
+	// removing the indexes removes its vector
+	util_ut.Check(t, RemoveIndexes(sentenceList[0].Id, "unit test"))
+	similar_list, _, err = FindSimilarSentences(question.TokenList, "unit test")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(similar_list) == 0)
+
+	db.DropKeyspace("localhost", "kai_ai_similar")
+}
+
+// sentences taught before there were word vectors get their vectors when the vectors are loaded
+func TestSimilarText2(t *testing.T) {
+
+	// init cassandra
+	db.DropKeyspace("localhost", "kai_ai_similar")
+	db.Cassandra.InitCassandraConnection("localhost", "kai_ai_similar", 1)
+
+	// The car is fast.
+	sentenceListStr := `[{"tokenList":[{"index":0,"list":[1],"tag":"DT","text":"The","dep":"det","synid":-1,"semantic":""},{"index":1,"list":[2],"tag":"NN","text":"car","dep":"nsubj","synid":-1,"semantic":""},{"index":2,"list":[],"tag":"VBZ","text":"is","dep":"ROOT","synid":-1,"semantic":""},{"index":3,"list":[2],"tag":"JJ","text":"fast","dep":"acomp","synid":-1,"semantic":""},{"index":4,"list":[2],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+	sentenceList := jsonToSentenceList(t, sentenceListStr)
+	util_ut.Check(t, SaveText(sentenceList, "unit test"))
+	util_ut.Check(t, IndexText("unit test", 0, sentenceList, 1.0))
+
+	glove.Vectors = glove.CreateMapSystem(map[string][]float64{"car": {1.0, 0.1, 0.0}, "automobile": {0.95, 0.15, 0.0},
+		"fast": {0.1, 1.0, 0.0}, "quick": {0.15, 0.9, 0.05}})
+	defer func() { glove.Vectors = nil }()
+
+	// automobile?
+	questionStr := `[{"tokenList":[{"index":0,"list":[],"tag":"NN","text":"automobile","dep":"ROOT","synid":-1,"semantic":""},{"index":1,"list":[0],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+	question := jsonToSentenceList(t, questionStr)[0]
+	similar_list, _, err := FindSimilarSentences(question.TokenList, "unit test")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(similar_list) == 0)
+
+	count, err := BackfillSentenceVectors()
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, count == 1)
+	similar_list, _, err = FindSimilarSentences(question.TokenList, "unit test")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(similar_list) == 1 && similar_list[0].Id == sentenceList[0].Id)
+
+	// only once
+	count, err = BackfillSentenceVectors()
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, count == 0)
+
+	db.DropKeyspace("localhost", "kai_ai_similar")
+}
+
+// vectors survive storage as text
+func TestVectorEncoding1(t *testing.T) {
+	vector := []float32{1.0, -0.5, 0.25, 3.0e-7}
+	decoded, err := decodeVector(encodeVector(vector))
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(decoded) == len(vector) && decoded[0] == 1.0 && decoded[1] == -0.5 && decoded[3] == 3.0e-7)
+	_, err = decodeVector("not base64!")
+	util_ut.IsTrue(t, err != nil)
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package db_model
+import (
+	"math"
+	"sync"
+	"time"
+	"errors"
+	"encoding/json"
+	"encoding/base64"
+	"encoding/binary"
+	"k-ai/db"
+	"k-ai/nlu/glove"
+	"k-ai/nlu/model"
+	"k-ai/nlu/lexicon"
+	"github.com/gocql/gocql"
+)
+
+//
+// Sentence vectors
+//
+// When word vectors are loaded (glove.Vectors) each indexed sentence also stores its sentence
+// vector (see glove.SentenceVector) in sentence_vector, by topic.  A question whose words don't
+// find anything in the indexes can then still find the factoids closest to it in meaning.
+//
+// The vectors of a topic are read once into an in-memory LSH index (glove.VectorIndex) that is
+// searched instead of the table.  This instance keeps its indexes up to date itself, and re-reads
+// a topic every SentenceIndexRefresh for the changes of other instances.  The index of a topic
+// not asked about for SentenceIndexTimeout is dropped.
+// Sentences taught before the word vectors were loaded (or with other word vectors) get their vectors
+// from BackfillSentenceVectors.
+//
+
+// the minimum cosine similarity of a question and a factoid for a similarity match
+const SimilarityThreshold = 0.75
+
+// the maximum number of factoids returned by a similarity search
+const MaxSimilarSentences = 5
+
+// how often the sentence vectors of a topic are re-read, and when an unused topic's index is dropped
+const SentenceIndexRefresh = 10 * time.Minute
+const SentenceIndexTimeout = time.Hour
+
+// the sentence vectors of a topic
+type sentenceIndex struct {
+	index     *glove.VectorIndex
+	vectors   *glove.MapSystem  // the word vectors the index was made with
+	loaded    time.Time
+	last_used time.Time
+}
+
+// the sentence indexes by topic
+var sentenceIndexes = make(map[string]*sentenceIndex, 0)
+var sentenceIndexLastSweep = time.Now()
+var sentenceIndexMutex sync.Mutex
+
+// the vector of a sentence for similarity searches, nil if there are no vectors
+func sentenceVector(token_list []model.Token) []float32 {
+	if glove.Vectors == nil {
+		return nil
+	}
+	return glove.Vectors.SentenceVector(resolveReferents(token_list), lexicon.Lexi.IsUndesirable)
+}
+
+// a vector as text for storage, the base64 of its little-endian float32s
+func encodeVector(vector []float32) string {
+	buffer := make([]byte, 4 * len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(buffer[i * 4:], math.Float32bits(value))
+	}
+	return base64.StdEncoding.EncodeToString(buffer)
+}
+
+// the vector of a stored text
+func decodeVector(str string) ([]float32, error) {
+	buffer, err := base64.StdEncoding.DecodeString(str)
+	if err != nil { return nil, err }
+	if len(buffer) % 4 != 0 {
+		return nil, errors.New("invalid vector length")
+	}
+	vector := make([]float32, len(buffer) / 4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buffer[i * 4:]))
+	}
+	return vector, nil
+}
+
+// save the vectors of a list of sentences for a topic, if there are word vectors
+func saveSentenceVectors(topic string, sentence_list []model.Sentence) error {
+	for _, sentence := range sentence_list {
+		vector := sentenceVector(sentence.TokenList)
+		if vector == nil {
+			continue
+		}
+		value_map := make(map[string]interface{})
+		value_map["topic"] = topic
+		value_map["id"] = sentence.Id
+		value_map["vector"] = encodeVector(vector)
+		err := db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("sentence_vector", value_map))
+		if err != nil { return err }
+		if index := cachedSentenceIndex(topic); index != nil {
+			index.Add(sentence.Id.String(), vector)
+		}
+	}
+	return nil
+}
+
+// save the vectors of the sentences that don't have one for the current word vectors
+// returns the number of sentences it saved a vector for
+func BackfillSentenceVectors() (int, error) {
+	if glove.Vectors == nil {
+		return 0, nil
+	}
+	dimension := glove.Vectors.Dimension()
+
+	// the sentences that have a vector already
+	has_vector := make(map[gocql.UUID]bool, 0)
+	iter := db.Cassandra.Session.Query(db.Cassandra.SelectPaginated("sentence_vector", []string{"id", "vector"}, nil, "", nil, 0)).Iter()
+	var id gocql.UUID
+	var vector_str string
+	for iter.Scan(&id, &vector_str) {
+		vector, err := decodeVector(vector_str)
+		if err == nil && len(vector) == dimension {
+			has_vector[id] = true
+		}
+	}
+	err := iter.Close()
+	if err != nil { return 0, err }
+
+	// and those that don't
+	count := 0
+	iter = db.Cassandra.Session.Query(db.Cassandra.SelectPaginated("sentence_by_id", []string{"id", "topic", "json_data"}, nil, "", nil, 0)).Iter()
+	var topic, json_data string
+	for iter.Scan(&id, &topic, &json_data) {
+		if has_vector[id] {
+			continue
+		}
+		var sentence model.Sentence
+		if json.Unmarshal([]byte(json_data), &sentence) != nil {
+			continue
+		}
+		sentence.Id = id
+		err = saveSentenceVectors(topic, []model.Sentence{sentence})
+		if err != nil {
+			iter.Close()
+			return count, err
+		}
+		count += 1
+	}
+	return count, iter.Close()
+}
+
+// remove the vector of a sentence from a topic
+func removeSentenceVector(sentence_id gocql.UUID, topic string) error {
+	where_map := make(map[string]interface{})
+	where_map["topic"] = topic
+	where_map["id"] = sentence_id
+	err := db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("sentence_vector", where_map))
+	if err != nil { return err }
+	if index := cachedSentenceIndex(topic); index != nil {
+		index.Remove(sentence_id.String())
+	}
+	return nil
+}
+
+// the index of a topic if it's loaded for the current word vectors, otherwise nil
+func cachedSentenceIndex(topic string) *glove.VectorIndex {
+	sentenceIndexMutex.Lock()
+	defer sentenceIndexMutex.Unlock()
+	if item, ok := sentenceIndexes[topic]; ok && item.vectors == glove.Vectors {
+		return item.index
+	}
+	return nil
+}
+
+// the index of the sentence vectors of a topic, read from the db if it isn't loaded or is due a refresh
+func getSentenceIndex(topic string) (*glove.VectorIndex, error) {
+	now := time.Now()
+	sentenceIndexMutex.Lock()
+	if now.Sub(sentenceIndexLastSweep) > SentenceIndexRefresh {
+		sentenceIndexLastSweep = now
+		for name, item := range sentenceIndexes {
+			if now.Sub(item.last_used) > SentenceIndexTimeout {
+				delete(sentenceIndexes, name)
+			}
+		}
+	}
+	item, ok := sentenceIndexes[topic]
+	if ok && item.vectors == glove.Vectors && now.Sub(item.loaded) < SentenceIndexRefresh {
+		item.last_used = now
+		sentenceIndexMutex.Unlock()
+		return item.index, nil
+	}
+	sentenceIndexMutex.Unlock()
+
+	// read outside the lock, other topics don't have to wait
+	vectors := glove.Vectors
+	index, err := readSentenceIndex(topic, vectors)
+	if err != nil { return nil, err }
+	sentenceIndexMutex.Lock()
+	sentenceIndexes[topic] = &sentenceIndex{index: index, vectors: vectors, loaded: now, last_used: now}
+	sentenceIndexMutex.Unlock()
+	return index, nil
+}
+
+// read all the sentence vectors of a topic into a new index
+func readSentenceIndex(topic string, vectors *glove.MapSystem) (*glove.VectorIndex, error) {
+	columns := []string{"id", "vector"}
+	where_map := make(map[string]interface{})
+	where_map["topic"] = topic
+	select_str := db.Cassandra.SelectPaginated("sentence_vector", columns, where_map, "", nil, 0)
+	iter := db.Cassandra.Session.Query(select_str).Iter()
+
+	key_list := make([]string, 0)
+	vector_list := make([][]float32, 0)
+	var id gocql.UUID
+	var vector_str string
+	for iter.Scan(&id, &vector_str) {
+		vector, err := decodeVector(vector_str)
+		if err != nil { continue }
+		key_list = append(key_list, id.String())
+		vector_list = append(vector_list, vector)
+	}
+	err := iter.Close()
+	if err != nil { return nil, err }
+
+	index := glove.NewVectorIndex(vectors.Dimension(), len(key_list), glove.DefaultIndexOptions)
+	for i, key := range key_list {
+		index.Add(key, vector_list[i])
+	}
+	return index, nil
+}
+
+// find the sentences of a topic closest in meaning to a set of tokens, the most similar first
+// returns the sentences and their similarities, nothing if there are no word vectors
+func FindSimilarSentences(token_list []model.Token, topic string) ([]model.Sentence, []float64, error) {
+	sentence_list := make([]model.Sentence, 0)
+	score_list := make([]float64, 0)
+	query := sentenceVector(token_list)
+	if query == nil {
+		return sentence_list, score_list, nil
+	}
+
+	// the closest sentence vectors of the topic, a few spare in case a text is gone
+	index, err := getSentenceIndex(topic)
+	if err != nil { return nil, nil, err }
+	key_list, candidate_score_list := index.Nearest(query, 2 * MaxSimilarSentences, SimilarityThreshold)
+	candidate_list := make([]model.Sentence, 0)
+	for _, key := range key_list {
+		id, err := gocql.ParseUUID(key)
+		if err != nil { return nil, nil, err }
+		candidate_list = append(candidate_list, model.Sentence{Id: id})
+	}
+
+	// the text of the best matches
+	for i, candidate := range candidate_list {
+		if len(sentence_list) >= MaxSimilarSentences {
+			break
+		}
+		sentence, err := GetText(&candidate.Id)
+		if err == nil && sentence != nil && len(sentence.TokenList) > 0 {
+			sentence_list = append(sentence_list, *sentence)
+			score_list = append(score_list, candidate_score_list[i])
+		}
+	}
+	return sentence_list, score_list, nil
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/gocql/gocql"
 	"k-ai/util"
 	"k-ai/db"
+	"k-ai/nlu/model"
+	"encoding/json"
 	"errors"
 	"strings"
 )
@@ -52,6 +54,8 @@ func (session *Session) Delete() error {
 	value_map := make(map[string]interface{})
 	value_map["session"] = session.Session
 
+	err := db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("aiml_state", value_map))
+	if err != nil { return err }
 	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("session", value_map))
 }
 
@@ -85,6 +89,46 @@ func (session Session) GetUserName() string {
 	return strings.TrimSpace(session.First_name + " " + session.Surname)
 }
 
+// the AIML conversation of the session, empty if it hasn't started
+func (session *Session) GetAimlState() (*model.AimlState, error) {
+	if util.IsEmpty(&session.Session) {
+		return nil, errors.New("Session.GetAimlState() invalid parameters")
+	}
+	state := model.AimlState{Predicates: make(map[string]string, 0)}
+
+	where_map := make(map[string]interface{})
+	where_map["session"] = session.Session
+	cql_str := db.Cassandra.SelectPaginated("aiml_state", []string{"state"}, where_map, "", 0, 1)
+	iter := db.Cassandra.Session.Query(cql_str).Iter()
+
+	var state_str string
+	if iter.Scan(&state_str) {
+		err := json.Unmarshal([]byte(state_str), &state)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		if state.Predicates == nil {
+			state.Predicates = make(map[string]string, 0)
+		}
+	}
+	return &state, iter.Close()
+}
+
+// save the AIML conversation of the session
+func (session *Session) SaveAimlState(state *model.AimlState) error {
+	if util.IsEmpty(&session.Session) || state == nil {
+		return errors.New("Session.SaveAimlState() invalid parameters")
+	}
+	state_bytes, err := json.Marshal(state)
+	if err != nil { return err }
+
+	value_map := make(map[string]interface{})
+	value_map["session"] = session.Session
+	value_map["state"] = string(state_bytes)
+	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("aiml_state", value_map))
+}
+
 // validate a session object and return it if valid
 func ValidateSession(session string) (*Session, error) {
 	sid, err := gocql.ParseUUID(session)
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package db_model
+
+import (
+	"errors"
+	"k-ai/db"
+	"k-ai/logger"
+)
+
+// create table if not exists <ks>.statistics (
+//    name text, value counter,
+//    primary key(name)
+// );
+//
+// The size of the system is kept in counters, changed as rows are added to and removed from the tables
+// counted, so nothing needs counting when it's asked for.  A counter that doesn't exist yet (e.g. the
+// statistics table is new) is counted once at startup by scanning its table (see InitStatistics).
+//
+// Users, factoids, topics and kb entries are inserted and deleted with lightweight transactions, so a row
+// is counted once however many save it at the same time.  The word index is too busy for that: its entries
+// (a word of a sentence in a topic) are counted as they're written and removed, an estimate that counts a
+// sentence indexed twice twice.
+
+// the statistics, and the tables they count
+const (
+	StatUsers        = "users"
+	StatFactoids     = "factoids"
+	StatTopics       = "topics"
+	StatKBEntries    = "kb_entries"
+	StatIndexEntries = "index_entries"
+)
+
+var statisticTables = map[string]string{StatUsers: "user", StatFactoids: "sentence_by_id", StatTopics: "topic",
+	StatKBEntries: "knowledge_base", StatIndexEntries: "word_index"}
+
+// the size of the system
+type SystemStatistics struct {
+	Users        int64 `json:"users"`         // registered users
+	Factoids     int64 `json:"factoids"`      // sentences taught
+	Topics       int64 `json:"topics"`
+	KBEntries    int64 `json:"kb_entries"`    // entries of all knowledge bases
+	IndexEntries int64 `json:"index_entries"` // entries of the word index, a word of a sentence in a topic (an estimate)
+}
+
+// count the rows of a table, cassandra scans the table (or partition) to do so
+func countRows(cf string, where_map map[string]interface{}) (int64, error) {
+	cql_str := db.Cassandra.SelectPaginated(cf, []string{"count(*)"}, where_map, "", 0, 0)
+	var count int64
+	err := db.Cassandra.Session.Query(cql_str).Scan(&count)
+	return count, err
+}
+
+// insert (or update) a row, counting it in a statistic if it is new
+func insertCounted(cf string, value_map map[string]interface{}, name string) error {
+	insert_str := db.Cassandra.Insert(cf, value_map)
+	applied, err := db.Cassandra.ExecuteConditional(db.Cassandra.Conditional(insert_str, "IF NOT EXISTS"))
+	if err != nil { return err }
+	if applied {
+		countStatistic(name, 1)
+		return nil
+	}
+	return db.Cassandra.ExecuteWithRetry(insert_str) // it exists, update it
+}
+
+// delete a row, uncounting it in a statistic if it existed
+func deleteCounted(cf string, where_map map[string]interface{}, name string) error {
+	applied, err := db.Cassandra.ExecuteConditional(db.Cassandra.Conditional(db.Cassandra.Delete(cf, where_map), "IF EXISTS"))
+	if err != nil { return err }
+	if applied {
+		countStatistic(name, -1)
+	}
+	return nil
+}
+
+// add delta to a statistic
+// a counter update can't be retried (it might count twice), a failure is logged, the row is written already
+func countStatistic(name string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	where_map := make(map[string]interface{})
+	where_map["name"] = name
+	err := db.Cassandra.Session.Query(db.Cassandra.Increment("statistics", "value", delta, where_map)).Exec()
+	if err != nil {
+		logger.Log.Error("statistics: counting %s: %s", name, err.Error())
+	}
+}
+
+// the value of each statistic that exists
+func readStatistics() (map[string]int64, error) {
+	value_map := make(map[string]int64, 0)
+	cql_str := db.Cassandra.SelectPaginated("statistics", []string{"name", "value"}, nil, "", 0, 0)
+	iter := db.Cassandra.Session.Query(cql_str).Iter()
+	var name string
+	var value int64
+	for iter.Scan(&name, &value) {
+		value_map[name] = value
+	}
+	return value_map, iter.Close()
+}
+
+// count the tables of the statistics that don't exist yet, once
+// instances started at the same time for the first time can both count, start one first
+func InitStatistics() error {
+	value_map, err := readStatistics()
+	if err != nil { return err }
+	for name, cf := range statisticTables {
+		if _, ok := value_map[name]; !ok {
+			count, err := countRows(cf, nil)
+			if err != nil { return err }
+			where_map := make(map[string]interface{})
+			where_map["name"] = name
+			err = db.Cassandra.Session.Query(db.Cassandra.Increment("statistics", "value", count, where_map)).Exec()
+			if err != nil { return err }
+			logger.Log.Info("statistics: counted %d %s", count, name)
+		}
+	}
+	return nil
+}
+
+// the users, factoids, topics, kb entries and index entries of the system
+func GetSystemStatistics() (*SystemStatistics, error) {
+	value_map, err := readStatistics()
+	if err != nil { return nil, err }
+	return &SystemStatistics{Users: value_map[StatUsers], Factoids: value_map[StatFactoids], Topics: value_map[StatTopics],
+		KBEntries: value_map[StatKBEntries], IndexEntries: value_map[StatIndexEntries]}, nil
+}
+
+// the number of entries of a knowledge base, counted in its partition
+func CountKBEntries(topic string) (int64, error) {
+	if len(topic) == 0 {
+		return 0, errors.New("CountKBEntries() invalid parameter")
+	}
+	where_map := make(map[string]interface{})
+	where_map["topic"] = topic
+	return countRows("knowledge_base", where_map)
+}
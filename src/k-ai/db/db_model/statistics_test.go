@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package db_model
+
+import (
+	"k-ai/db"
+	"testing"
+	"github.com/gocql/gocql"
+	"k-ai/util_ut"
+)
+
+// count the kb entries and the size of the system
+func TestStatistics1(t *testing.T) {
+	// init cassandra
+	db.DropKeyspace("localhost", "kai_ai_test")
+	db.Cassandra.InitCassandraConnection("localhost", "kai_ai_test", 1)
+
+	for i := 0; i < 5; i++ {
+		e1 := KBEntry{Id: gocql.TimeUUID(), Json_data: "{}", Topic: "bank"}
+		util_ut.Check(t, e1.Save())
+	}
+	e2 := KBEntry{Id: gocql.TimeUUID(), Json_data: "{}", Topic: "shop"}
+	util_ut.Check(t, e2.Save())
+
+	count, err := CountKBEntries("bank")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, count == 5)
+	count, err = CountKBEntries("nothing")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, count == 0)
+
+	stats, err := GetSystemStatistics()
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, stats.KBEntries == 6)
+	util_ut.IsTrue(t, stats.Users == 0 && stats.Factoids == 0)
+
+	// saving an entry again doesn't count it twice, deleting it uncounts it
+	util_ut.Check(t, e2.Save())
+	util_ut.Check(t, e2.Delete())
+	util_ut.Check(t, e2.Delete())
+	stats, err = GetSystemStatistics()
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, stats.KBEntries == 5)
+
+	db.DropKeyspace("localhost", "kai_ai_test")
+}
@@ -115,7 +115,7 @@ func SaveTopic(topic string, body string, sentence_list []model.Sentence) error
 	err := SaveText(sentence_list, topic)  // save the sentences themselves
 	if err != nil { return err }
 
-	err = db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("topic", value_map))
+	err = insertCounted("topic", value_map, StatTopics)
 	if err != nil { return err }
 
 	err = indexTopic(topic, sentence_list)
@@ -163,7 +163,7 @@ func DeleteTopic(topic string) error {
 	where_map := make(map[string]interface{})
 	where_map["topic"] = topic
 
-	err := db.Cassandra.ExecuteWithRetry(db.Cassandra.Delete("topic", where_map))
+	err := deleteCounted("topic", where_map, StatTopics)
 	if err != nil { return err }
 
 	// get the unindexes for further sentence removal
@@ -41,7 +41,7 @@ func (user *User) Save() error {
 	value_map["salt"] = user.Salt
 	value_map["password_hash"] = user.Password_hash
 
-	return db.Cassandra.ExecuteWithRetry(db.Cassandra.Insert("user", value_map))
+	return insertCounted("user", value_map, StatUsers)
 }
 
 // load a KB item from db
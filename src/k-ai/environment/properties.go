@@ -38,6 +38,20 @@ type Config struct {
 
 	// spacy
 	SpacyEndpoint string
+
+	// the users (email addresses) allowed to change the lexicon itself and the aiml
+	Administrators []string
+
+	// the name of this instance, unique among the instances sharing the db, the host name when empty
+	InstanceName string
+
+	// seconds between checks for lexicon and aiml changes made by other instances (0: don't check)
+	LexiconUpdateInterval int
+
+	// word vectors (glove, fastText .vec, word2vec .bin or a mapped .kvec), none when empty
+	WordVectorFile string
+	WordVectorFormat string  // the format of the file, by its extension when empty
+	WordVectorMaxWords int   // the number of (most frequent) words loaded, 0 for all
 }
 
 // Reads info from config file
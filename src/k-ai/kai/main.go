@@ -20,6 +20,12 @@ import (
 	"k-ai/nlu/aiml"
 	"k-ai/environment"
 	"k-ai/db/freebase"
+	"k-ai/db/db_model"
+	"time"
+	"path/filepath"
+	"k-ai/util"
+	"k-ai/nlu/glove"
+	"k-ai/service_layer"
 )
 
 
@@ -37,8 +43,52 @@ func main() {
 	logger.Log.Info(fmt.Sprintf("connecting to Cassandra %s @ %s", env.Keyspace, env.CassandraServer))
 	db.Cassandra.InitCassandraConnection(env.CassandraServer, env.Keyspace, env.ReplicationFactor)
 
+	// count what the statistics don't count yet
+	err := db_model.InitStatistics()
+	if err != nil {
+		logger.Log.Error("Error counting statistics %s", err.Error())
+		return
+	}
+
+	// bring the lexicon up to date and keep it in sync with the other instances
+	if len(env.InstanceName) > 0 {
+		db_model.LexiconInstance = env.InstanceName
+	}
+	err = db_model.StartLexiconUpdates(time.Duration(env.LexiconUpdateInterval) * time.Second)
+	if err != nil {
+		logger.Log.Error("Error applying lexicon updates %s", err.Error())
+		return
+	}
+
+	// word vectors, only when configured
+	if len(env.WordVectorFile) > 0 {
+		filename := env.WordVectorFile
+		if !filepath.IsAbs(filename) {
+			filename = util.GetDataPath() + "/" + filename
+		}
+		format := env.WordVectorFormat
+		if len(format) == 0 {
+			format = glove.FormatOf(filename)
+		}
+		glove.Vectors, err = glove.LoadVectors(filename, format, env.WordVectorMaxWords)
+		if err != nil {
+			logger.Log.Error("Error loading word vectors %s", err.Error())
+			return
+		}
+
+		// the factoids taught without these vectors can now be found by meaning too
+		go func() {
+			count, err := db_model.BackfillSentenceVectors()
+			if err != nil {
+				logger.Log.Error("Error saving sentence vectors %s", err.Error())
+			} else if count > 0 {
+				logger.Log.Info("saved the sentence vectors of %d factoids", count)
+			}
+		}()
+	}
+
 	logger.Log.Info("Setting up Freebase Match System")
-	err := freebase.MatchSystem.Setup()
+	err = freebase.MatchSystem.Setup()
 	if err != nil {
 		logger.Log.Error("Error connecting to Spacy %s", err.Error())
 		return
@@ -47,14 +97,20 @@ func main() {
 	// test spacy is up
 	logger.Log.Info(fmt.Sprintf("connecting to Spacy @ %s", env.SpacyEndpoint))
 	parser.SpacyEndpoint = env.SpacyEndpoint
+	service_layer.Administrators = env.Administrators
 	sl, err := parser.ParseText("Test text.")
 	if err != nil {
 		logger.Log.Error("Error connecting to Spacy %s", err.Error())
 	} else if len(sl) != 1 || len(sl[0].TokenList) != 3 {
 		logger.Log.Error("Error Spacy parser interface not working")
 	} else {
-		// setup db schema for aiml
-		aiml.Aiml.SetupDbSchema()
+		// aiml categories from the db (seeded from the files the first time), and the db schema patterns
+		err = aiml.Aiml.SetupDb()
+		if err != nil {
+			logger.Log.Error("Error loading aiml from the db %s", err.Error())
+		}
+		// and keep them in sync with the changes of the other instances
+		aiml.Aiml.StartReloads(time.Duration(env.LexiconUpdateInterval) * time.Second)
 
 		//// test freebase
 		//sentence_list, err := parser.ParseText("what recordings did bastard souls make?")
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"time"
+	"k-ai/util"
+	"k-ai/nlu/lexicon"
+)
+
+//
+// compile the lexicon's text files into its binary snapshot (see nlu/lexicon/snapshot.go)
+//
+// the lexicon does this by itself when its snapshot is missing or out of date, this is for
+// build and deployment steps that want the snapshot ready before the first process starts
+//
+func main() {
+	data_dir := flag.String("data", util.GetDataPath(), "the data directory holding the lexicon")
+	flag.Parse()
+
+	start := time.Now()
+	err := lexicon.CompileSnapshot(*data_dir)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("lexicon snapshot compiled in %v\n", time.Since(start))
+}
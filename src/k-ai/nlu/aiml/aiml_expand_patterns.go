@@ -24,26 +24,10 @@ import (
  * @param origin the origin of this aiml pattern (whence it came)
  * @param aimlTemplateList the list of templates to associate with this pattern
  */
-func (mgr *AimlManager) AddPattern(patternList []string, origin string, templateList []string) {
-	for _, pattern1 := range patternList {
-		expandedPattern := expandBrackets(pattern1)
-		for _, pattern := range expandedPattern {
-			tokenList := tokenizer.FilterOutPunctuation(tokenizer.FilterOutSpaces(tokenizer.Tokenize(pattern)))
-			if len(tokenList) > 1 { // must at least have two items in a pattern
-				t_token := tokenList[0];
-				key := strings.ToLower(t_token.Text)
-				if key == "*" {
-					panic("error: pattern cannot start with *");
-				}
-				root, ok := mgr.NodeSet[key];
-				if !ok {
-					root = &model.Aiml{Text: key, Origin: origin, NodeSet: make(map[string]*model.Aiml,0)}
-					mgr.NodeSet[key] = root;
-				}
-				addPatternHelper(root, origin, 1, tokenList, templateList);
-			}
-		}
-	}
+func (mgr *AimlManager) AddPattern(patternList []string, origin string, templateList []model.AimlTemplate) {
+	mgr.Lock()
+	defer mgr.Unlock()
+	mgr.snapshot.Store(mgr.patterns().changePatterns(patternList, origin, addTemplates(templateList)))
 }
 
 /**
@@ -151,7 +135,7 @@ func finish(builder []string, sb string) ([]string, string) {
  * @param tokenList the list of token making up the pattern
  * @param templateList the list of template to be added to the last node
  */
-func addPatternHelper( nodeSet *model.Aiml, origin string, index int, tokenList []model.Token, templateList []string ) {
+func addPatternHelper( nodeSet *model.Aiml, origin string, index int, tokenList []model.Token, templateList []model.AimlTemplate ) {
 	if index + 1 == len(tokenList) { // last item insert
 		// last node
 		t_token := tokenList[index]
@@ -159,7 +143,7 @@ func addPatternHelper( nodeSet *model.Aiml, origin string, index int, tokenList
 		template, ok := nodeSet.NodeSet[key];
 		if !ok { // new item
 			template = &model.Aiml{Text: key, Origin: origin, NodeSet: make(map[string]*model.Aiml,0)}
-			template.TemplateList = make([]string,0)
+			template.TemplateList = make([]model.AimlTemplate,0)
 			for _, item := range templateList {
 				template.TemplateList = append(template.TemplateList, item)
 			}
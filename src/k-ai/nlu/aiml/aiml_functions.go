@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package aiml
+
+import (
+	"sync"
+	"time"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"k-ai/logger"
+	"k-ai/nlu/model"
+)
+
+//
+// AIML template functions
+//
+// {name} or {name:arguments} in an answer is replaced by the result of the template function
+// registered as name, e.g. {year}, {date:+3d}, {stats:factoids}, {kb_count:bank}.  Any package
+// can add its own with RegisterFunction.  Unknown names are left as they are, as is a function
+// that fails (its error is logged).
+//
+// built in:
+//   {year} {month} {day} {time}   now
+//   {date}, {date:+3d}            the date now, or offset by a number of h(ours), d(ays) or w(eeks)
+//   {email} {name} {fullname}     about the user
+//   {star}, {star:n}              the text bound to the first / n-th wildcard of the pattern
+//   {stats}, {stats:what}         system statistics (see aiml_statistics.go)
+//   {kb_count:kb}                 the number of entries of a knowledge base
+//
+
+// the context a template function is called in
+type FunctionContext struct {
+	Binding model.AimlBinding  // the pattern matched
+	Email   string             // the user's
+}
+
+// a template function: its arguments ("" if none) and context -> the text replacing it
+type TemplateFunction func(arguments string, context FunctionContext) (string, error)
+
+// {} values that aren't functions but special ops (see PerformSpecialOps)
+var specialOpList = []string{"search"}
+
+// {name} or {name:arguments} in a template
+var magicValuePattern = regexp.MustCompile(`\{([a-zA-Z_]+)(:[^{}]*)?\}`)
+
+// a valid function name
+var validFunctionName = regexp.MustCompile(`^[a-z_]+$`)
+
+// the registered functions by name
+var functionMap = make(map[string]TemplateFunction, 0)
+var functionLock sync.RWMutex
+
+// register a template function as {name}, names are lower case letters and _
+func RegisterFunction(name string, function TemplateFunction) error {
+	if !validFunctionName.MatchString(name) || function == nil {
+		return errors.New("RegisterFunction() invalid parameter(s)")
+	}
+	functionLock.Lock()
+	defer functionLock.Unlock()
+	if _, ok := functionMap[name]; ok {
+		return errors.New("template function {" + name + "} already registered")
+	}
+	functionMap[name] = function
+	return nil
+}
+
+// the function registered as name
+func getFunction(name string) (TemplateFunction, bool) {
+	functionLock.RLock()
+	defer functionLock.RUnlock()
+	function, ok := functionMap[name]
+	return function, ok
+}
+
+// is name a template function or special op?
+func isMagicValue(name string) bool {
+	for _, special_op := range specialOpList {
+		if special_op == name {
+			return true
+		}
+	}
+	_, ok := getFunction(name)
+	return ok
+}
+
+// replace the {} template functions of a text by their results
+func replaceFunctions(text string, context FunctionContext) string {
+	return magicValuePattern.ReplaceAllStringFunc(text, func(match string) string {
+		part_list := magicValuePattern.FindStringSubmatch(match)
+		function, ok := getFunction(strings.ToLower(part_list[1]))
+		if !ok {
+			return match
+		}
+		result, err := function(strings.TrimSpace(strings.TrimPrefix(part_list[2], ":")), context)
+		if err != nil {
+			logger.Log.Error("aiml: %s: %s", match, err.Error())
+			return match
+		}
+		return result
+	})
+}
+
+// a time offset such as +3d, -1w or +12h
+func parseOffset(offset string) (time.Duration, error) {
+	if len(offset) < 2 {
+		return 0, errors.New("invalid offset \"" + offset + "\", expected e.g. +3d")
+	}
+	unit := time.Duration(0)
+	switch offset[len(offset) - 1] {
+	case 'h':
+		unit = time.Hour
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	default:
+		return 0, errors.New("invalid offset \"" + offset + "\", the unit must be h, d or w")
+	}
+	value, err := strconv.Atoi(strings.TrimPrefix(offset[:len(offset) - 1], "+"))
+	if err != nil {
+		return 0, errors.New("invalid offset \"" + offset + "\", expected e.g. +3d")
+	}
+	return time.Duration(value) * unit, nil
+}
+
+// {date}, {date:offset}
+func dateFunction(arguments string, context FunctionContext) (string, error) {
+	now := time.Now()
+	if len(arguments) > 0 {
+		offset, err := parseOffset(arguments)
+		if err != nil { return "", err }
+		now = now.Add(offset)
+	}
+	return now.Format(time.RFC850), nil
+}
+
+// {star}, {star:index}
+func starFunction(arguments string, context FunctionContext) (string, error) {
+	index := 1
+	if len(arguments) > 0 {
+		value, err := strconv.Atoi(arguments)
+		if err != nil || value < 1 {
+			return "", errors.New("invalid star index \"" + arguments + "\"")
+		}
+		index = value
+	}
+	return starText(context.Binding, index), nil
+}
+
+func init() {
+	RegisterFunction("year", func(arguments string, context FunctionContext) (string, error) {
+		return strconv.Itoa(time.Now().Year()), nil
+	})
+	RegisterFunction("month", func(arguments string, context FunctionContext) (string, error) {
+		return time.Now().Month().String(), nil
+	})
+	RegisterFunction("day", func(arguments string, context FunctionContext) (string, error) {
+		return time.Now().Weekday().String(), nil
+	})
+	RegisterFunction("time", func(arguments string, context FunctionContext) (string, error) {
+		return time.Now().Format(time.Kitchen), nil
+	})
+	RegisterFunction("date", dateFunction)
+	RegisterFunction("email", func(arguments string, context FunctionContext) (string, error) {
+		return "your email address is " + context.Email, nil
+	})
+	name_function := func(arguments string, context FunctionContext) (string, error) {
+		return "I can't tell you your name but your email address is " + context.Email, nil
+	}
+	RegisterFunction("name", name_function)
+	RegisterFunction("fullname", name_function)
+	RegisterFunction("star", starFunction)
+}
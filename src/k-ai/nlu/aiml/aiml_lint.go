@@ -0,0 +1,350 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package aiml
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"sort"
+	"errors"
+	"strings"
+	"encoding/xml"
+	"k-ai/nlu/model"
+	"k-ai/db/db_model"
+	"k-ai/nlu/tokenizer"
+)
+
+//
+// AIML lint
+//
+// All categories end up in one tree of patterns, so a mistake in one module quietly changes
+// the answers of another.  Lint reports:
+//   errors:   xml that doesn't parse, unbalanced or nested brackets in a pattern, templates
+//             that don't parse
+//   warnings: patterns defined more than once (in the same or in another module: their
+//             templates are merged), patterns that are too short to be added, patterns that
+//             can never be the best match because a pattern with precedence matches all they
+//             match (shadowed), categories none of whose patterns can match (unreachable),
+//             unknown {} template functions and unknown template tags
+//
+// The categories of the db and the patterns of the kb schemas can be linted together the same way
+// (LintDb), their issues are reported by "aiml_category <module>/<id>" and "kb_schema <name>/<field>".
+//
+
+// the severities of lint issues
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// a problem found by lint
+type LintIssue struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (issue LintIssue) String() string {
+	if issue.Line == 0 {  // not in a file
+		return fmt.Sprintf("%s: %s: %s", issue.File, issue.Severity, issue.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", issue.File, issue.Line, issue.Severity, issue.Message)
+}
+
+// the template tags evaluated (see aiml_template.go)
+var knownTemplateTags = map[string]bool{"srai": true, "sr": true, "star": true, "random": true, "li": true,
+	"set": true, "get": true, "think": true}
+
+// a category and whence it came
+type lintCategory struct {
+	category model.AimlCategory
+	file     string
+	line     int
+}
+
+// where a category is, for messages
+func (c lintCategory) position() string {
+	if c.line == 0 {
+		return c.file
+	}
+	return fmt.Sprintf("%s:%d", c.file, c.line)
+}
+
+// lint a set of AIML files together, the issues ordered by file and line
+func LintFiles(file_list []string) []LintIssue {
+	issue_list := make([]LintIssue, 0)
+	category_list := make([]lintCategory, 0)
+	for _, filename := range file_list {
+		file_category_list, file_issue_list := readLintCategories(filename)
+		category_list = append(category_list, file_category_list...)
+		issue_list = append(issue_list, file_issue_list...)
+	}
+	issue_list = append(issue_list, lintCategories(category_list)...)
+	sort.SliceStable(issue_list, func(i, j int) bool {
+		if issue_list[i].File != issue_list[j].File {
+			return issue_list[i].File < issue_list[j].File
+		}
+		return issue_list[i].Line < issue_list[j].Line
+	})
+	return issue_list
+}
+
+// lint the categories of the db together with the patterns of the kb schemas, the issues ordered by where they are
+func LintDb(category_list []model.AimlCategory, schema_list []db_model.KBSchema) []LintIssue {
+	lint_list := make([]lintCategory, 0)
+	for _, category := range category_list {
+		lint_list = append(lint_list, lintCategory{file: "aiml_category " + category.Module + "/" + category.Id.String(),
+			category: category})
+	}
+	for _, schema := range schema_list {
+		for _, field := range schema.Field_list {
+			for _, sp := range schemaPatterns(db_model.KBSchema{Name: schema.Name, Field_list: []db_model.KBSchemaField{field}}) {
+				lint_list = append(lint_list, lintCategory{file: "kb_schema " + schema.Name + "/" + field.Name,
+					category: model.AimlCategory{Module: schema.Name, PatternList: sp.pattern_list, Template: sp.template.Text}})
+			}
+		}
+	}
+	issue_list := lintCategories(lint_list)
+	sort.SliceStable(issue_list, func(i, j int) bool { return issue_list[i].File < issue_list[j].File })
+	return issue_list
+}
+
+// read the categories of a file with their line numbers
+func readLintCategories(filename string) ([]lintCategory, []LintIssue) {
+	category_list := make([]lintCategory, 0)
+	issue_list := make([]LintIssue, 0)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return category_list, append(issue_list, LintIssue{File: filename, Severity: LintError, Message: err.Error()})
+	}
+	defer file.Close()
+
+	module := moduleOf(filename)
+	decoder := xml.NewDecoder(file)
+	topic := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			line, _ := decoder.InputPos()
+			if syntax_err, ok := err.(*xml.SyntaxError); ok {
+				line = syntax_err.Line
+			}
+			return category_list, append(issue_list, LintIssue{File: filename, Line: line, Severity: LintError,
+				Message: err.Error() + ", the rest of the file is ignored"})
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "topic" {
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "name" {
+						topic = attr.Value
+					}
+				}
+			} else if t.Name.Local == "category" {
+				line, _ := decoder.InputPos()
+				var cat Category
+				err = decoder.DecodeElement(&cat, &t)
+				if err != nil {
+					if syntax_err, ok := err.(*xml.SyntaxError); ok {
+						line = syntax_err.Line
+					}
+					return category_list, append(issue_list, LintIssue{File: filename, Line: line, Severity: LintError,
+						Message: err.Error() + ", the rest of the file is ignored"})
+				}
+				if len(cat.Topic) == 0 {
+					cat.Topic = topic
+				}
+				category_list = append(category_list, lintCategory{file: filename, line: line,
+					category: model.AimlCategory{Module: module, PatternList: cat.PatternList,
+						That: strings.TrimSpace(cat.That), Topic: strings.TrimSpace(cat.Topic),
+						Template: strings.TrimSpace(cat.Template.Xml)}})
+			}
+		case xml.EndElement:
+			if t.Name.Local == "topic" {
+				topic = ""
+			}
+		}
+	}
+	return category_list, issue_list
+}
+
+// check the brackets of a pattern, (a|b|) can't be nested
+func checkBrackets(pattern string) error {
+	depth := 0
+	for _, ch := range pattern {
+		switch ch {
+		case '(':
+			depth += 1
+			if depth > 1 {
+				return errors.New("nested brackets")
+			}
+		case ')':
+			depth -= 1
+			if depth < 0 {
+				return errors.New("unbalanced brackets, ) without (")
+			}
+		case '|':
+			if depth == 0 {
+				return errors.New("| outside brackets")
+			}
+		}
+	}
+	if depth != 0 {
+		return errors.New("unbalanced brackets, ( without )")
+	}
+	return nil
+}
+
+// lint the categories of all modules together
+func lintCategories(category_list []lintCategory) []LintIssue {
+	issue_list := make([]LintIssue, 0)
+	issue := func(c lintCategory, severity string, format string, args ...interface{}) {
+		issue_list = append(issue_list, LintIssue{File: c.file, Line: c.line, Severity: severity,
+			Message: fmt.Sprintf(format, args...)})
+	}
+
+	// the tree of all patterns that can be added, as the AimlManager builds it
+	patterns := newSnapshot()
+	pattern_map := make(map[*lintCategory][]string, 0)  // category -> its expanded patterns
+	first_map := make(map[string]lintCategory, 0)       // pattern, that and topic -> where first defined
+	for i := range category_list {
+		c := &category_list[i]
+		if len(c.category.PatternList) == 0 {
+			issue(*c, LintWarning, "unreachable category, it has no pattern")
+			continue
+		}
+		template_list, err := newTemplateList(c.category.Template, c.category.That, c.category.Topic)
+		if err != nil {
+			issue(*c, LintError, "invalid template: %s", err.Error())
+			continue
+		}
+		lintTemplate(*c, issue)
+
+		expanded_list := make([]string, 0)
+		for _, pattern := range c.category.PatternList {
+			if err := checkBrackets(pattern); err != nil {
+				issue(*c, LintError, "pattern \"%s\": %s", pattern, err.Error())
+				continue
+			}
+			for _, expanded := range expandBrackets(pattern) {
+				word_list := patternWords(expanded)
+				if len(word_list) < 2 {
+					issue(*c, LintWarning, "pattern \"%s\" is never added, a pattern needs at least two words", expanded)
+					continue
+				}
+				key := strings.Join(word_list, " ") + "|" + strings.Join(patternWords(c.category.That), " ") +
+					"|" + strings.Join(patternWords(c.category.Topic), " ")
+				if first, ok := first_map[key]; ok {
+					if first.file == c.file && first.line == c.line {
+						issue(*c, LintWarning, "pattern \"%s\" is in the category twice", expanded)
+					} else if first.category.Module == c.category.Module {
+						issue(*c, LintWarning, "duplicate pattern \"%s\", also at %s", expanded, first.position())
+					} else {
+						issue(*c, LintWarning, "pattern \"%s\" is also in module %s (%s), their templates are merged",
+							expanded, first.category.Module, first.position())
+					}
+					continue
+				}
+				first_map[key] = *c
+				expanded_list = append(expanded_list, expanded)
+				patterns.addPattern([]string{expanded}, moduleOrigin(c.category.Module), template_list)
+			}
+		}
+		pattern_map[c] = expanded_list
+	}
+
+	// is each pattern the best match for (an example of) what it matches?
+	mgr := &AimlManager{}
+	mgr.snapshot.Store(patterns)
+	for i := range category_list {
+		c := &category_list[i]
+		expanded_list, ok := pattern_map[c]
+		if !ok || len(expanded_list) == 0 {
+			continue
+		}
+		num_reachable := 0
+		for _, expanded := range expanded_list {
+			winner, input := mgr.lintBestMatch(expanded, c.category)
+			if winner == nil || winner.Pattern == strings.ToUpper(strings.Join(patternWords(expanded), " ")) {
+				num_reachable += 1
+			} else {
+				issue(*c, LintWarning, "pattern \"%s\" is shadowed by \"%s\" (%s), e.g. for \"%s\"", expanded,
+					winner.Pattern, winner.Origin, input)
+			}
+		}
+		if num_reachable == 0 {
+			issue(*c, LintWarning, "unreachable category, all its patterns are shadowed")
+		}
+	}
+	return issue_list
+}
+
+// the best match for an example input of a pattern in the conversation of its category
+// the example has a made up word for each wildcard that needs one
+func (mgr *AimlManager) lintBestMatch(pattern string, category model.AimlCategory) (*model.AimlBinding, string) {
+	example := func(pattern string) string {
+		word_list := make([]string, 0)
+		for i, word := range patternWords(pattern) {
+			if word == wildcardOneHigh || word == wildcardOneLow {
+				word_list = append(word_list, fmt.Sprintf("lintword%d", i))
+			} else if !isWildcard(word) {
+				word_list = append(word_list, word)
+			}
+		}
+		return strings.Join(word_list, " ")
+	}
+	input := example(pattern)
+	if len(input) == 0 {
+		return nil, input
+	}
+	state := &model.AimlState{That: example(category.That), Predicates: map[string]string{TopicPredicate: example(category.Topic)}}
+	binding_list := mgr.MatchTokenListInContext(tokenizer.Tokenize(input), state)
+	if len(binding_list) == 0 {
+		return nil, input
+	}
+	return &binding_list[0], input
+}
+
+// check the template functions and tags of a category's template
+func lintTemplate(c lintCategory, issue func(lintCategory, string, string, ...interface{})) {
+	for _, match := range magicValuePattern.FindAllStringSubmatch(c.category.Template, -1) {
+		if !isMagicValue(strings.ToLower(match[1])) {
+			issue(c, LintWarning, "unknown template function %s", match[0])
+		}
+	}
+	for _, alternative := range splitAlternatives(c.category.Template) {
+		node_list, err := parseTemplate(strings.TrimSpace(alternative))
+		if err != nil {
+			continue  // reported as an invalid template
+		}
+		for _, tag := range unknownTags(node_list) {
+			issue(c, LintWarning, "unknown template tag <%s>, only its contents are used", tag)
+		}
+	}
+}
+
+// the unknown tags of a template
+func unknownTags(node_list []*templateNode) []string {
+	tag_list := make([]string, 0)
+	for _, node := range node_list {
+		if len(node.name) > 0 && !knownTemplateTags[node.name] {
+			tag_list = append(tag_list, node.name)
+		}
+		tag_list = append(tag_list, unknownTags(node.node_list)...)
+	}
+	return tag_list
+}
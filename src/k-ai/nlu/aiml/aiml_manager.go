@@ -20,126 +20,265 @@ import (
 	"k-ai/util"
 	"k-ai/db/db_model"
 	"k-ai/logger"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 	"path"
 	"fmt"
+	"regexp"
+	"k-ai/nlu/tokenizer"
+	"github.com/gocql/gocql"
 )
 
 
 // the manager system
 type AimlManager struct {
-	NodeSet map[string]*model.Aiml
+	snapshot atomic.Value  // *aimlSnapshot, the patterns matched, replaced as a whole (see aiml_snapshot.go)
+	use_db   bool  // are the categories in the db (see SetupDb) rather than in the files?
+	change   gocql.UUID  // the latest change of the patterns in the db loaded (see db_model.SaveAimlChange)
 
-	sync.Mutex
+	sync.Mutex  // held while changing the patterns, matches don't need it
 }
 
+// nothing loaded
+var emptySnapshot = newSnapshot()
+
 
 // singleton access to the Grammar library system
 var Aiml AimlManager
 
-// read the AIML xml files from the system
-func (mgr *AimlManager) initFromFile() error {
-	if mgr.NodeSet == nil || len(mgr.NodeSet) == 0 {
-		mgr.NodeSet = make(map[string]*model.Aiml, 0)
+// module names: letters, digits, - and _
+var validModule = regexp.MustCompile(`^([a-z]|[0-9]|-|_)+$`)
 
-		// get the list of AI/ml files to load
-		// careful: won't work with   <?xml version="1.0" encoding="ISO-8859-1"?>
-		glob_str := util.GetDataPath() + "/aiml/*.aiml"
-		file_list, err := util.GetFilesInDirectory(glob_str)
-		if err != nil { return err }
-		logger.Log.Info(fmt.Sprintf("NLU: loading %s", glob_str))
-		for _, fileName := range file_list {
-			// read the xml file
-			base_filename := path.Base(fileName)
-			if strings.Contains(base_filename, ".") {
-				base_filename = strings.Split(base_filename, ".")[0]
-			}
-			if len(base_filename) == 0 || base_filename == ".." {
-				base_filename = "K/AI"
-			} else {
-				base_filename += " module"
+// the module of an AIML file, its name without extension
+func moduleOf(filename string) string {
+	base_filename := path.Base(filename)
+	if strings.Contains(base_filename, ".") {
+		base_filename = strings.Split(base_filename, ".")[0]
+	}
+	if base_filename == ".." {
+		base_filename = ""
+	}
+	return base_filename
+}
+
+// whence the answers of a module come
+func moduleOrigin(module string) string {
+	if len(module) == 0 {
+		return "K/AI"
+	}
+	return module + " module"
+}
+
+// read the categories of the AIML xml files in data/aiml, each file a module
+func ReadCategoryFiles() ([]model.AimlCategory, error) {
+	category_list := make([]model.AimlCategory, 0)
+
+	// get the list of AI/ml files to load
+	// careful: won't work with   <?xml version="1.0" encoding="ISO-8859-1"?>
+	glob_str := util.GetDataPath() + "/aiml/*.aiml"
+	file_list, err := util.GetFilesInDirectory(glob_str)
+	if err != nil { return nil, err }
+	logger.Log.Info(fmt.Sprintf("NLU: loading %s", glob_str))
+	for _, fileName := range file_list {
+		// read the xml file
+		xmlFile, err := ioutil.ReadFile(fileName)
+		if err != nil { return nil, err }
+
+		// xml to internal structure
+		var category Categories
+		err = xml.Unmarshal(xmlFile, &category)
+		if err != nil {
+			logger.Log.Error("NLU: %s: %s", fileName, err.Error())
+		}
+
+		module := moduleOf(fileName)
+		for _, cat := range category.CategoryList() {
+			if len(cat.PatternList) == 0 {
+				logger.Log.Error("NLU: %s: category without a pattern, ignored", fileName)
+				continue
 			}
-			xmlFile, err := ioutil.ReadFile(fileName)
-			if err != nil { return err }
+			category_list = append(category_list, model.AimlCategory{Id: gocql.TimeUUID(), Module: module,
+				PatternList: cat.PatternList, That: strings.TrimSpace(cat.That), Topic: strings.TrimSpace(cat.Topic),
+				Template: strings.TrimSpace(cat.Template.Xml)})
+		}
+	}
+	return category_list, nil
+}
 
-			// xml to internal structure
-			var category Categories
-			xml.Unmarshal(xmlFile, &category)
-
-			// go through each category in the file and expand into the node system
-			for _, cat := range category.Cats {
-				templateList := strings.Split(cat.Template, "|")
-				finalTemplateList := make([]string, 0)
-				for _, template := range templateList {
-					template := strings.TrimSpace(template)
-					if len(template) > 0 {
-						finalTemplateList = append(finalTemplateList, template)
-					}
-				}
-				mgr.AddPattern(cat.PatternList, base_filename, finalTemplateList)
+// check a category is fit to be added
+func ValidateCategory(category model.AimlCategory) error {
+	if !validModule.MatchString(category.Module) {
+		return errors.New("invalid module name, lower case letters, digits, - and _ only")
+	}
+	if len(category.PatternList) == 0 {
+		return errors.New("a category needs at least one pattern")
+	}
+	for _, pattern := range category.PatternList {
+		for _, expanded := range expandBrackets(pattern) {
+			tokenList := tokenizer.FilterOutPunctuation(tokenizer.FilterOutSpaces(tokenizer.Tokenize(expanded)))
+			if len(tokenList) < 2 {
+				return errors.New("pattern \"" + expanded + "\" too short, a pattern needs at least two words")
 			}
 		}
+	}
+	template_list, err := newTemplateList(category.Template, category.That, category.Topic)
+	if err != nil {
+		return errors.New("invalid template: " + err.Error())
+	}
+	if len(template_list) == 0 {
+		return errors.New("a category needs a template")
+	}
+	return nil
+}
+
+// the patterns matched right now, never changed: a change publishes a new snapshot
+func (mgr *AimlManager) patterns() *aimlSnapshot {
+	if snapshot, ok := mgr.snapshot.Load().(*aimlSnapshot); ok && snapshot != nil {
+		return snapshot
+	}
+	return emptySnapshot
+}
+
+// read the AIML xml files from the system, if nothing is loaded yet
+func (mgr *AimlManager) initFromFile() error {
+	mgr.Lock()
+	defer mgr.Unlock()
+	if len(mgr.patterns().root.NodeSet) == 0 {
+		category_list, err := ReadCategoryFiles()
+		if err != nil { return err }
+		snapshot := newSnapshot()
+		snapshot.addCategories(category_list)
+		mgr.snapshot.Store(snapshot)
 		logger.Log.Info("NLU: aiml loading done")
 	}
 	return nil
 }
 
-// read the AIML xml files from the db system, BUT ONLY AFTER the load from file above
-func (mgr *AimlManager) SetupDbSchema() error {
-	if mgr.NodeSet == nil || len(mgr.NodeSet) == 0 {
-		return errors.New("aiml not initialized")
+// use the AIML categories of the db from now on, so they can be changed (see service_layer/aiml.go)
+// the first time the db is seeded with the categories of the files
+func (mgr *AimlManager) SetupDb() error {
+	category_list, err := db_model.GetAimlCategoryList("")
+	if err != nil { return err }
+	if len(category_list) == 0 {
+		category_list, err = ReadCategoryFiles()
+		if err != nil { return err }
+		for _, category := range category_list {
+			err = db_model.SaveAimlCategory(category)
+			if err != nil { return err }
+		}
+		logger.Log.Info("NLU: aiml db seeded with %d categories", len(category_list))
+	}
+	mgr.Lock()
+	mgr.use_db = true
+	mgr.Unlock()
+	return mgr.Reload()
+}
+
+// reload the entire AIML system: the categories (from the db or the files) and the kb schema patterns
+// the new patterns are built on the side, matches use the old ones until they're swapped in
+func (mgr *AimlManager) Reload() error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	// the change first: one made while reading is picked up by the next reload
+	change, err := db_model.GetAimlChange()
+	if err != nil { return err }
+	var category_list []model.AimlCategory
+	if mgr.use_db {
+		category_list, err = db_model.GetAimlCategoryList("")
+	} else {
+		category_list, err = ReadCategoryFiles()
 	}
-	// get a list of all schema items
+	if err != nil { return err }
 	schema_list, err := db_model.GetSchemaList()
-	logger.Log.Info("NLU: loading schemas from db")
-	if err != nil {
-		return err
-	} else {
-		for _, schema_item := range schema_list {
-			for _, field := range schema_item.Field_list {
-				if len(field.Aiml) > 0 {
-					aiml_list := make([]string,0)
-					for _, aiml_str := range strings.Split(field.Aiml, "\n") {
-						aiml_str = strings.TrimSpace(aiml_str)
-						if len(aiml_str) > 0 {
-							aiml_list = append(aiml_list, aiml_str)
-						}
-					}
-					if len(aiml_list) > 0 {
-						template_list := make([]string, 0)
-						kbStr := "db_search:"+schema_item.Name+":"+field.Name
-						template_list = append(template_list, kbStr)
-						mgr.AddPattern(aiml_list, schema_item.Origin, template_list)
-					}
-				}
-			}
-		}
+	if err != nil { return err }
+
+	snapshot := newSnapshot()
+	snapshot.addCategories(category_list)
+	for _, schema_item := range schema_list {
+		snapshot.addSchema(schema_item)
 	}
-	logger.Log.Info("NLU: aiml db loading done")
+	mgr.snapshot.Store(snapshot)
+	mgr.change = change
+	logger.Log.Info("NLU: aiml reloaded %d categories and %d schemas", len(category_list), len(schema_list))
 	return nil
 }
 
-// todo: cleanup and fix
-// reload the entire AIML system - for now - incredibly badly written
-// lock is held open way too long - however - it'll do in the proto-type
-func (mgr *AimlManager) Reload() error {
+// reload if the patterns in the db changed since they were loaded, e.g. by another instance
+func (mgr *AimlManager) ReloadIfChanged() error {
+	change, err := db_model.GetAimlChange()
+	if err != nil { return err }
+	mgr.Lock()
+	loaded := mgr.change
+	mgr.Unlock()
+	if change == loaded {
+		return nil
+	}
+	return mgr.Reload()
+}
+
+// a change of the patterns made here (e.g. UpdateSchema) was recorded as change, latest being the change
+// before it: if latest was loaded, the patterns are up to date with change and aren't reloaded for it,
+// otherwise another instance changed them too and the next ReloadIfChanged reloads
+func (mgr *AimlManager) ChangeRecorded(latest gocql.UUID, change gocql.UUID) {
 	mgr.Lock()
 	defer mgr.Unlock()
+	if mgr.change == latest {
+		mgr.change = change
+	}
+}
 
-	// re-create the map
-	mgr.NodeSet = make(map[string]*model.Aiml, 0)
+// check for changes of the patterns made by other instances every interval
+func (mgr *AimlManager) StartReloads(interval time.Duration) {
+	if interval > 0 {
+		go func() {
+			for {
+				time.Sleep(interval)
+				err := mgr.ReloadIfChanged()
+				if err != nil {
+					logger.Log.Error("NLU: aiml reload: %s", err.Error())
+				}
+			}
+		}()
+	}
+}
 
-	err := mgr.initFromFile()
-	if err != nil {
-		return err
+// replace the patterns of a kb schema by those of its new version, returns false if they're the same
+// (nothing to do), only the schema's patterns are rebuilt
+func (mgr *AimlManager) UpdateSchema(schema db_model.KBSchema) bool {
+	mgr.Lock()
+	defer mgr.Unlock()
+	snapshot := mgr.patterns()
+	if old_schema, ok := snapshot.schema_map[schema.Id]; ok && sameSchemaPatterns(old_schema, schema) {
+		return false
 	}
+	mgr.snapshot.Store(snapshot.withSchema(schema))
+	logger.Log.Info("NLU: aiml patterns of schema %s updated", schema.Name)
+	return true
+}
 
-	err = mgr.SetupDbSchema()
-	if err != nil {
-		return err
+// remove the patterns of a kb schema
+func (mgr *AimlManager) RemoveSchema(id gocql.UUID) {
+	mgr.Lock()
+	defer mgr.Unlock()
+	snapshot := mgr.patterns()
+	if _, ok := snapshot.schema_map[id]; ok {
+		mgr.snapshot.Store(snapshot.withoutSchema(id))
 	}
+}
 
-	return nil
+// the names of the kb schemas created by origin, sorted
+func (mgr *AimlManager) GetSchemaNames(origin string) []string {
+	name_list := make([]string, 0)
+	for _, schema := range mgr.patterns().schema_map {
+		if schema.Origin == origin {
+			name_list = append(name_list, schema.Name)
+		}
+	}
+	sort.Strings(name_list)
+	return name_list
 }
 
 
@@ -18,151 +18,220 @@ import (
 )
 
 
-/**
- * raw recursive string matcher - the first token must always match one of our constants
- * for this to be able to succeed - so no wildcards for the first character
- * @param str the string to match
- * @param manager the AIML manager library
- * @return null if failed, or a an AI/ML set of matching templates
- */
+//
+// Matching
+//
+// The words of the input are matched against the tree of patterns, trying at every node:
+//   #      zero or more words
+//   _      one or more words
+//   word   the exact word
+//   ^      zero or more words
+//   *      one or more words (or none at the end of a pattern, as it always has here)
+// in that order, each wildcard binding as few words as it can.  The first complete match whose
+// leaf has templates for the conversation (see selectTemplates) is the best match; if there are
+// none the matcher backtracks to the next alternative.  So the same input always gets the same
+// best match, and a pattern can start with a wildcard.
+//
+
+// the wildcards, in order of precedence
+const (
+	wildcardZeroHigh = "#"
+	wildcardOneHigh  = "_"
+	wildcardZeroLow  = "^"
+	wildcardOneLow   = "*"
+)
+
+// is a pattern word a wildcard?
+func isWildcard(word string) bool {
+	return word == wildcardZeroHigh || word == wildcardOneHigh || word == wildcardZeroLow || word == wildcardOneLow
+}
+
+// match a token list against all patterns, returns a binding for each template of the best match
 func (mgr *AimlManager) MatchTokenList(tokenList []model.Token) []model.AimlBinding {
+	return mgr.MatchTokenListInContext(tokenList, nil)
+}
+
+// match a token list in a conversation: categories with a <that> or <topic> only match if the
+// conversation's previous reply / topic match them, state can be nil
+func (mgr *AimlManager) MatchTokenListInContext(tokenList []model.Token, state *model.AimlState) []model.AimlBinding {
 	matchList := make([]model.AimlBinding,0)
+	tokenList = tokenizer.FilterOutPunctuation(tokenizer.FilterOutSpaces(tokenList))
 	if len(tokenList) > 0 {
-		tokenList := tokenizer.FilterOutPunctuation(tokenizer.FilterOutSpaces(tokenList))
-		currentStr := strings.ToLower(tokenList[0].Text)
-		if current, ok := mgr.NodeSet[currentStr]; ok {
-			string_list := make([]model.AimlBinding, 0)
-
-			// TODO: due to reloading of manager ability - we need to lock it for now to match
-			mgr.Lock()
-			defer mgr.Unlock()
-			matchList = match(tokenList, 1, current, matchList, string_list)
+		m := &matcher{token_list: tokenList, word_list: make([]string, 0), context: newMatchContext(state)}
+		for _, t_token := range tokenList {
+			m.word_list = append(m.word_list, strings.ToLower(t_token.Text))
+		}
 
+		// the patterns right now, a reload doesn't change them (see aiml_snapshot.go)
+		leaf, template_list := m.match(mgr.patterns().root, 0)
+		if leaf != nil {
+			starList := make([][]model.Token, len(m.star_list))
+			copy(starList, m.star_list)
+			var firstStar []model.Token
+			if len(starList) > 0 {
+				firstStar = starList[0]
+			}
+			for _, template := range template_list {
+				matchList = append(matchList, model.AimlBinding{Text: template.Text, Origin: leaf.Origin,
+					TokenList: firstStar, Template: template.Template, StarList: starList,
+					Pattern: strings.ToUpper(strings.Join(m.path, " "))})
+			}
 		}
 	}
 	return matchList
 }
 
+// a match in progress
+type matcher struct {
+	token_list []model.Token
+	word_list  []string        // the tokens in lower case
+	context    *matchContext
+	star_list  [][]model.Token // the words bound to each wildcard so far
+	path       []string        // the pattern matched so far
+}
 
-/**
- * recursive matcher helper
- *
- * must become more sophisticated - on a no match - recurse to potential star match patterns
- * and keep multiple possible matches
- *
- * @param tokenList the liste of tokens to match
- * @param index the index into the list of tokens to match
- * @param rule the current rule to use for matching
- */
-func match(tokenList []model.Token, index int, rule *model.Aiml,
-			matchList []model.AimlBinding,
-			bindingList []model.AimlBinding) []model.AimlBinding {
-
-	if len(tokenList) > 0 && index < len(tokenList) && rule != nil && len(rule.NodeSet) > 0 {
-		// move on to the next token
-		currentStr := strings.ToLower(tokenList[index].Text)
-		if current, ok := rule.NodeSet[currentStr]; ok {
-			matchList = match(tokenList, index + 1, current, matchList, bindingList)
+// the best match of the words from index on with the patterns below node
+// returns the leaf matched and its templates, or nil if there's no match
+func (m *matcher) match(node *model.Aiml, index int) (*model.Aiml, []model.AimlTemplate) {
+	if index == len(m.word_list) {
+		if template_list := m.context.selectTemplates(node.TemplateList); len(template_list) > 0 {
+			return node, template_list
 		}
-
-		// is there a wildcard available per chance?
-		if current, ok := rule.NodeSet["*"]; ok {
-			starList := make([]model.Token,0)
-			first_current := current
-			// start eating text till we get to a character that is allowed after the
-			// wildcard, or we run out of characters
-			for index < len(tokenList) {
-				currentStr := strings.ToLower(tokenList[index].Text)
-				if _, ok := current.NodeSet[currentStr]; ok {
-					// found the next match - stop here
-					current = current.NodeSet[currentStr]
-					index = index + 1
-					break;
-				}
-				starList = append(starList, tokenList[index])
-				index = index + 1
+	}
+	for _, wildcard := range []string{wildcardZeroHigh, wildcardOneHigh} {
+		if leaf, template_list := m.matchWildcard(node, wildcard, index); leaf != nil {
+			return leaf, template_list
+		}
+	}
+	if index < len(m.word_list) && !isWildcard(m.word_list[index]) {
+		if next, ok := node.NodeSet[m.word_list[index]]; ok {
+			m.path = append(m.path, m.word_list[index])
+			if leaf, template_list := m.match(next, index + 1); leaf != nil {
+				return leaf, template_list
 			}
+			m.path = m.path[:len(m.path) - 1]
+		}
+	}
+	for _, wildcard := range []string{wildcardZeroLow, wildcardOneLow} {
+		if leaf, template_list := m.matchWildcard(node, wildcard, index); leaf != nil {
+			return leaf, template_list
+		}
+	}
+	return nil, nil
+}
 
-			// set the star value into the environment
-			bindingList = append(bindingList, model.AimlBinding{Offset: len(matchList),
-									Origin:                             first_current.Origin, TokenList: starList})
-			if index < len(tokenList) {
-				matchList = match(tokenList, index, current, matchList, bindingList)
-			} else {
-				if current != nil {
-					return finish_bind(matchList, current.Origin, current.TemplateList, bindingList);
-				}
-			}
+// the best match with a wildcard of node binding as few words from index on as possible
+func (m *matcher) matchWildcard(node *model.Aiml, wildcard string, index int) (*model.Aiml, []model.AimlTemplate) {
+	next, ok := node.NodeSet[wildcard]
+	if !ok {
+		return nil, nil
+	}
+	min_words := 1
+	if wildcard == wildcardZeroHigh || wildcard == wildcardZeroLow {
+		min_words = 0
+	}
+	star := len(m.star_list)
+	m.star_list = append(m.star_list, nil)
+	m.path = append(m.path, wildcard)
+	for end := index + min_words; end <= len(m.word_list); end++ {
+		m.star_list[star] = m.token_list[index:end]
+		if leaf, template_list := m.match(next, end); leaf != nil {
+			return leaf, template_list
 		}
-		return matchList
-
-	} else if len(tokenList) > 0 && index == len(tokenList) && rule != nil {
-		// finally succeeded?
-		if len(rule.TemplateList) == 0 { // end - but nothing to match
-			// hope for a match on a "*"
-			pattern, ok := rule.NodeSet["*"]
-			if !ok {
-				bindingList = append(bindingList, model.AimlBinding{Offset: len(matchList), Origin: rule.Origin}) // add empty pattern marker
-				return finish_bind(matchList, rule.Origin, rule.TemplateList, bindingList);
-			} else {
-				bindingList = append(bindingList, model.AimlBinding{Offset: len(matchList), Origin: pattern.Origin}) // add empty pattern marker
-				return finish_bind(matchList, pattern.Origin, pattern.TemplateList, bindingList);
-			}
-		} else {
-			bindingList = append(bindingList, model.AimlBinding{Offset: len(matchList), Origin: rule.Origin}) // add empty pattern marker
-			return finish_bind(matchList, rule.Origin, rule.TemplateList, bindingList);
+	}
+	// a * that ends a pattern also matches nothing
+	if wildcard == wildcardOneLow && index == len(m.word_list) {
+		if template_list := m.context.selectTemplates(next.TemplateList); len(template_list) > 0 {
+			m.star_list[star] = m.token_list[index:]
+			return next, template_list
 		}
 	}
-	return matchList
+	m.star_list = m.star_list[:star]
+	m.path = m.path[:len(m.path) - 1]
+	return nil, nil
 }
 
 
-/**
- * resolve / assign the bindings to the matches as required
- * @param matchList the list of matches store
- * @param list the items to add to the match store
- * @param bindings the bindings made along the way
- */
-func finish_bind(matchList []model.AimlBinding, origin string, list []string, bindings []model.AimlBinding) []model.AimlBinding {
-	final_match_list := make([]model.AimlBinding,0)
-	for _, str := range list {
-		matchList = append(matchList, model.AimlBinding{Text: str, Origin: origin})
+// the previous reply and topic of a conversation as words, to match <that> and <topic> against
+type matchContext struct {
+	that  []string
+	topic []string
+}
+
+func newMatchContext(state *model.AimlState) *matchContext {
+	context := &matchContext{that: make([]string, 0), topic: make([]string, 0)}
+	if state != nil {
+		context.that = lastSentenceWords(state.That)
+		context.topic = patternWords(state.Predicates[TopicPredicate])
 	}
-	if len(bindings) > 0 {
-		newMatchList := make([]model.AimlBinding,0)
-		stackIndex := bindings[0].Offset
-		tokenList := bindings[0].TokenList
-		nextStack := -1
-		nextIndex := 1
-		if len(bindings) > 1 {
-			nextStack = bindings[nextIndex].Offset
-		}
-		for i := 0; i < len(matchList); i++ {
-			match := matchList[i]
-			// have we reached the next item in the binding stack?
-			for nextStack >= 0 && i >= nextStack && nextIndex < len(bindings) {
-				tokenList = bindings[nextIndex].TokenList
-				stackIndex = bindings[nextIndex].Offset
-				nextIndex += 1;
-				if nextIndex < len(bindings) {
-					nextStack = bindings[nextIndex].Offset
-				} else {
-					nextStack = -1; // there is no more next
-				}
+	return context
+}
+
+// the templates that apply in the context, those restricted by a <that> (and then by a <topic>)
+// win over those that aren't, the way a more specific pattern wins over a wildcard
+func (context *matchContext) selectTemplates(list []model.AimlTemplate) []model.AimlTemplate {
+	best_list := make([]model.AimlTemplate, 0)
+	best_specificity := -1
+	for _, template := range list {
+		specificity := 0
+		if len(template.That) > 0 {
+			if !matchWords(patternWords(template.That), context.that) {
+				continue
 			}
-			if i >= stackIndex && tokenList != nil && len(tokenList) > 0 {
-				newMatch := model.AimlBinding{Text:     match.Text, Offset: match.Offset,
-												Origin: origin, TokenList: match.TokenList}
-				newMatch.TokenList = tokenList
-				newMatchList = append(newMatchList, newMatch)
-			} else {
-				newMatchList = append(newMatchList, match)
+			specificity += 2
+		}
+		if len(template.Topic) > 0 && template.Topic != "*" {
+			if !matchWords(patternWords(template.Topic), context.topic) {
+				continue
 			}
+			specificity += 1
+		}
+		if specificity > best_specificity {
+			best_list = make([]model.AimlTemplate, 0)
+			best_specificity = specificity
 		}
-		for _, item := range newMatchList {
-			final_match_list = append(final_match_list, item)
+		if specificity == best_specificity {
+			best_list = append(best_list, template)
 		}
 	}
-	return final_match_list
+	return best_list
 }
 
+// the lower case words of a text or pattern
+func patternWords(text string) []string {
+	word_list := make([]string, 0)
+	for _, t_token := range tokenizer.FilterOutPunctuation(tokenizer.FilterOutSpaces(tokenizer.Tokenize(text))) {
+		word_list = append(word_list, strings.ToLower(t_token.Text))
+	}
+	return word_list
+}
+
+// the words of the last sentence of a text
+func lastSentenceWords(text string) []string {
+	text = strings.TrimRight(strings.TrimSpace(text), ".?!")
+	if index := strings.LastIndexAny(text, ".?!"); index >= 0 {
+		text = text[index + 1:]
+	}
+	return patternWords(text)
+}
+
+// does a list of words match a pattern of words where * and _ stand for one or more words,
+// # and ^ for zero or more
+func matchWords(pattern []string, word_list []string) bool {
+	if len(pattern) == 0 {
+		return len(word_list) == 0
+	}
+	if isWildcard(pattern[0]) {
+		min_words := 1
+		if pattern[0] == wildcardZeroHigh || pattern[0] == wildcardZeroLow {
+			min_words = 0
+		}
+		for i := min_words; i <= len(word_list); i++ {
+			if matchWords(pattern[1:], word_list[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	return len(word_list) > 0 && pattern[0] == word_list[0] && matchWords(pattern[1:], word_list[1:])
+}
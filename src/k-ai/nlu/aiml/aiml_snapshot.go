@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package aiml
+
+import (
+	"strings"
+	"k-ai/logger"
+	"k-ai/nlu/model"
+	"k-ai/nlu/tokenizer"
+	"k-ai/db/db_model"
+	"github.com/gocql/gocql"
+)
+
+//
+// AIML snapshots
+//
+// The tree of patterns matched is never changed once published (see AimlManager): matches
+// read it without a lock.  A reload builds a new tree on the side, a change to a few patterns
+// (e.g. a kb schema's) copies the nodes on their paths and shares all others with the old tree.
+//
+
+// a tree of patterns and the kb schemas whose patterns are in it
+type aimlSnapshot struct {
+	root       *model.Aiml                      // the first words of all patterns
+	schema_map map[gocql.UUID]db_model.KBSchema // the kb schemas added, by id
+}
+
+// an empty tree, to be built
+func newSnapshot() *aimlSnapshot {
+	return &aimlSnapshot{root: &model.Aiml{NodeSet: make(map[string]*model.Aiml, 0)},
+		schema_map: make(map[gocql.UUID]db_model.KBSchema, 0)}
+}
+
+// the tokens of the expansions of a list of patterns that can be added, a pattern needs two words at least
+func patternTokenLists(patternList []string) [][]model.Token {
+	token_lists := make([][]model.Token, 0)
+	for _, pattern1 := range patternList {
+		for _, pattern := range expandBrackets(pattern1) {
+			tokenList := tokenizer.FilterOutPunctuation(tokenizer.FilterOutSpaces(tokenizer.Tokenize(pattern)))
+			if len(tokenList) > 1 {
+				token_lists = append(token_lists, tokenList)
+			}
+		}
+	}
+	return token_lists
+}
+
+// add patterns to a tree that isn't published yet
+func (s *aimlSnapshot) addPattern(patternList []string, origin string, templateList []model.AimlTemplate) {
+	for _, tokenList := range patternTokenLists(patternList) {
+		addPatternHelper(s.root, origin, 0, tokenList, templateList)
+	}
+}
+
+// add categories to a tree that isn't published yet
+func (s *aimlSnapshot) addCategories(category_list []model.AimlCategory) {
+	for _, cat := range category_list {
+		template_list, err := newTemplateList(cat.Template, cat.That, cat.Topic)
+		if err != nil {
+			logger.Log.Error("NLU: %s: template of %s: %s", cat.Module, strings.Join(cat.PatternList, ", "), err.Error())
+			continue
+		}
+		s.addPattern(cat.PatternList, moduleOrigin(cat.Module), template_list)
+	}
+}
+
+// a copy of a tree with the templates of a list of patterns changed, only the nodes on the
+// patterns' paths are copied
+func (s *aimlSnapshot) changePatterns(patternList []string, origin string,
+									change func([]model.AimlTemplate) []model.AimlTemplate) *aimlSnapshot {
+	result := &aimlSnapshot{root: s.root, schema_map: s.schema_map}
+	for _, tokenList := range patternTokenLists(patternList) {
+		result.root = changePatternHelper(result.root, origin, 0, tokenList, change)
+	}
+	return result
+}
+
+// a copy of node with the templates of the pattern tokenList[index:] below it changed,
+// nodes left without templates or nodes are removed
+func changePatternHelper(node *model.Aiml, origin string, index int, tokenList []model.Token,
+							change func([]model.AimlTemplate) []model.AimlTemplate) *model.Aiml {
+	node_copy := &model.Aiml{Text: node.Text, Origin: node.Origin, TemplateList: node.TemplateList,
+		NodeSet: make(map[string]*model.Aiml, len(node.NodeSet) + 1)}
+	for key, child := range node.NodeSet {
+		node_copy.NodeSet[key] = child
+	}
+	if index == len(tokenList) {
+		node_copy.TemplateList = change(node.TemplateList)
+		return node_copy
+	}
+	key := strings.ToLower(tokenList[index].Text)
+	child, ok := node.NodeSet[key]
+	if !ok {
+		child = &model.Aiml{Text: key, Origin: origin, NodeSet: make(map[string]*model.Aiml, 0)}
+	}
+	child = changePatternHelper(child, origin, index + 1, tokenList, change)
+	if len(child.TemplateList) == 0 && len(child.NodeSet) == 0 {
+		delete(node_copy.NodeSet, key)
+	} else {
+		node_copy.NodeSet[key] = child
+	}
+	return node_copy
+}
+
+// a change adding templates
+func addTemplates(templateList []model.AimlTemplate) func([]model.AimlTemplate) []model.AimlTemplate {
+	return func(list []model.AimlTemplate) []model.AimlTemplate {
+		new_list := make([]model.AimlTemplate, 0, len(list) + len(templateList))
+		return append(append(new_list, list...), templateList...)
+	}
+}
+
+// a change removing a template
+func removeTemplate(template model.AimlTemplate) func([]model.AimlTemplate) []model.AimlTemplate {
+	return func(list []model.AimlTemplate) []model.AimlTemplate {
+		new_list := make([]model.AimlTemplate, 0, len(list))
+		for _, item := range list {
+			if item != template {
+				new_list = append(new_list, item)
+			}
+		}
+		return new_list
+	}
+}
+
+// the patterns of a kb schema field and the template searching the schema's kb by that field
+type schemaPattern struct {
+	pattern_list []string
+	template     model.AimlTemplate
+}
+
+// the patterns of a kb schema, from the aiml of its fields (one pattern per line)
+func schemaPatterns(schema db_model.KBSchema) []schemaPattern {
+	schema_pattern_list := make([]schemaPattern, 0)
+	for _, field := range schema.Field_list {
+		aiml_list := make([]string,0)
+		for _, aiml_str := range strings.Split(field.Aiml, "\n") {
+			aiml_str = strings.TrimSpace(aiml_str)
+			if len(aiml_str) > 0 {
+				aiml_list = append(aiml_list, aiml_str)
+			}
+		}
+		if len(aiml_list) > 0 {
+			kbStr := "db_search:" + schema.Name + ":" + field.Name
+			schema_pattern_list = append(schema_pattern_list, schemaPattern{pattern_list: aiml_list,
+				template: model.AimlTemplate{Text: kbStr}})
+		}
+	}
+	return schema_pattern_list
+}
+
+// do two versions of a kb schema have the same patterns?
+func sameSchemaPatterns(schema_1 db_model.KBSchema, schema_2 db_model.KBSchema) bool {
+	if schema_1.Origin != schema_2.Origin {
+		return false
+	}
+	list_1 := schemaPatterns(schema_1)
+	list_2 := schemaPatterns(schema_2)
+	if len(list_1) != len(list_2) {
+		return false
+	}
+	for i := range list_1 {
+		if list_1[i].template != list_2[i].template ||
+			strings.Join(list_1[i].pattern_list, "\n") != strings.Join(list_2[i].pattern_list, "\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// a copy of a kb schema that doesn't share its fields, snapshots don't change
+func copySchema(schema db_model.KBSchema) db_model.KBSchema {
+	schema.Field_list = append([]db_model.KBSchemaField{}, schema.Field_list...)
+	return schema
+}
+
+// add the patterns of a kb schema to a tree that isn't published yet
+func (s *aimlSnapshot) addSchema(schema db_model.KBSchema) {
+	for _, sp := range schemaPatterns(schema) {
+		s.addPattern(sp.pattern_list, schema.Origin, []model.AimlTemplate{sp.template})
+	}
+	s.schema_map[schema.Id] = copySchema(schema)
+}
+
+// a copy of a tree without the patterns of a kb schema
+func (s *aimlSnapshot) withoutSchema(id gocql.UUID) *aimlSnapshot {
+	schema, ok := s.schema_map[id]
+	if !ok {
+		return s
+	}
+	result := &aimlSnapshot{root: s.root}
+	for _, sp := range schemaPatterns(schema) {
+		result = result.changePatterns(sp.pattern_list, schema.Origin, removeTemplate(sp.template))
+	}
+	result.schema_map = make(map[gocql.UUID]db_model.KBSchema, len(s.schema_map))
+	for schema_id, item := range s.schema_map {
+		if schema_id != id {
+			result.schema_map[schema_id] = item
+		}
+	}
+	return result
+}
+
+// a copy of a tree with the patterns of (the new version of) a kb schema
+func (s *aimlSnapshot) withSchema(schema db_model.KBSchema) *aimlSnapshot {
+	result := s.withoutSchema(schema.Id)
+	for _, sp := range schemaPatterns(schema) {
+		result = result.changePatterns(sp.pattern_list, schema.Origin, addTemplates([]model.AimlTemplate{sp.template}))
+	}
+	schema_map := make(map[gocql.UUID]db_model.KBSchema, len(result.schema_map) + 1)
+	for schema_id, item := range result.schema_map {
+		schema_map[schema_id] = item
+	}
+	schema_map[schema.Id] = copySchema(schema)
+	result.schema_map = schema_map
+	return result
+}
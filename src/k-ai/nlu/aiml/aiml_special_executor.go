@@ -15,52 +15,16 @@ import (
 	"strings"
 	"github.com/gocql/gocql"
 	"encoding/json"
-	"time"
-	"strconv"
 	"k-ai/nlu/model"
 	"k-ai/db/db_model"
-	"k-ai/nlu/tokenizer"
 	"k-ai/nlu/parser"
 	"k-ai/util"
+	"k-ai/nlu/answer"
 )
 
-// replace magic {} values for AIML
-func replaceMagicValues(binding model.AimlBinding, email string) string {
-	text := binding.Text
-	if strings.Contains(text, "{stats}") {
-		statsStr := "system statistics: todo"
-		text = strings.Replace(text, "{stats}", statsStr, -1)
-	}
-	if strings.Contains(text, "{year}") {
-		text = strings.Replace(text, "{year}", strconv.Itoa(time.Now().Year()), -1)
-	}
-	if strings.Contains(text, "{day}") {
-		text = strings.Replace(text, "{day}", time.Now().Weekday().String(), -1)
-	}
-	if strings.Contains(text, "{month}") {
-		text = strings.Replace(text, "{month}", time.Now().Month().String(), -1)
-	}
-	if strings.Contains(text, "{time}") {
-		text = strings.Replace(text, "{time}", time.Now().Format(time.Kitchen), -1)
-	}
-	if strings.Contains(text, "{date}") {
-		text = strings.Replace(text, "{date}", time.Now().Format(time.RFC850), -1)
-	}
-	if strings.Contains(text, "{email}") {
-		text = strings.Replace(text, "{email}", "your email address is " + email, -1)
-	}
-	if strings.Contains(text, "{name}") || strings.Contains(text, "{fullname}") {
-		text = strings.Replace(text, "{name}", "I can't tell you your name but your email address is " + email, -1)
-	}
-	if strings.Contains(text, "{star}") {
-		tstr := tokenizer.ToString(binding.TokenList)
-		text = strings.Replace(text, "{star}", tstr, -1)
-	}
-	return text
-}
-
-// turn a set of index results into a series of text results
-func addIndexResults(result_map map[gocql.UUID][]model.IndexMatch, result_list *model.ATResultList) {
+// turn a set of index results into a series of text results, with the answer to question
+func addIndexResults(question model.Sentence, result_map map[gocql.UUID][]model.IndexMatch, result_list *model.ATResultList) {
+	question_type := question.GetQuestionType()
 	// load each url's object
 	for id, index_list := range result_map {
 		if len(index_list) > 0 {
@@ -68,6 +32,7 @@ func addIndexResults(result_map map[gocql.UUID][]model.IndexMatch, result_list *
 			if err == nil {
 				str := sentence.ToString()
 				result_list.ResultList = append(result_list.ResultList, model.ATResult{Text: str, Topic: sentence.Topic,
+							Answer: answer.ExtractAnswer(question, question_type, *sentence),
 							Sentence_id: sentence.Id, Timestamp: util.GetTimeNowSting()})
 			}
 		}
@@ -76,14 +41,19 @@ func addIndexResults(result_map map[gocql.UUID][]model.IndexMatch, result_list *
 
 
 // perform special match characters on aiml matches
-// if appropriate
-func (mrg *AimlManager) PerformSpecialOps(binding_results []model.AimlBinding, topic string) (*model.ATResultList, error) {
+// if appropriate, {search:} queries are expanded with synonyms if use_synonyms is set
+// templates are evaluated in the conversation of state (see aiml_template.go), state can be nil
+func (mrg *AimlManager) PerformSpecialOps(binding_results []model.AimlBinding, topic string, use_synonyms bool,
+											state *model.AimlState) (*model.ATResultList, error) {
 	rs := model.ATResultList{ResultList: make([]model.ATResult,0)}
 	schema_map, err := db_model.GetSchemaMap()
 	if err != nil { return nil, err }
 
 	for _, binding := range binding_results {
 
+		// evaluate the template's tags first, their result can be a special op
+		binding.Text = mrg.Evaluate(binding, state)
+
 		////////////////////////////////////////////////////////////////////
 		// db search?   the special entities from the kb system
 
@@ -151,10 +121,10 @@ func (mrg *AimlManager) PerformSpecialOps(binding_results []model.AimlBinding, t
 			// parse the new search pattern
 			sentence_list, err := parser.ParseText(search_str)
 			if err == nil && len(sentence_list) > 0 {
-				result_map, err := db_model.ReadIndexesWithFilterForTokens(sentence_list[0].TokenList, topic, 0)
+				result_map, err := db_model.ReadIndexesForTokens(sentence_list[0].TokenList, topic, 0, use_synonyms)
 				if err == nil {
 					// build the search results into rs using the index map
-					addIndexResults(result_map, &rs)
+					addIndexResults(sentence_list[0], result_map, &rs)
 				}
 			}
 
@@ -162,8 +132,8 @@ func (mrg *AimlManager) PerformSpecialOps(binding_results []model.AimlBinding, t
 
 			////////////////////////////////////////////////////////////////////
 
-			// replace any magic values such as {time} etc.
-			binding_text:= replaceMagicValues(binding, topic)
+			// replace any template functions such as {time} etc. (see aiml_functions.go)
+			binding_text := replaceFunctions(binding.Text, FunctionContext{Binding: binding, Email: topic})
 
 			rs.ResultList = append(rs.ResultList, model.ATResult{Text: binding_text,
 							Topic: binding.Origin, Timestamp: util.GetTimeNowSting() })
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package aiml
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"errors"
+	"strings"
+	"k-ai/db/db_model"
+)
+
+// how long system statistics are kept before their counters are read again (see db_model/statistics.go)
+const StatisticsCacheTime = time.Minute
+
+// when the system started
+var startTime = time.Now()
+
+// the system statistics last read, and when
+var statistics *db_model.SystemStatistics
+var statisticsTime time.Time
+var statisticsLock sync.Mutex
+
+// the system statistics, read at most once every StatisticsCacheTime
+func getStatistics() (*db_model.SystemStatistics, error) {
+	statisticsLock.Lock()
+	defer statisticsLock.Unlock()
+	if statistics == nil || time.Since(statisticsTime) > StatisticsCacheTime {
+		stats, err := db_model.GetSystemStatistics()
+		if err != nil { return nil, err }
+		statistics = stats
+		statisticsTime = time.Now()
+	}
+	return statistics, nil
+}
+
+// n things, e.g. "1 day" or "2 days"
+func plural(n int64, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
+
+// a duration as days, hours and minutes
+func formatUptime(uptime time.Duration) string {
+	minutes := int64(uptime / time.Minute)
+	days := minutes / (24 * 60)
+	hours := (minutes / 60) % 24
+	minutes = minutes % 60
+	if days > 0 {
+		return plural(days, "day") + ", " + plural(hours, "hour") + " and " + plural(minutes, "minute")
+	} else if hours > 0 {
+		return plural(hours, "hour") + " and " + plural(minutes, "minute")
+	}
+	return plural(minutes, "minute")
+}
+
+// the text of {stats:what}, all statistics if what is empty
+func formatStatistics(stats *db_model.SystemStatistics, uptime time.Duration, what string) (string, error) {
+	switch strings.ToLower(what) {
+	case "":
+		return fmt.Sprintf("%d users, %d factoids, %d topics, %d knowledge base entries, %d index entries, up for %s",
+			stats.Users, stats.Factoids, stats.Topics, stats.KBEntries, stats.IndexEntries, formatUptime(uptime)), nil
+	case "users":
+		return fmt.Sprintf("%d", stats.Users), nil
+	case "factoids":
+		return fmt.Sprintf("%d", stats.Factoids), nil
+	case "topics":
+		return fmt.Sprintf("%d", stats.Topics), nil
+	case "kb":
+		return fmt.Sprintf("%d", stats.KBEntries), nil
+	case "index":
+		return fmt.Sprintf("%d", stats.IndexEntries), nil
+	case "uptime":
+		return formatUptime(uptime), nil
+	}
+	return "", errors.New("unknown statistic \"" + what + "\", expected users, factoids, topics, kb, index or uptime")
+}
+
+// {stats}, {stats:what}
+func statsFunction(arguments string, context FunctionContext) (string, error) {
+	if strings.ToLower(arguments) == "uptime" {
+		return formatUptime(time.Since(startTime)), nil  // no need to count
+	}
+	stats, err := getStatistics()
+	if err != nil { return "", err }
+	return formatStatistics(stats, time.Since(startTime), arguments)
+}
+
+// {kb_count:kb}
+func kbCountFunction(arguments string, context FunctionContext) (string, error) {
+	if len(arguments) == 0 {
+		return "", errors.New("{kb_count:kb} needs the name of a knowledge base")
+	}
+	count, err := db_model.CountKBEntries(arguments)
+	if err != nil { return "", err }
+	return fmt.Sprintf("%d", count), nil
+}
+
+func init() {
+	RegisterFunction("stats", statsFunction)
+	RegisterFunction("kb_count", kbCountFunction)
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package aiml
+
+import (
+	"io"
+	"errors"
+	"strconv"
+	"strings"
+	"math/rand"
+	"encoding/xml"
+	"k-ai/logger"
+	"k-ai/nlu/model"
+	"k-ai/nlu/tokenizer"
+)
+
+//
+// AIML templates
+//
+// A template is evaluated when its category is the answer:
+//   <srai>text</srai>         the answer to text, as if the user had said it (at most MaxSraiDepth deep)
+//   <sr/>                     <srai><star/></srai>
+//   <random><li>..</li></random>  one of the <li> at random
+//   <star/>, <star index="n"/>    the text bound to the first / n-th wildcard of the pattern
+//   <set name="x">text</set>  remember text as x for the rest of the conversation, says text
+//   <get name="x"/>           what was remembered as x, nothing if nothing was
+//   <think>..</think>         evaluate but say nothing, e.g. to <set> quietly
+// the "topic" predicate is the topic of the conversation, matched against <topic>.
+// Unknown tags are left out, their contents kept.  Alternatives separated by | (outside any
+// tag) are separate templates, the way templates have always been written here.
+//
+
+// the maximum depth of nested <srai>s, deeper is taken to be a loop
+const MaxSraiDepth = 16
+
+// the predicate holding the topic of a conversation
+const TopicPredicate = "topic"
+
+// a parsed template element, or text if name is empty
+type templateNode struct {
+	name      string
+	text      string
+	attr_map  map[string]string
+	node_list []*templateNode
+}
+
+// parse the xml of a template into its elements
+func parseTemplate(template string) ([]*templateNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader("<template>" + template + "</template>"))
+	decoder.Entity = xml.HTMLEntity
+	root := &templateNode{name: "template"}
+	stack := []*templateNode{}
+	current := root
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &templateNode{name: strings.ToLower(t.Name.Local), attr_map: make(map[string]string, 0)}
+			for _, attr := range t.Attr {
+				node.attr_map[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+			current.node_list = append(current.node_list, node)
+			stack = append(stack, current)
+			current = node
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("unexpected </" + t.Name.Local + ">")
+			}
+			current = stack[len(stack) - 1]
+			stack = stack[:len(stack) - 1]
+		case xml.CharData:
+			current.node_list = append(current.node_list, &templateNode{text: string(t)})
+		}
+	}
+	if len(stack) > 0 || len(root.node_list) != 1 {
+		return nil, errors.New("invalid template")
+	}
+	return root.node_list[0].node_list, nil
+}
+
+// split a template on the |s that aren't inside a tag
+func splitAlternatives(template string) []string {
+	alternative_list := make([]string, 0)
+	depth := 0
+	start := 0
+	for i := 0; i < len(template); i++ {
+		ch := template[i]
+		if ch == '<' {
+			end := strings.IndexByte(template[i:], '>')
+			if end < 0 {
+				break
+			}
+			tag := template[i : i + end + 1]
+			if strings.HasPrefix(tag, "</") {
+				depth -= 1
+			} else if !strings.HasSuffix(tag, "/>") && !strings.HasPrefix(tag, "<!") && !strings.HasPrefix(tag, "<?") {
+				depth += 1
+			}
+			i += end
+		} else if ch == '|' && depth <= 0 {
+			alternative_list = append(alternative_list, template[start:i])
+			start = i + 1
+		}
+	}
+	return append(alternative_list, template[start:])
+}
+
+// the text of a list of template elements, without their tags
+func nodeText(node_list []*templateNode) string {
+	text := ""
+	for _, node := range node_list {
+		if len(node.name) == 0 {
+			text += node.text
+		} else {
+			text += nodeText(node.node_list)
+		}
+	}
+	return text
+}
+
+// the templates of an AIML <template>, one for each of its alternatives
+func newTemplateList(template string, that string, topic string) ([]model.AimlTemplate, error) {
+	template_list := make([]model.AimlTemplate, 0)
+	for _, alternative := range splitAlternatives(template) {
+		alternative = strings.TrimSpace(alternative)
+		if len(alternative) == 0 {
+			continue
+		}
+		node_list, err := parseTemplate(alternative)
+		if err != nil { return nil, err }
+		text := strings.TrimSpace(nodeText(node_list))
+		if !strings.Contains(alternative, "<") {
+			alternative = ""  // plain text, nothing to evaluate
+		}
+		template_list = append(template_list, model.AimlTemplate{Template: alternative, Text: text,
+			That: strings.TrimSpace(that), Topic: strings.TrimSpace(topic)})
+	}
+	return template_list, nil
+}
+
+// the answer of a matched binding in a conversation, evaluating the tags of its template
+// the conversation's predicates are updated by any <set>s, state can be nil
+func (mgr *AimlManager) Evaluate(binding model.AimlBinding, state *model.AimlState) string {
+	if state == nil {
+		state = &model.AimlState{}
+	}
+	if state.Predicates == nil {
+		state.Predicates = make(map[string]string, 0)
+	}
+	return mgr.evaluate(binding, state, 0)
+}
+
+// evaluate a binding's template at a <srai> depth
+func (mgr *AimlManager) evaluate(binding model.AimlBinding, state *model.AimlState, depth int) string {
+	if len(binding.Template) == 0 {
+		return binding.Text
+	}
+	node_list, err := parseTemplate(binding.Template)
+	if err != nil {
+		logger.Log.Error("aiml: invalid template \"%s\": %s", binding.Template, err.Error())
+		return binding.Text
+	}
+	return strings.Join(strings.Fields(mgr.evaluateNodes(node_list, binding, state, depth)), " ")
+}
+
+// evaluate a list of template elements
+func (mgr *AimlManager) evaluateNodes(node_list []*templateNode, binding model.AimlBinding, state *model.AimlState, depth int) string {
+	text := ""
+	for _, node := range node_list {
+		text += mgr.evaluateNode(node, binding, state, depth)
+	}
+	return text
+}
+
+// evaluate a single template element
+func (mgr *AimlManager) evaluateNode(node *templateNode, binding model.AimlBinding, state *model.AimlState, depth int) string {
+	switch node.name {
+	case "":
+		return node.text
+	case "srai":
+		return mgr.srai(mgr.evaluateNodes(node.node_list, binding, state, depth), state, depth + 1)
+	case "sr":
+		return mgr.srai(starText(binding, 1), state, depth + 1)
+	case "star":
+		index, err := strconv.Atoi(node.attr_map["index"])
+		if err != nil {
+			index = 1
+		}
+		return starText(binding, index)
+	case "random":
+		li_list := make([]*templateNode, 0)
+		for _, child := range node.node_list {
+			if child.name == "li" {
+				li_list = append(li_list, child)
+			}
+		}
+		if len(li_list) == 0 {
+			return ""
+		}
+		return mgr.evaluateNodes(li_list[rand.Intn(len(li_list))].node_list, binding, state, depth)
+	case "set":
+		value := strings.TrimSpace(mgr.evaluateNodes(node.node_list, binding, state, depth))
+		if name := strings.ToLower(node.attr_map["name"]); len(name) > 0 {
+			state.Predicates[name] = value
+		}
+		return value
+	case "get":
+		return state.Predicates[strings.ToLower(node.attr_map["name"])]
+	case "think":
+		mgr.evaluateNodes(node.node_list, binding, state, depth)
+		return ""
+	}
+	return mgr.evaluateNodes(node.node_list, binding, state, depth)
+}
+
+// the text bound to the index-th wildcard (1 based), empty if there isn't one
+func starText(binding model.AimlBinding, index int) string {
+	if index >= 1 && index <= len(binding.StarList) {
+		return tokenizer.ToString(binding.StarList[index - 1])
+	}
+	if index == 1 {
+		return tokenizer.ToString(binding.TokenList)
+	}
+	return ""
+}
+
+// the answer to text as if the user had said it
+func (mgr *AimlManager) srai(text string, state *model.AimlState, depth int) string {
+	if depth > MaxSraiDepth {
+		logger.Log.Error("aiml: <srai> nested more than %d deep, stopped at \"%s\"", MaxSraiDepth, text)
+		return ""
+	}
+	binding_list := mgr.MatchTokenListInContext(tokenizer.Tokenize(text), state)
+	if len(binding_list) == 0 {
+		return ""
+	}
+	binding := binding_list[rand.Intn(len(binding_list))]
+	answer := mgr.evaluate(binding, state, depth)
+	return strings.Replace(answer, "{star}", tokenizer.ToString(binding.TokenList), -1)
+}
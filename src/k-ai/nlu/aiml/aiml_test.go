@@ -12,7 +12,9 @@
 package aiml
 
 import (
+	"os"
 	"testing"
+	"io/ioutil"
 	"github.com/gocql/gocql"
 	"k-ai/nlu/tokenizer"
 	"k-ai/nlu/model"
@@ -20,8 +22,11 @@ import (
 	"encoding/json"
 	"k-ai/db"
 	"strconv"
+	"strings"
 	"time"
+	"sync"
 	"k-ai/util_ut"
+	"k-ai/util"
 )
 
 const name_field = `[{"tokenList":[{"index":0,"list":[0],"tag":"NNP","text":"Peter de Vocht","dep":"compound","synid":-1,"semantic":"person"}]}]`
@@ -205,8 +210,8 @@ func TestAiml_db(t *testing.T) {
 	err = schema_1.SaveSchema()
 	util_ut.Check(t, err)
 
-	// setup the aiml system with the db
-	err = Aiml.SetupDbSchema()
+	// load the patterns of the schema
+	err = Aiml.Reload()
 	util_ut.Check(t, err)
 
 	// add a record to the database for our new schema
@@ -228,7 +233,7 @@ func TestAiml_db(t *testing.T) {
 	if result == nil || len(result) != 1 {
 		t.Errorf("len(result) != 1, but %d", len(result))
 	} else {
-		rs, err := Aiml.PerformSpecialOps(result, "address")
+		rs, err := Aiml.PerformSpecialOps(result, "address", true, nil)
 		util_ut.Check(t, err)
 		if len(rs.ResultList) != 1 {
 			t.Errorf("len(result) != 1 after special ops, but %d", len(rs.ResultList))
@@ -261,7 +266,7 @@ func TestAiml5(t *testing.T) {
 	if result[0].Text != str {
 		t.Errorf("expected %s but got %s", str, result[0].Text)
 	} else {
-		rs, err := Aiml.PerformSpecialOps(result, "peter@peter.co.nz")
+		rs, err := Aiml.PerformSpecialOps(result, "peter@peter.co.nz", true, nil)
 		util_ut.Check(t, err)
 		if len(rs.ResultList) != 1 {
 			t.Errorf("len(result) != 1 after special ops, but %d", len(rs.ResultList))
@@ -279,3 +284,425 @@ func TestAiml5(t *testing.T) {
 	db_model.Delete_keyspace_after_unit_test("kai_ai_schema_aiml_test_2")
 }
 
+
+
+// add a category to an aiml manager for testing
+func addCategory(t *testing.T, mgr *AimlManager, pattern string, that string, topic string, template string) {
+	template_list, err := newTemplateList(template, that, topic)
+	util_ut.Check(t, err)
+	mgr.AddPattern([]string{pattern}, "test module", template_list)
+}
+
+// the evaluated answer of a manager to text in a conversation, empty if nothing matches
+func answerText(mgr *AimlManager, text string, state *model.AimlState) string {
+	binding_list := mgr.MatchTokenListInContext(tokenizer.Tokenize(text), state)
+	if len(binding_list) == 0 {
+		return ""
+	}
+	return mgr.Evaluate(binding_list[0], state)
+}
+
+// test template evaluation: srai, stars, random, set/get and think
+func TestAimlTemplates1(t *testing.T) {
+	mgr := &AimlManager{}
+	addCategory(t, mgr, "HI ROBOT", "", "", `Hello <get name="name"/>!`)
+	addCategory(t, mgr, "HELLO THERE", "", "", `<srai>hi robot</srai>`)
+	addCategory(t, mgr, "LOOP AGAIN", "", "", `<srai>loop again</srai>`)
+	addCategory(t, mgr, "MY * IS CALLED *", "", "", `<star index="2"/> is your <star/>.`)
+	addCategory(t, mgr, "PICK ONE", "", "", `<random><li>heads</li><li>tails</li></random>`)
+	addCategory(t, mgr, "CALL ME *", "", "", `<think><set name="name"><star/></set></think>Ok.`)
+
+	state := &model.AimlState{Predicates: map[string]string{"name": "Peter"}}
+	util_ut.IsTrue(t, answerText(mgr, "hello there!", state) == "Hello Peter!")
+	util_ut.IsTrue(t, answerText(mgr, "loop again", state) == "")  // stopped by the depth limit
+	util_ut.IsTrue(t, answerText(mgr, "my dog is called Rex", state) == "Rex is your dog.")
+	pick := answerText(mgr, "pick one", state)
+	util_ut.IsTrue(t, pick == "heads" || pick == "tails")
+
+	util_ut.IsTrue(t, answerText(mgr, "call me Bob", state) == "Ok.")
+	util_ut.IsTrue(t, state.Predicates["name"] == "Bob")
+	util_ut.IsTrue(t, answerText(mgr, "hi robot", state) == "Hello Bob!")
+
+	// | separates alternatives, but not inside a tag
+	template_list, err := newTemplateList(`a|<random><li>b|c</li></random>|`, "", "")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(template_list) == 2 && template_list[0].Template == "" && template_list[0].Text == "a")
+}
+
+// test <that> and <topic> restrict categories to a conversation
+func TestAimlThatTopic1(t *testing.T) {
+	mgr := &AimlManager{}
+	addCategory(t, mgr, "YES PLEASE", "DO YOU WANT * TEA", "", `Coming up.`)
+	addCategory(t, mgr, "YES PLEASE", "", "", `Yes what?`)
+	addCategory(t, mgr, "WHAT ABOUT IT", "", "FOOD", `Food is great.`)
+	addCategory(t, mgr, "WHAT ABOUT IT", "", "", `About what?`)
+	addCategory(t, mgr, "LETS TALK *", "", "", `<think><set name="topic"><star/></set></think>Sure.`)
+
+	state := &model.AimlState{Predicates: make(map[string]string, 0)}
+	util_ut.IsTrue(t, answerText(mgr, "yes please", state) == "Yes what?")
+	state.That = "Hello.  Do you want some tea?"
+	util_ut.IsTrue(t, answerText(mgr, "yes please", state) == "Coming up.")
+
+	util_ut.IsTrue(t, answerText(mgr, "what about it", state) == "About what?")
+	util_ut.IsTrue(t, answerText(mgr, "lets talk food", state) == "Sure.")
+	util_ut.IsTrue(t, answerText(mgr, "what about it", state) == "Food is great.")
+}
+
+// the text bound to each wildcard of the best match for text, nil if nothing matches
+func starTexts(mgr *AimlManager, text string) []string {
+	binding_list := mgr.MatchTokenList(tokenizer.Tokenize(text))
+	if len(binding_list) == 0 {
+		return nil
+	}
+	star_list := make([]string, 0)
+	for _, star := range binding_list[0].StarList {
+		star_list = append(star_list, tokenizer.ToString(star))
+	}
+	return star_list
+}
+
+// test wildcard precedence, backtracking and wildcard-first patterns
+func TestAimlMatcher1(t *testing.T) {
+	mgr := &AimlManager{}
+	addCategory(t, mgr, "I LIKE *", "", "", "word")
+	addCategory(t, mgr, "_ LIKE PIZZA", "", "", "underscore")
+	addCategory(t, mgr, "* LIKE PASTA", "", "", "star")
+	addCategory(t, mgr, "I LIKE PASTA", "", "", "exact")
+	addCategory(t, mgr, "DO YOU LIKE CATS", "", "", "cats")
+	addCategory(t, mgr, "DO YOU * DOGS", "", "", "dogs")
+	addCategory(t, mgr, "WHAT * IS BLUE", "", "", "blue")
+	addCategory(t, mgr, "# HELLO #", "", "", "hello")
+	addCategory(t, mgr, "GOOD ^ MORNING", "", "", "morning")
+	addCategory(t, mgr, "WHEN WILL YOU * BODY", "", "", "body")
+
+	// _ > word > *
+	util_ut.IsTrue(t, answerText(mgr, "I like pizza", nil) == "underscore")
+	util_ut.IsTrue(t, answerText(mgr, "I like pasta", nil) == "exact")
+	util_ut.IsTrue(t, answerText(mgr, "we like pasta", nil) == "star")
+	util_ut.IsTrue(t, answerText(mgr, "I like cheese", nil) == "word")
+
+	// backtracking out of an exact word, and into a longer wildcard
+	util_ut.IsTrue(t, answerText(mgr, "do you like dogs", nil) == "dogs")
+	util_ut.IsTrue(t, starTexts(mgr, "do you like dogs")[0] == "like")
+	stars := starTexts(mgr, "what sky is blue is blue")
+	util_ut.IsTrue(t, len(stars) == 1 && stars[0] == "sky is blue")
+
+	// # and ^ match zero or more words, * in the middle of a pattern one or more
+	stars = starTexts(mgr, "hello")
+	util_ut.IsTrue(t, len(stars) == 2 && stars[0] == "" && stars[1] == "")
+	stars = starTexts(mgr, "well hello there")
+	util_ut.IsTrue(t, len(stars) == 2 && stars[0] == "well" && stars[1] == "there")
+	util_ut.IsTrue(t, answerText(mgr, "good morning", nil) == "morning")
+	util_ut.IsTrue(t, answerText(mgr, "good sunny morning", nil) == "morning")
+	util_ut.IsTrue(t, answerText(mgr, "when will you body", nil) == "")
+
+	// the same input always gets the same match
+	for i := 0; i < 10; i++ {
+		util_ut.IsTrue(t, answerText(mgr, "I like pizza", nil) == "underscore")
+	}
+}
+
+// test reading the categories of the files, checking categories and the pattern of a match
+func TestAimlCategoryFiles1(t *testing.T) {
+	category_list, err := ReadCategoryFiles()
+	util_ut.Check(t, err)
+	module_set := make(map[string]bool, 0)
+	for _, category := range category_list {
+		module_set[category.Module] = true
+		util_ut.IsTrue(t, len(category.PatternList) > 0 && !util.IsEmpty(&category.Id))
+	}
+	util_ut.IsTrue(t, module_set["ai"] && module_set["date"] && module_set["search"])
+
+	valid := model.AimlCategory{Module: "test", PatternList: []string{"DO YOU * DOGS"}, Template: "Yes."}
+	util_ut.Check(t, ValidateCategory(valid))
+	invalid := valid
+	invalid.Module = "My Module"
+	util_ut.IsTrue(t, ValidateCategory(invalid) != nil)
+	invalid = valid
+	invalid.PatternList = []string{"(HI|HELLO)"}
+	util_ut.IsTrue(t, ValidateCategory(invalid) != nil)
+	invalid = valid
+	invalid.Template = "<srai>unclosed"
+	util_ut.IsTrue(t, ValidateCategory(invalid) != nil)
+
+	mgr := &AimlManager{}
+	snapshot := newSnapshot()
+	snapshot.addCategories([]model.AimlCategory{valid})
+	mgr.snapshot.Store(snapshot)
+	binding_list := mgr.MatchTokenList(tokenizer.Tokenize("do you like dogs?"))
+	util_ut.IsTrue(t, len(binding_list) == 1)
+	util_ut.IsTrue(t, binding_list[0].Pattern == "DO YOU * DOGS" && binding_list[0].Origin == "test module")
+}
+
+// test AIML categories stored in the db and changed while running
+func TestAimlCategories_db(t *testing.T) {
+	db_model.Delete_and_create_keyspace_for_unit_test("kai_ai_aiml_category_test")
+
+	// the first time the db is seeded with the files
+	mgr := &AimlManager{}
+	err := mgr.SetupDb()
+	util_ut.Check(t, err)
+	category_list, err := db_model.GetAimlCategoryList("")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(category_list) > 100)
+	util_ut.IsTrue(t, len(mgr.MatchTokenList(jsonToTokenList(t, activateTheRobot))) == 1)
+
+	// a new category, live after a reload
+	category := model.AimlCategory{Id: gocql.TimeUUID(), Module: "test", PatternList: []string{"DO YOU * DOGS"}, Template: "Yes."}
+	util_ut.Check(t, db_model.SaveAimlCategory(category))
+	util_ut.Check(t, mgr.Reload())
+	binding_list := mgr.MatchTokenList(tokenizer.Tokenize("do you like dogs"))
+	util_ut.IsTrue(t, len(binding_list) == 1 && binding_list[0].Text == "Yes.")
+	test_list, err := db_model.GetAimlCategoryList("test")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(test_list) == 1 && test_list[0].PatternList[0] == "DO YOU * DOGS")
+
+	// another instance sees the change once it's recorded
+	other := &AimlManager{use_db: true}
+	util_ut.Check(t, other.Reload())
+	util_ut.Check(t, db_model.DeleteAimlCategory("test", category.Id))
+	util_ut.Check(t, other.ReloadIfChanged())
+	util_ut.IsTrue(t, len(other.MatchTokenList(tokenizer.Tokenize("do you like dogs"))) == 1)
+	_, err = db_model.SaveAimlChange()
+	util_ut.Check(t, err)
+	util_ut.Check(t, other.ReloadIfChanged())
+	util_ut.IsTrue(t, len(other.MatchTokenList(tokenizer.Tokenize("do you like dogs"))) == 0)
+
+	util_ut.Check(t, mgr.Reload())
+	util_ut.IsTrue(t, len(mgr.MatchTokenList(tokenizer.Tokenize("do you like dogs"))) == 0)
+
+	db_model.Delete_keyspace_after_unit_test("kai_ai_aiml_category_test")
+}
+
+// the messages of a list of lint issues of a file, as "line: severity: message"
+func lintMessages(issue_list []LintIssue, filename string) []string {
+	message_list := make([]string, 0)
+	for _, issue := range issue_list {
+		if issue.File == filename {
+			message_list = append(message_list, strconv.Itoa(issue.Line) + ": " + issue.Severity + ": " + issue.Message)
+		}
+	}
+	return message_list
+}
+
+// test lint finds the mistakes of a set of files
+func TestAimlLint1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aiml")
+	util_ut.Check(t, err)
+	defer os.RemoveAll(dir)
+	one := dir + "/one.aiml"
+	two := dir + "/two.aiml"
+	broken := dir + "/broken.aiml"
+	util_ut.Check(t, util.SaveTextFile(one, `<aiml version="1.0">
+    <category>
+        <pattern>I LIKE PIZZA</pattern>
+        <template>Me too.</template>
+    </category>
+    <category>
+        <pattern>(HELLO|HI) ((THERE)</pattern>
+        <template>Hi.</template>
+    </category>
+    <category>
+        <pattern>WHAT IS THE WEATHER</pattern>
+        <template>{weather}</template>
+    </category>
+</aiml>
+`))
+	util_ut.Check(t, util.SaveTextFile(two, `<aiml version="1.0">
+    <category>
+        <pattern>_ LIKE PIZZA</pattern>
+        <template>Who doesn't?</template>
+    </category>
+    <category>
+        <pattern>WHAT IS THE WEATHER</pattern>
+        <template>Sunny, {date}.</template>
+    </category>
+</aiml>
+`))
+	util_ut.Check(t, util.SaveTextFile(broken, `<aiml version="1.0">
+    <category>
+        <pattern>GOOD MORNING</pattern>
+        <template>Morning.</li></template>
+    </category>
+</aiml>
+`))
+
+	issue_list := LintFiles([]string{one, two, broken})
+	one_list := lintMessages(issue_list, one)
+	util_ut.IsTrue(t, len(one_list) == 4)
+	util_ut.IsTrue(t, strings.HasPrefix(one_list[0], "2: warning: pattern \"I LIKE PIZZA\" is shadowed by \"_ LIKE PIZZA\""))
+	util_ut.IsTrue(t, one_list[1] == "2: warning: unreachable category, all its patterns are shadowed")
+	util_ut.IsTrue(t, one_list[2] == "6: error: pattern \"(HELLO|HI) ((THERE)\": nested brackets")
+	util_ut.IsTrue(t, one_list[3] == "10: warning: unknown template function {weather}")
+	two_list := lintMessages(issue_list, two)
+	util_ut.IsTrue(t, len(two_list) == 1 && strings.HasPrefix(two_list[0], "6: warning: pattern \"WHAT IS THE WEATHER\" is also in module one"))
+	broken_list := lintMessages(issue_list, broken)
+	util_ut.IsTrue(t, len(broken_list) == 1 && strings.HasPrefix(broken_list[0], "4: error: "))
+}
+
+// test lint of the categories of the db with the patterns of the kb schemas
+func TestAimlLint2(t *testing.T) {
+	pizza := model.AimlCategory{Id: gocql.TimeUUID(), Module: "food", PatternList: []string{"I LIKE PIZZA"}, Template: "Me too."}
+	any_pizza := model.AimlCategory{Id: gocql.TimeUUID(), Module: "chat", PatternList: []string{"_ LIKE PIZZA"}, Template: "Who doesn't?"}
+	boss := model.AimlCategory{Id: gocql.TimeUUID(), Module: "chat", PatternList: []string{"WHO IS THE BOSS"}, Template: "You are."}
+	schema := db_model.KBSchema{Id: gocql.TimeUUID(), Name: "staff", Origin: "peter", Field_list: []db_model.KBSchemaField{
+		{Name: "boss", Semantic: "person", Aiml: "WHO IS THE BOSS"}, {Name: "name", Semantic: "person"}}}
+
+	issue_list := LintDb([]model.AimlCategory{pizza, any_pizza, boss}, []db_model.KBSchema{schema})
+	message_list := make([]string, 0)
+	for _, issue := range issue_list {
+		message_list = append(message_list, issue.String())
+	}
+	util_ut.IsTrue(t, len(message_list) == 3)
+	util_ut.IsTrue(t, strings.HasPrefix(message_list[0], "aiml_category food/" + pizza.Id.String() +
+		": warning: pattern \"I LIKE PIZZA\" is shadowed by \"_ LIKE PIZZA\""))
+	util_ut.IsTrue(t, message_list[1] == "aiml_category food/" + pizza.Id.String() + ": warning: unreachable category, all its patterns are shadowed")
+	util_ut.IsTrue(t, message_list[2] == "kb_schema staff/boss: warning: pattern \"WHO IS THE BOSS\" is also in module chat " +
+		"(aiml_category chat/" + boss.Id.String() + "), their templates are merged")
+}
+
+// test template functions, registered and built in
+func TestAimlFunction1(t *testing.T) {
+	util_ut.Check(t, RegisterFunction("shout", func(arguments string, context FunctionContext) (string, error) {
+		return strings.ToUpper(arguments) + "!", nil
+	}))
+	util_ut.IsTrue(t, RegisterFunction("shout", starFunction) != nil)
+	util_ut.IsTrue(t, RegisterFunction("Not Valid", starFunction) != nil)
+	util_ut.IsTrue(t, isMagicValue("shout") && isMagicValue("search") && !isMagicValue("weather"))
+
+	binding := model.AimlBinding{StarList: [][]model.Token{tokenizer.Tokenize("red"), tokenizer.Tokenize("green")}}
+	context := FunctionContext{Binding: binding, Email: "peter@peter.co.nz"}
+	util_ut.IsTrue(t, replaceFunctions("{shout:hello} {SHOUT: there }", context) == "HELLO! THERE!")
+	util_ut.IsTrue(t, replaceFunctions("{star} and {star:2}, {star:3}.", context) == "red and green, .")
+	util_ut.IsTrue(t, replaceFunctions("{email}", context) == "your email address is peter@peter.co.nz")
+	util_ut.IsTrue(t, replaceFunctions("{year}", context) == strconv.Itoa(time.Now().Year()))
+
+	// unknown functions and failing functions are left alone
+	util_ut.IsTrue(t, replaceFunctions("{weather} {star:x} {date:+3x}", context) == "{weather} {star:x} {date:+3x}")
+
+	// date offsets
+	offset, err := parseOffset("+3d")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, offset == 72 * time.Hour)
+	offset, err = parseOffset("-1w")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, offset == -7 * 24 * time.Hour)
+	_, err = parseOffset("3")
+	util_ut.IsTrue(t, err != nil)
+	date, err := time.Parse(time.RFC850, replaceFunctions("{date:+2d}", context))
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, date.Sub(time.Now()) > 47 * time.Hour && date.Sub(time.Now()) < 49 * time.Hour)
+
+	// statistics
+	stats := &db_model.SystemStatistics{Users: 2, Factoids: 30, Topics: 4, KBEntries: 5, IndexEntries: 600}
+	text, err := formatStatistics(stats, 26 * time.Hour + 5 * time.Minute, "")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, text == "2 users, 30 factoids, 4 topics, 5 knowledge base entries, 600 index entries, up for 1 day, 2 hours and 5 minutes")
+	text, err = formatStatistics(stats, time.Minute, "Factoids")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, text == "30")
+	_, err = formatStatistics(stats, time.Minute, "weather")
+	util_ut.IsTrue(t, err != nil)
+	util_ut.IsTrue(t, formatUptime(3 * time.Hour) == "3 hours and 0 minutes" && formatUptime(time.Minute) == "1 minute")
+	_, err = kbCountFunction("", context)
+	util_ut.IsTrue(t, err != nil)
+}
+
+// the texts of the templates matching text
+func matchTexts(mgr *AimlManager, text string) []string {
+	text_list := make([]string, 0)
+	for _, binding := range mgr.MatchTokenList(tokenizer.Tokenize(text)) {
+		text_list = append(text_list, binding.Text)
+	}
+	return text_list
+}
+
+// test schema patterns are changed in a new snapshot, sharing what didn't change
+func TestAimlSnapshot1(t *testing.T) {
+	mgr := &AimlManager{}
+	addCategory(t, mgr, "WHERE IS THE BANK", "", "", "Around the corner.")
+	addCategory(t, mgr, "HELLO THERE", "", "", "Hi.")
+
+	schema := db_model.KBSchema{Id: gocql.TimeUUID(), Name: "address", Origin: "peter",
+		Field_list: []db_model.KBSchemaField{{Name: "name", Aiml: "who is *?\n"}, {Name: "location"}}}
+	before := mgr.patterns()
+	util_ut.IsTrue(t, mgr.UpdateSchema(schema))
+	after := mgr.patterns()
+	text_list := matchTexts(mgr, "who is Peter?")
+	util_ut.IsTrue(t, len(text_list) == 1 && text_list[0] == "db_search:address:name")
+
+	// the old snapshot is as it was, what didn't change is shared
+	util_ut.IsTrue(t, before.root.NodeSet["who"] == nil && len(before.schema_map) == 0)
+	util_ut.IsTrue(t, before.root.NodeSet["hello"] == after.root.NodeSet["hello"])
+
+	// the same patterns, nothing to do
+	schema.Field_list[1].Semantic = "location"
+	util_ut.IsTrue(t, !mgr.UpdateSchema(schema))
+	util_ut.IsTrue(t, mgr.patterns() == after)
+
+	// a new version replaces the old patterns, leaving the categories alone
+	schema.Field_list[0].Aiml = "where is *"
+	util_ut.IsTrue(t, mgr.UpdateSchema(schema))
+	util_ut.IsTrue(t, len(matchTexts(mgr, "who is Peter?")) == 0)
+	util_ut.IsTrue(t, mgr.patterns().root.NodeSet["who"] == nil)
+	text_list = matchTexts(mgr, "where is Peter")
+	util_ut.IsTrue(t, len(text_list) == 1 && text_list[0] == "db_search:address:name")
+	text_list = matchTexts(mgr, "where is the bank")
+	util_ut.IsTrue(t, len(text_list) == 1 && text_list[0] == "Around the corner.")
+
+	// removed, the nodes it alone needed go with it
+	mgr.RemoveSchema(schema.Id)
+	util_ut.IsTrue(t, len(matchTexts(mgr, "where is Peter")) == 0)
+	util_ut.IsTrue(t, len(mgr.patterns().root.NodeSet["where"].NodeSet["is"].NodeSet) == 1)
+	util_ut.IsTrue(t, len(matchTexts(mgr, "where is the bank")) == 1)
+	util_ut.IsTrue(t, len(mgr.patterns().schema_map) == 0)
+
+	// a change recorded here isn't reloaded, unless another instance changed the patterns before it
+	first, second, third := gocql.TimeUUID(), gocql.TimeUUID(), gocql.TimeUUID()
+	mgr.ChangeRecorded(gocql.UUID{}, first)
+	util_ut.IsTrue(t, mgr.change == first)
+	mgr.ChangeRecorded(second, third)
+	util_ut.IsTrue(t, mgr.change == first)
+}
+
+// test matches carry on while the patterns change
+func TestAimlSnapshot2(t *testing.T) {
+	mgr := &AimlManager{}
+	addCategory(t, mgr, "HELLO THERE", "", "", "Hi.")
+	schema := db_model.KBSchema{Id: gocql.TimeUUID(), Name: "address", Origin: "peter",
+		Field_list: []db_model.KBSchemaField{{Name: "name", Aiml: "who is *"}}}
+
+	var wait_group sync.WaitGroup
+	failed := make(chan string, 10)
+	for i := 0; i < 4; i++ {
+		wait_group.Add(1)
+		go func() {
+			defer wait_group.Done()
+			for j := 0; j < 200; j++ {
+				if text_list := matchTexts(mgr, "hello there"); len(text_list) != 1 || text_list[0] != "Hi." {
+					failed <- "hello there"
+					return
+				}
+				if len(matchTexts(mgr, "who is Peter")) > 1 {
+					failed <- "who is Peter"
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		schema.Field_list[0].Aiml = "who is *\nwhat is " + strconv.Itoa(i) + " *"
+		mgr.UpdateSchema(schema)
+		if i % 10 == 0 {
+			mgr.RemoveSchema(schema.Id)
+		}
+	}
+	wait_group.Wait()
+	close(failed)
+	for text := range failed {
+		t.Error("unexpected match for " + text)
+	}
+	text_list := matchTexts(mgr, "what is 99 this")
+	util_ut.IsTrue(t, len(text_list) == 1 && text_list[0] == "db_search:address:name")
+	util_ut.IsTrue(t, len(matchTexts(mgr, "what is 98 this")) == 0)
+}
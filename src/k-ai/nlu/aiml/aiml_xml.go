@@ -18,12 +18,39 @@ type Categories struct {
 	XMLName xml.Name	`xml:"aiml"`
 	Version string   	`xml:"version,attr"`
 	Cats []Category		`xml:"category"`
+	TopicList []Topic	`xml:"topic"`
+}
+
+// <topic name="..."> categories that only apply to a topic
+type Topic struct {
+	Name string			`xml:"name,attr"`
+	Cats []Category		`xml:"category"`
 }
 
 type Category struct {
 	XMLName xml.Name 		`xml:"category"`
-	Template string			`xml:"template"`
+	Template Template		`xml:"template"`
  	PatternList []string 	`xml:"pattern"`
+	That string				`xml:"that"`
+	Topic string			`xml:"topic"`
 }
 
+// a template is kept as xml, its tags are evaluated when it is used (see aiml_template.go)
+type Template struct {
+	Xml string				`xml:",innerxml"`
+}
 
+// all categories of a file, with the topic of each category set from its <topic> if it has one
+func (c Categories) CategoryList() []Category {
+	category_list := make([]Category, 0)
+	category_list = append(category_list, c.Cats...)
+	for _, topic := range c.TopicList {
+		for _, cat := range topic.Cats {
+			if len(cat.Topic) == 0 {
+				cat.Topic = topic.Name
+			}
+			category_list = append(category_list, cat)
+		}
+	}
+	return category_list
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package anaphora
+
+import (
+	"math"
+	"time"
+	"strings"
+	"sync"
+	"k-ai/nlu/model"
+)
+
+//
+// Conversation context
+//
+// Each session keeps its last n turns (questions, answers and taught statements) so that
+// pronouns in a new turn can be resolved against what was said before, e.g.
+// "Who is Peter?" followed by "Where does he live?"
+// Sessions don't say when they're done, so a discourse unused for DiscourseTimeout is forgotten.
+//
+
+// default number of turns kept per session
+const DefaultDiscourseSize = 4
+
+// how long the discourse of a session is kept after it was last used
+const DiscourseTimeout = time.Hour
+
+// a referent available in a turn, and its Lappin-Leass salience within that turn
+type DiscourseReferent struct {
+	Text     string  `json:"text"`
+	Salience float64 `json:"salience"`
+}
+
+// a single turn of the conversation
+type DiscourseTurn struct {
+	Sentence     model.Sentence      `json:"sentence"`
+	IsAnswer     bool                `json:"is_answer"`     // K/AI's answer or the user's input
+	ReferentList []DiscourseReferent `json:"referent_list"` // nouns that can be referred to later
+}
+
+// the discourse model of a single session
+type Discourse struct {
+	turn_list []DiscourseTurn
+	n_turns   int       // maximum number of turns to keep
+	last_used time.Time // when it was last asked for, see DiscourseSet.Get
+
+	sync.Mutex
+}
+
+// all sessions' discourse models
+type DiscourseSet struct {
+	discourse_map map[string]*Discourse
+	last_sweep    time.Time // when unused discourses were last removed
+
+	sync.Mutex
+}
+
+// the referents of a sentence (its nouns) with their salience as the current sentence
+func (ll LappinLeass) getReferentList(sentence model.Sentence) []DiscourseReferent {
+	referent_list := make([]DiscourseReferent, 0)
+	seen_existential := false
+	for i, t_token := range sentence.TokenList {
+		if t_token.Tag == "EX" {
+			seen_existential = true
+		}
+		if strings.HasPrefix(t_token.Tag, "NN") {
+			salience := ll.calculateSalience(seen_existential, &t_token, i, sentence)
+			referent_list = append(referent_list, DiscourseReferent{Text: t_token.Text, Salience: salience})
+		}
+	}
+	return referent_list
+}
+
+// add a new turn to the discourse, dropping the oldest turn if there are too many
+func (d *Discourse) AddTurn(sentence model.Sentence, is_answer bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	turn := DiscourseTurn{Sentence: sentence, IsAnswer: is_answer, ReferentList: LL.getReferentList(sentence)}
+	d.turn_list = append(d.turn_list, turn)
+	if len(d.turn_list) > d.n_turns {
+		d.turn_list = d.turn_list[len(d.turn_list) - d.n_turns:]
+	}
+}
+
+// return the sentences of the discourse, oldest first, for pronoun resolution
+func (d *Discourse) GetSentenceList() model.SentenceList {
+	d.Lock()
+	defer d.Unlock()
+
+	sentence_list := make(model.SentenceList, 0)
+	for _, turn := range d.turn_list {
+		sentence_list = append(sentence_list, turn.Sentence)
+	}
+	return sentence_list
+}
+
+// return a copy of the turns of the discourse, oldest first
+// the salience of each referent is halved for each sentence boundary between its turn and the next one,
+// as it would be in find_pronouns
+func (d *Discourse) GetTurnList() []DiscourseTurn {
+	d.Lock()
+	defer d.Unlock()
+
+	turn_list := make([]DiscourseTurn, 0)
+	for i, turn := range d.turn_list {
+		dropoff := math.Pow(2.0, float64(i - len(d.turn_list)))
+		referent_list := make([]DiscourseReferent, 0)
+		for _, referent := range turn.ReferentList {
+			referent_list = append(referent_list, DiscourseReferent{Text: referent.Text, Salience: referent.Salience * dropoff})
+		}
+		turn_list = append(turn_list, DiscourseTurn{Sentence: turn.Sentence, IsAnswer: turn.IsAnswer, ReferentList: referent_list})
+	}
+	return turn_list
+}
+
+// remove all turns
+func (d *Discourse) Reset() {
+	d.Lock()
+	defer d.Unlock()
+	d.turn_list = make([]DiscourseTurn, 0)
+}
+
+// get (or create) the discourse model for a session
+// now and then the discourses not used for DiscourseTimeout are removed
+func (ds *DiscourseSet) Get(session string) *Discourse {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if ds.discourse_map == nil {
+		ds.discourse_map = make(map[string]*Discourse, 0)
+	}
+	now := time.Now()
+	if now.Sub(ds.last_sweep) > DiscourseTimeout / 10 {
+		ds.removeUnused(now)
+	}
+	discourse, ok := ds.discourse_map[session]
+	if !ok {
+		discourse = &Discourse{turn_list: make([]DiscourseTurn, 0), n_turns: DefaultDiscourseSize}
+		ds.discourse_map[session] = discourse
+	}
+	discourse.Lock()
+	discourse.last_used = now
+	discourse.Unlock()
+	return discourse
+}
+
+// remove the discourses not used for DiscourseTimeout, the set must be locked
+func (ds *DiscourseSet) removeUnused(now time.Time) {
+	for session, discourse := range ds.discourse_map {
+		discourse.Lock()
+		last_used := discourse.last_used
+		discourse.Unlock()
+		if now.Sub(last_used) > DiscourseTimeout {
+			delete(ds.discourse_map, session)
+		}
+	}
+	ds.last_sweep = now
+}
+
+// forget the discourse of a session
+func (ds *DiscourseSet) Reset(session string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if ds.discourse_map != nil {
+		delete(ds.discourse_map, session)
+	}
+}
+
+// the discourse models of all sessions
+var Discourses DiscourseSet
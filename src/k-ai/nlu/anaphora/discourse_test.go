@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package anaphora
+
+import (
+	"time"
+	"testing"
+	"k-ai/nlu/model"
+	"k-ai/util_ut"
+)
+
+// Who is Peter?
+const whoIsPeter = `[{"tokenList":[{"index":0,"list":[1],"tag":"WP","text":"Who","dep":"attr","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBZ","text":"is","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[1],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"male"},{"index":3,"list":[1],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// Where does he live?
+const whereDoesHeLive = `[{"tokenList":[{"index":0,"list":[3],"tag":"WRB","text":"Where","dep":"advmod","synid":-1,"semantic":""},{"index":1,"list":[3],"tag":"VBZ","text":"does","dep":"aux","synid":-1,"semantic":""},{"index":2,"list":[3],"tag":"PRP","text":"he","dep":"nsubj","synid":-1,"semantic":""},{"index":3,"list":[],"tag":"VB","text":"live","dep":"ROOT","synid":-1,"semantic":""},{"index":4,"list":[3],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// test pronouns are resolved against an earlier turn
+func TestDiscourse1(t *testing.T) {
+	discourse := Discourses.Get("test-session-1")
+	defer Discourses.Reset("test-session-1")
+
+	discourse.AddTurn(jsonToSentenceList(t, whoIsPeter)[0], false)
+	context_list := discourse.GetSentenceList()
+	util_ut.IsTrue(t, len(context_list) == 1)
+
+	sentence_list := jsonToSentenceList(t, whereDoesHeLive)
+	util_ut.IsTrue(t, LL.ResolvePronounsWithContext(context_list, sentence_list) == 1)
+	checkPronounReference(t, sentence_list, "Peter", "he")
+
+	// the context itself is left alone
+	util_ut.IsTrue(t, len(context_list[0].TokenList) == 4)
+}
+
+// test without context nothing is resolved
+func TestDiscourse2(t *testing.T) {
+	sentence_list := jsonToSentenceList(t, whereDoesHeLive)
+	LL.ResolvePronounsWithContext(model.SentenceList{}, sentence_list)
+	checkPronounReference(t, sentence_list, "?", "he")
+}
+
+// test the number of turns is limited, and reset
+func TestDiscourse3(t *testing.T) {
+	discourse := Discourses.Get("test-session-3")
+	defer Discourses.Reset("test-session-3")
+
+	for i := 0; i < DefaultDiscourseSize + 2; i++ {
+		discourse.AddTurn(jsonToSentenceList(t, whoIsPeter)[0], i % 2 == 1)
+	}
+	turn_list := discourse.GetTurnList()
+	util_ut.IsTrue(t, len(turn_list) == DefaultDiscourseSize)
+	util_ut.IsTrue(t, len(turn_list[0].ReferentList) == 1 && turn_list[0].ReferentList[0].Text == "Peter")
+
+	// the salience is Lappin-Leass', halved for each turn further back
+	sentence := jsonToSentenceList(t, whoIsPeter)[0]
+	salience := LL.calculateSalience(false, &sentence.TokenList[2], 2, sentence)
+	last := turn_list[len(turn_list) - 1].ReferentList[0].Salience
+	util_ut.IsTrue(t, salience > 0.0 && last == salience * 0.5)
+	util_ut.IsTrue(t, turn_list[len(turn_list) - 2].ReferentList[0].Salience == last * 0.5)
+
+	discourse.Reset()
+	util_ut.IsTrue(t, len(discourse.GetSentenceList()) == 0)
+
+	// a reset session starts afresh
+	Discourses.Reset("test-session-3")
+	util_ut.IsTrue(t, Discourses.Get("test-session-3") != discourse)
+}
+
+// test the discourses of sessions no longer used are forgotten
+func TestDiscourse4(t *testing.T) {
+	discourse := Discourses.Get("test-session-4")
+	defer Discourses.Reset("test-session-4")
+	discourse.AddTurn(jsonToSentenceList(t, whoIsPeter)[0], false)
+
+	// used a while ago, but not long enough ago to be forgotten
+	discourse.last_used = time.Now().Add(-DiscourseTimeout / 2)
+	Discourses.last_sweep = time.Time{}
+	util_ut.IsTrue(t, Discourses.Get("test-session-5") != nil)
+	util_ut.IsTrue(t, Discourses.discourse_map["test-session-4"] == discourse)
+	Discourses.Reset("test-session-5")
+
+	// unused for too long
+	discourse.last_used = time.Now().Add(-2 * DiscourseTimeout)
+	Discourses.last_sweep = time.Time{}
+	Discourses.Get("test-session-5")
+	Discourses.Reset("test-session-5")
+	_, ok := Discourses.discourse_map["test-session-4"]
+	util_ut.IsTrue(t, !ok)
+	util_ut.IsTrue(t, len(Discourses.Get("test-session-4").GetSentenceList()) == 0)
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package anaphora
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"encoding/json"
+	"k-ai/nlu/model"
+	"k-ai/util"
+)
+
+//
+// Anaphora evaluation
+//
+// An annotated corpus is a json list of entries, each with a piece of text, its gold
+// pronoun -> referent links, and optionally the recorded parse of the text (so the
+// evaluation can run without a parser).  A link with an empty referent list marks a
+// pronoun that doesn't refer to anything (e.g. "it is raining").  Pronouns without a link
+// are not scored.
+//
+// Each entry is parsed, its pronouns resolved, and the results scored per pronoun class
+// (masculine, feminine, neuter, plural):
+//   precision: correctly resolved / resolved
+//   recall:    correctly resolved / pronouns with a gold referent
+//
+
+// the pronoun classes scored
+const (
+	ClassMasculine = "masculine"
+	ClassFeminine  = "feminine"
+	ClassNeuter    = "neuter"
+	ClassPlural    = "plural"
+)
+
+// a gold pronoun -> referent link, by the pronoun's token index
+type GoldLink struct {
+	Index        int      `json:"index"`
+	Pronoun      string   `json:"pronoun"`
+	ReferentList []string `json:"referent_list"` // more than one for a group, empty if none
+}
+
+// an entry of an annotated corpus
+type CorpusEntry struct {
+	Text     string             `json:"text"`
+	LinkList []GoldLink         `json:"link_list"`
+	Parse    model.SentenceList `json:"parse,omitempty"` // the recorded parse of Text
+}
+
+// a parser for the evaluation, returns the parse of an entry's text
+type ParseFunc func(entry CorpusEntry) (model.SentenceList, error)
+
+// the scores of a pronoun class
+type ClassScore struct {
+	Class     string  `json:"class"`
+	Gold      int     `json:"gold"`      // pronouns with a gold referent
+	Resolved  int     `json:"resolved"`  // pronouns the resolver gave a referent
+	Correct   int     `json:"correct"`   // resolved to the gold referent
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+}
+
+// a pronoun the resolver got wrong
+type EvaluationError struct {
+	Text     string `json:"text"`
+	Pronoun  string `json:"pronoun"`
+	Index    int    `json:"index"`
+	Expected string `json:"expected"`
+	Got      string `json:"got"`
+}
+
+// the result of evaluating a corpus
+type EvaluationResult struct {
+	ClassList []ClassScore      `json:"class_list"`
+	Overall   ClassScore        `json:"overall"`
+	ErrorList []EvaluationError `json:"error_list"`
+}
+
+// the class of a pronoun
+func (pr LLPronoun) class() string {
+	if pr.number == "p" {
+		return ClassPlural
+	} else if pr.containsSemantic("male") {
+		return ClassMasculine
+	} else if pr.containsSemantic("female") {
+		return ClassFeminine
+	}
+	return ClassNeuter
+}
+
+// load an annotated corpus from file
+func LoadCorpus(filename string) ([]CorpusEntry, error) {
+	file_contents, err := util.LoadTextFile(filename)
+	if err != nil { return nil, err }
+	corpus := make([]CorpusEntry, 0)
+	err = json.Unmarshal([]byte(file_contents), &corpus)
+	if err != nil { return nil, errors.New(filename + ": " + err.Error()) }
+	return corpus, nil
+}
+
+// save an annotated corpus (e.g. with newly recorded parses) to file
+func SaveCorpus(filename string, corpus []CorpusEntry) error {
+	json_bytes, err := json.MarshalIndent(corpus, "", "  ")
+	if err != nil { return err }
+	return util.SaveTextFile(filename, string(json_bytes))
+}
+
+// the parser that uses the recorded parse of an entry
+func RecordedParse(entry CorpusEntry) (model.SentenceList, error) {
+	if len(entry.Parse) == 0 {
+		return nil, errors.New("no recorded parse for \"" + entry.Text + "\"")
+	}
+	// copy the parse, so resolving it leaves the corpus alone
+	json_bytes, err := json.Marshal(entry.Parse)
+	if err != nil { return nil, err }
+	sentence_list := make(model.SentenceList, 0)
+	err = json.Unmarshal(json_bytes, &sentence_list)
+	return sentence_list, err
+}
+
+// is a resolved pronoun resolved to the gold referent(s)? (case insensitive, any order for groups)
+func sameReferents(gold_list []string, referent_list []string) bool {
+	if len(gold_list) != len(referent_list) {
+		return false
+	}
+	gold_set := make(map[string]bool, 0)
+	for _, gold := range gold_list {
+		gold_set[strings.ToLower(gold)] = true
+	}
+	for _, referent := range referent_list {
+		if !gold_set[strings.ToLower(referent)] {
+			return false
+		}
+	}
+	return true
+}
+
+// the text of a list of referents, "?" for none
+func referentText(referent_list []string) string {
+	if len(referent_list) == 0 {
+		return "?"
+	}
+	return groupText(referent_list)
+}
+
+// divide, or 1 if there's nothing to divide by (nothing to get wrong)
+func ratio(n int, d int) float64 {
+	if d == 0 {
+		return 1.0
+	}
+	return float64(n) / float64(d)
+}
+
+// parse and resolve each entry of a corpus and score the resolutions against the gold links
+func (ll LappinLeass) Evaluate(corpus []CorpusEntry, parse ParseFunc) (EvaluationResult, error) {
+	score_map := make(map[string]*ClassScore, 0)
+	for _, class := range []string{ClassMasculine, ClassFeminine, ClassNeuter, ClassPlural} {
+		score_map[class] = &ClassScore{Class: class}
+	}
+	result := EvaluationResult{ErrorList: make([]EvaluationError, 0)}
+
+	for _, entry := range corpus {
+		sentence_list, err := parse(entry)
+		if err != nil { return result, err }
+		ll.ResolvePronouns(sentence_list)
+
+		for _, link := range entry.LinkList {
+			var pronoun *model.Token
+			for s, sentence := range sentence_list {
+				for t, t_token := range sentence.TokenList {
+					if t_token.Index == link.Index {
+						pronoun = &sentence_list[s].TokenList[t]
+					}
+				}
+			}
+			if pronoun == nil {
+				return result, errors.New(fmt.Sprintf("\"%s\": no token with index %d", entry.Text, link.Index))
+			}
+			prp, ok := ll.pronoun_set[strings.ToLower(pronoun.Text)]
+			if !ok || (pronoun.Tag != "PRP" && pronoun.Tag != "PRP$") {
+				return result, errors.New(fmt.Sprintf("\"%s\": \"%s\" @ %d isn't a pronoun we resolve", entry.Text, pronoun.Text, link.Index))
+			}
+
+			score := score_map[prp.class()]
+			referent_list := pronoun.GetReferentList()
+			if len(link.ReferentList) > 0 {
+				score.Gold += 1
+			}
+			if len(referent_list) > 0 {
+				score.Resolved += 1
+			}
+			if len(referent_list) > 0 && sameReferents(link.ReferentList, referent_list) {
+				score.Correct += 1
+			} else if len(referent_list) > 0 || len(link.ReferentList) > 0 {
+				result.ErrorList = append(result.ErrorList, EvaluationError{Text: entry.Text, Pronoun: pronoun.Text,
+					Index: link.Index, Expected: referentText(link.ReferentList), Got: referentText(referent_list)})
+			}
+		}
+	}
+
+	result.Overall = ClassScore{Class: "overall"}
+	class_list := make([]string, 0)
+	for class := range score_map {
+		class_list = append(class_list, class)
+	}
+	sort.Strings(class_list)
+	for _, class := range class_list {
+		score := score_map[class]
+		score.Precision = ratio(score.Correct, score.Resolved)
+		score.Recall = ratio(score.Correct, score.Gold)
+		result.ClassList = append(result.ClassList, *score)
+		result.Overall.Gold += score.Gold
+		result.Overall.Resolved += score.Resolved
+		result.Overall.Correct += score.Correct
+	}
+	result.Overall.Precision = ratio(result.Overall.Correct, result.Overall.Resolved)
+	result.Overall.Recall = ratio(result.Overall.Correct, result.Overall.Gold)
+	return result, nil
+}
+
+// return an error if the overall precision or recall is below a threshold
+func (r EvaluationResult) CheckThreshold(min_precision float64, min_recall float64) error {
+	if r.Overall.Precision < min_precision {
+		return errors.New(fmt.Sprintf("anaphora precision %.3f below threshold %.3f", r.Overall.Precision, min_precision))
+	}
+	if r.Overall.Recall < min_recall {
+		return errors.New(fmt.Sprintf("anaphora recall %.3f below threshold %.3f", r.Overall.Recall, min_recall))
+	}
+	return nil
+}
+
+// a human readable report of the result
+func (r EvaluationResult) String() string {
+	str := fmt.Sprintf("%-10s %6s %9s %8s %10s %7s\n", "class", "gold", "resolved", "correct", "precision", "recall")
+	for _, score := range append(r.ClassList, r.Overall) {
+		str += fmt.Sprintf("%-10s %6d %9d %8d %10.3f %7.3f\n", score.Class, score.Gold, score.Resolved,
+			score.Correct, score.Precision, score.Recall)
+	}
+	for _, e := range r.ErrorList {
+		str += fmt.Sprintf("error: \"%s\": %s @ %d, expected %s, got %s\n", e.Text, e.Pronoun, e.Index, e.Expected, e.Got)
+	}
+	return str
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package anaphora
+
+import (
+	"testing"
+	"k-ai/util"
+	"k-ai/util_ut"
+)
+
+// regression thresholds for the bundled corpus, raise these when the resolver improves
+const (
+	minCorpusPrecision = 0.9
+	minCorpusRecall    = 0.9
+)
+
+// test the resolver doesn't get worse on the bundled corpus
+func TestEvaluateCorpus1(t *testing.T) {
+	corpus, err := LoadCorpus(util.GetDataPath() + "/anaphora/corpus.json")
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(corpus) > 0)
+
+	result, err := LL.Evaluate(corpus, RecordedParse)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, len(result.ClassList) == 4)
+	util_ut.IsTrue(t, result.Overall.Gold > 0)
+	err = result.CheckThreshold(minCorpusPrecision, minCorpusRecall)
+	if err != nil {
+		t.Error(err.Error() + "\n" + result.String())
+	}
+
+	// evaluating leaves the recorded parses alone
+	for _, entry := range corpus {
+		for _, sentence := range entry.Parse {
+			for _, t_token := range sentence.TokenList {
+				util_ut.IsTrue(t, len(t_token.Anaphora) == 0)
+			}
+		}
+	}
+}
+
+// test the scoring of a single entry
+func TestEvaluate1(t *testing.T) {
+	sentence_list := jsonToSentenceList(t, peterAndSherry)
+	corpus := []CorpusEntry{{Text: "Peter and Sherry went to the beach.  They watched the boats.", Parse: sentence_list,
+		LinkList: []GoldLink{{Index: 8, Pronoun: "They", ReferentList: []string{"sherry", "peter"}}}}}
+	result, err := LL.Evaluate(corpus, RecordedParse)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, result.Overall.Gold == 1 && result.Overall.Correct == 1 && len(result.ErrorList) == 0)
+	util_ut.IsTrue(t, result.ClassList[3].Class == ClassPlural && result.ClassList[3].Precision == 1.0)
+
+	// a wrong gold referent
+	corpus[0].LinkList[0].ReferentList = []string{"boats"}
+	result, err = LL.Evaluate(corpus, RecordedParse)
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, result.Overall.Correct == 0 && len(result.ErrorList) == 1)
+	util_ut.IsTrue(t, result.ErrorList[0].Got == "Peter and Sherry")
+	util_ut.IsTrue(t, result.CheckThreshold(0.5, 0.0) != nil)
+
+	// links must point at pronouns
+	corpus[0].LinkList[0].Index = 9
+	_, err = LL.Evaluate(corpus, RecordedParse)
+	util_ut.IsTrue(t, err != nil)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package anaphora
+
+import (
+	"strings"
+	"k-ai/nlu/model"
+)
+
+//
+// Explain anaphora resolution
+//
+// For each pronoun: the candidate referents considered, best first, each with the salience
+// factors that applied to it and the drop-off for the number of sentences back.
+//
+
+// a candidate referent for a pronoun
+type LLCandidate struct {
+	Text          string             `json:"text"`
+	TextList      []string           `json:"text_list,omitempty"` // the members of a group referent
+	Semantic      string             `json:"semantic"`       // the semantic used for agreement
+	SentenceIndex int                `json:"sentence_index"` // offset into the sentence list
+	TokenIndex    int                `json:"token_index"`    // offset into the sentence's token list
+	FactorList    []LLSalienceFactor `json:"factor_list"`
+	Dropoff       float64            `json:"dropoff"`        // multiplier for the distance to the pronoun
+	Salience      float64            `json:"salience"`       // sum of the factor weights times the drop-off
+}
+
+// how a pronoun was resolved
+type LLExplanation struct {
+	Pronoun       string        `json:"pronoun"`
+	SentenceIndex int           `json:"sentence_index"`
+	TokenIndex    int           `json:"token_index"`
+	Number        string        `json:"number"`    // s or p
+	Semantics     []string      `json:"semantics"` // the semantics the pronoun agrees with
+	Anaphora      string        `json:"anaphora"`  // what it resolved to, "?" if nothing
+	CandidateList []LLCandidate `json:"candidate_list"`
+}
+
+// explain the resolution of each pronoun in a sentence list, without changing the sentences
+func (ll LappinLeass) ExplainPronouns(sentence_list model.SentenceList) []LLExplanation {
+	return ll.explainPronounsFrom(0, sentence_list)
+}
+
+// explain the resolution of each pronoun in a sentence list given earlier sentences of the conversation
+// sentence indexes in the explanation are relative to the start of context_list
+func (ll LappinLeass) ExplainPronounsWithContext(context_list model.SentenceList, sentence_list model.SentenceList) []LLExplanation {
+	combined_list := make(model.SentenceList, 0)
+	combined_list = append(combined_list, context_list...)
+	combined_list = append(combined_list, sentence_list...)
+	return ll.explainPronounsFrom(len(context_list), combined_list)
+}
+
+// explain the pronouns of sentence_list[start:] using all sentences of sentence_list as referents
+func (ll LappinLeass) explainPronounsFrom(start int, sentence_list model.SentenceList) []LLExplanation {
+	explanation_list := make([]LLExplanation, 0)
+	for s_index := start; s_index < len(sentence_list); s_index++ {
+		for index, t_token := range sentence_list[s_index].TokenList {
+			if t_token.Tag != "PRP" && t_token.Tag != "PRP$" {
+				continue
+			}
+			prp, ok := ll.pronoun_set[strings.ToLower(t_token.Text)]
+			if !ok {
+				continue
+			}
+			explanation := LLExplanation{Pronoun: t_token.Text, SentenceIndex: s_index, TokenIndex: index,
+				Number: prp.number, Semantics: prp.semantics, Anaphora: "?", CandidateList: make([]LLCandidate, 0)}
+			referent_list := ll.find_pronouns(&prp, s_index, index, sentence_list)
+			if len(referent_list) > 0 {
+				explanation.Anaphora = referent_list[0].anaphora
+			}
+			for _, referent := range referent_list {
+				explanation.CandidateList = append(explanation.CandidateList, LLCandidate{Text: referent.anaphora,
+					TextList: referent.anaphora_list, Semantic: referent.semantic, SentenceIndex: referent.s_index, TokenIndex: referent.t_index,
+					FactorList: referent.factor_list, Dropoff: referent.dropoff, Salience: referent.salience})
+			}
+			explanation_list = append(explanation_list, explanation)
+		}
+	}
+	return explanation_list
+}
@@ -12,10 +12,15 @@
 package anaphora
 
 import (
+	"errors"
 	"strings"
+	"strconv"
 	"math"
 	"sort"
 	"k-ai/nlu/model"
+	"k-ai/nlu/lexicon"
+	"k-ai/util"
+	"k-ai/logger"
 )
 
 //
@@ -50,16 +55,72 @@ import (
 // Previous mentions can boost the salience of a coreference class
 // This accounts for the repetition effect
 // Lappin and Leass report 86% accuracy for their algorithm on a corpus of Computer manuals
+//
+// The weights, the number of sentences to look back and the pronouns are read from
+// data/anaphora/lappin_leass.txt, without it the defaultSettings below are used
+
+
+// the salience factors, as named in the settings file
+const (
+	FactorCurrentSentence = "current_sentence"
+	FactorExistential     = "existential"
+	FactorSubject         = "subject"
+	FactorAccusative      = "accusative"
+	FactorIndirectObject  = "indirect_object"
+	FactorAdverbial       = "adverbial"
+	FactorHeadNoun        = "head_noun"
+)
 
+// all salience factors, a weight for anything else is a mistake in the settings file
+var salienceFactors = []string{FactorCurrentSentence, FactorExistential, FactorSubject, FactorAccusative,
+	FactorIndirectObject, FactorAdverbial, FactorHeadNoun}
+
+// the settings used when the settings file can't be read, the same as the one that comes with K/AI
+const defaultSettings = `n_back:4
+weight:current_sentence:100
+weight:existential:70
+weight:subject:80
+weight:accusative:50
+weight:indirect_object:40
+weight:adverbial:50
+weight:head_noun:80
+pronoun:he:s:male,person
+pronoun:him:s:male,person
+pronoun:himself:s:male,person
+pronoun:his:s:male,person
+pronoun:she:s:female,person
+pronoun:her:s:female,person
+pronoun:herself:s:female,person
+pronoun:hers:s:female,person
+pronoun:it:s:other
+pronoun:itself:s:other
+pronoun:its:s:other
+pronoun:they:p:male,female,person,other
+pronoun:them:p:male,female,person,other
+pronoun:themselves:p:male,female,person
+`
 
 type LappinLeass struct {
 	pronoun_set map[string]LLPronoun	// list of pronouns to look for in the text (ones we can resolve)
 	n_back int							// go back up to n-sentences in the list for resolution
+	weights map[string]float64			// salience factor -> weight
+}
+
+// a salience factor that applied to a referent and its weight
+type LLSalienceFactor struct {
+	Factor string  `json:"factor"`
+	Weight float64 `json:"weight"`
 }
 
 type LLReferent struct {
-	anaphora string			// the anaphora text resolved to
-	salience float64		// the salient score of the referent
+	anaphora string					// the anaphora text resolved to
+	anaphora_list []string			// the members of a group referent (e.g. "Peter and Sherry"), or nil
+	salience float64				// the salient score of the referent
+	semantic string					// the semantic used for agreement
+	s_index int						// the sentence of the referent
+	t_index int						// the token of the referent inside its sentence
+	factor_list []LLSalienceFactor	// the factors that make up its salience (before drop-off)
+	dropoff float64					// the salience multiplier for the distance to the pronoun
 }
 
 type LLReferentList []*LLReferent
@@ -94,31 +155,90 @@ func (pr LLPronoun) containsSemantic(semantic string) bool {
 }
 
 
+// setup empty settings, use LoadFromFile() to read the settings
 func (ll *LappinLeass) Init() {
 	ll.n_back = 4 // number of sentences to scan back for pronouns, default: 4
-
-	// setup a lookup map for valid 3rd person pronouns
+	ll.weights = make(map[string]float64, 0)
 	ll.pronoun_set = make(map[string]LLPronoun,0)
+}
+
+// load the weights and the valid 3rd person pronouns from a settings file
+func (ll *LappinLeass) LoadFromFile(filename string) error {
+	file_contents, err := util.LoadTextFile(filename)
+	if err != nil { return err }
+	return ll.loadSettings(filename, file_contents)
+}
 
-	ll.pronoun_set["he"] = LLPronoun{text: "he", number: "s", semantics: []string{"male","person"}}
-	ll.pronoun_set["she"] = LLPronoun{text: "she", number: "s", semantics: []string{"female","person"}}
-	ll.pronoun_set["it"] = LLPronoun{text: "it", number: "s", semantics: []string{"other"}}
+// use the defaultSettings
+func (ll *LappinLeass) LoadDefaults() {
+	err := ll.loadSettings("default settings", defaultSettings)
+	if err != nil {
+		panic(err) // a mistake in defaultSettings
+	}
+}
 
-	ll.pronoun_set["him"] = LLPronoun{text: "him", number: "s", semantics: []string{"male","person"}}
-	ll.pronoun_set["her"] = LLPronoun{text: "her", number: "s", semantics: []string{"female","person"}}
+// replace the settings with those of file_contents, filename is for reporting errors
+func (ll *LappinLeass) loadSettings(filename string, file_contents string) error {
+	ll.Init()
+	for i, line := range strings.Split(file_contents, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line_error := errors.New(filename + ":" + strconv.Itoa(i + 1) + ": invalid line \"" + line + "\"")
+		parts := strings.Split(line, ":")
+		switch parts[0] {
+		case "n_back":
+			if len(parts) != 2 { return line_error }
+			n_back, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || n_back < 0 { return line_error }
+			ll.n_back = n_back
+		case "weight":
+			if len(parts) != 3 { return line_error }
+			factor := strings.TrimSpace(parts[1])
+			if !isSalienceFactor(factor) {
+				return errors.New(filename + ":" + strconv.Itoa(i + 1) + ": unknown salience factor \"" + factor + "\"")
+			}
+			weight, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+			if err != nil { return line_error }
+			ll.weights[factor] = weight
+		case "pronoun":
+			if len(parts) != 4 { return line_error }
+			text := strings.ToLower(strings.TrimSpace(parts[1]))
+			number := strings.TrimSpace(parts[2])
+			if len(text) == 0 || (number != "s" && number != "p") { return line_error }
+			semantics := make([]string, 0)
+			for _, semantic := range strings.Split(parts[3], ",") {
+				if semantic = strings.TrimSpace(semantic); len(semantic) > 0 {
+					semantics = append(semantics, semantic)
+				}
+			}
+			ll.pronoun_set[text] = LLPronoun{text: text, number: number, semantics: semantics}
+		default:
+			return line_error
+		}
+	}
+	return nil
+}
 
-	ll.pronoun_set["himself"] = LLPronoun{text: "himself", number: "s", semantics: []string{"male","person"}}
-	ll.pronoun_set["herself"] = LLPronoun{text: "herself", number: "s", semantics: []string{"female","person"}}
-	ll.pronoun_set["itself"] = LLPronoun{text: "itself", number: "s", semantics: []string{"other"}}
+// is factor one of the salienceFactors?
+func isSalienceFactor(factor string) bool {
+	for _, known := range salienceFactors {
+		if factor == known {
+			return true
+		}
+	}
+	return false
+}
 
-	ll.pronoun_set["his"] = LLPronoun{text: "his", number: "s", semantics: []string{"male","person"}}
-	ll.pronoun_set["her"] = LLPronoun{text: "her", number: "s", semantics: []string{"female","person"}}
-	ll.pronoun_set["hers"] = LLPronoun{text: "hers", number: "s", semantics: []string{"female","person"}}
-	ll.pronoun_set["its"] = LLPronoun{text: "its", number: "s", semantics: []string{"other"}}
+// return the weight of a salience factor (0 if not set)
+func (ll LappinLeass) GetWeight(factor string) float64 {
+	return ll.weights[factor]
+}
 
-	ll.pronoun_set["they"] = LLPronoun{text: "they", number: "p", semantics: []string{"male", "female", "person", "other"}}
-	ll.pronoun_set["them"] = LLPronoun{text: "them", number: "p", semantics: []string{"male", "female", "person", "other"}}
-	ll.pronoun_set["themselves"] = LLPronoun{text: "themselves", number: "p", semantics: []string{"male", "female", "person"}}
+// set the weight of a salience factor
+func (ll *LappinLeass) SetWeight(factor string, weight float64) {
+	ll.weights[factor] = weight
 }
 
 // is the current "nsubj" Noun succeeded by another np? (a DET or IN, no verb)
@@ -156,49 +276,95 @@ func (ll LappinLeass) hasAdverbialEmphasis(index int, sentence model.Sentence) b
 }
 
 // calculate the salience value using grammatical constructs for a noun
-// is_last_sentence:  true if this sentence is the one with the pronoun
 // seen_existential:  true if this sentence thusfar has seen an EX tag
 // token: the noun token under investigation
 // index: its index into sentence
 // sentence: the sentence of this token
 func (ll LappinLeass) calculateSalience(seen_existential bool,
 										token *model.Token, index int, sentence model.Sentence) float64 {
-	// calculate salience
-	salience := 100.0  // basic score
+	return sumFactors(ll.getSalienceFactors(seen_existential, token, index, sentence))
+}
+
+// the salience of a set of factors
+func sumFactors(factor_list []LLSalienceFactor) float64 {
+	salience := 0.0
+	for _, factor := range factor_list {
+		salience += factor.Weight
+	}
+	return salience
+}
+
+// return the salience factors that apply to a noun (see calculateSalience)
+func (ll LappinLeass) getSalienceFactors(seen_existential bool,
+										 token *model.Token, index int, sentence model.Sentence) []LLSalienceFactor {
+	factor_list := make([]LLSalienceFactor, 0)
+	add := func(factor string) {
+		factor_list = append(factor_list, LLSalienceFactor{Factor: factor, Weight: ll.weights[factor]})
+	}
+	add(FactorCurrentSentence) // basic score
 	// have we seen an existential marker?
 	if seen_existential {
-		salience += 70.0
+		add(FactorExistential)
 	}
 	// subject?
 	if token.Dep == "nsubj" {
-		salience += 80
+		add(FactorSubject)
 	}
 	// accusative emphasis
 	if token.Dep == "dobj" {
-		salience += 50
+		add(FactorAccusative)
 	}
 	// indirect object
 	if token.Dep == "pobj" {
-		salience += 40
+		add(FactorIndirectObject)
 	}
 	// Adverbial emphasis (head verb (nsubj) is preceeded by another np)
 	if token.Dep == "nsubj" && ll.hasAdverbialEmphasis(index, sentence) {
-		salience += 50
+		add(FactorAdverbial)
 	}
 	// head noun emphases (head verb (nsubj is followed by another np)
 	if token.Dep == "nsubj" && ll.hasHeadNounEmphasis(index, sentence) {
-		salience += 80
+		add(FactorHeadNoun)
 	}
-	return salience
+	return factor_list
+}
+
+
+// return the semantic of a token for agreement purposes
+// people without a gender get one from the lexicon's names if possible, e.g. "Peter Smith" -> male
+func (ll LappinLeass) getSemantic(token *model.Token) string {
+	semantic := token.Semantic
+	if (semantic == "" || semantic == "person") && strings.HasPrefix(token.Tag, "NNP") {
+		for _, name := range []string{token.Text, strings.Split(token.Text, " ")[0]} {
+			name_semantic := lexicon.Lexi.GetSemantic(name)
+			if name_semantic == "male" || name_semantic == "female" {
+				return name_semantic
+			} else if name_semantic == "person" {
+				semantic = name_semantic
+			}
+		}
+	}
+	return semantic
 }
 
+// the semantic a pronoun agrees with: the nearest of male, female or person in the semantic hierarchy
+// (e.g. man -> male, ai -> person), or the semantic itself
+func agreementSemantic(semantic string) string {
+	for _, ancestor := range append([]string{semantic}, lexicon.Lexi.GetSemanticAncestors(semantic)...) {
+		if ancestor == "male" || ancestor == "female" || ancestor == "person" {
+			return ancestor
+		}
+	}
+	return semantic
+}
 
-// is this token semantically compatible with the pronoun?
-func (ll LappinLeass) isSemanticMatch(token *model.Token, pronoun *LLPronoun) bool {
-	if pronoun.containsSemantic(token.Semantic) { // otherwise - it must be one of its semantics
+// is a semantic compatible with the pronoun?
+func (ll LappinLeass) isSemanticMatch(semantic string, pronoun *LLPronoun) bool {
+	semantic = agreementSemantic(semantic)
+	if pronoun.containsSemantic(semantic) { // otherwise - it must be one of its semantics
 		return true
 	}
-	if token.Semantic == "male" || token.Semantic == "female" || token.Semantic == "person" {
+	if semantic == "male" || semantic == "female" || semantic == "person" {
 		return false
 	}
 	if pronoun.containsSemantic("other") {
@@ -217,6 +383,72 @@ func (ll LappinLeass) matchesNumber(token *model.Token, pronoun *LLPronoun) bool
 }
 
 
+// return the offset of the noun heading token_list[offset] or -1 if its head isn't a noun
+func headNoun(offset int, sentence model.Sentence) int {
+	t_token := sentence.TokenList[offset]
+	if len(t_token.AncestorList) > 0 {
+		for i, h_token := range sentence.TokenList {
+			if h_token.Index == t_token.AncestorList[0] && strings.HasPrefix(h_token.Tag, "NN") {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// return the offsets of the nouns of a coordinated noun phrase ("X and Y", "X, Y and Z")
+// headed by the noun at offset, in sentence order - or nil if it isn't the head of one
+func (ll LappinLeass) getGroup(offset int, sentence model.Sentence) []int {
+	if sentence.TokenList[offset].Dep == "conj" && headNoun(offset, sentence) >= 0 {
+		return nil // a member, not the head of a group
+	}
+	member_set := map[int]bool{offset: true}
+	for changed := true; changed; {
+		changed = false
+		for i, t_token := range sentence.TokenList {
+			if !member_set[i] && t_token.Dep == "conj" && strings.HasPrefix(t_token.Tag, "NN") {
+				if head := headNoun(i, sentence); head >= 0 && member_set[head] {
+					member_set[i] = true
+					changed = true
+				}
+			}
+		}
+	}
+	if len(member_set) < 2 {
+		return nil
+	}
+	member_list := make([]int, 0)
+	for i := range sentence.TokenList {
+		if member_set[i] {
+			member_list = append(member_list, i)
+		}
+	}
+	return member_list
+}
+
+// the semantic of a group: person if any of its members is a person, otherwise the members' common semantic
+func (ll LappinLeass) getGroupSemantic(member_list []int, sentence model.Sentence) string {
+	group_semantic := ll.getSemantic(&sentence.TokenList[member_list[0]])
+	for _, i := range member_list {
+		semantic := ll.getSemantic(&sentence.TokenList[i])
+		if lexicon.Lexi.IsA(semantic, "person") {
+			return "person"
+		}
+		if semantic != group_semantic {
+			group_semantic = ""
+		}
+	}
+	return group_semantic
+}
+
+// the text of a group, e.g. "Peter, Sherry and Mark"
+func groupText(text_list []string) string {
+	if len(text_list) == 1 {
+		return text_list[0]
+	}
+	return strings.Join(text_list[:len(text_list) - 1], ", ") + " and " + text_list[len(text_list) - 1]
+}
+
 // find suitable references to resolve pronoun
 // pronoun: the pronoun that needs resolving
 // s_index: the sentence index for the sentence to process
@@ -242,16 +474,37 @@ func (ll LappinLeass) find_pronouns(pronoun *LLPronoun, s_index int, t_index int
 				}
 				if strings.HasPrefix(t_token.Tag, "NN") { // noun
 					// is this of the right semantic for the pronoun?
-					if ll.isSemanticMatch(&t_token, pronoun) && ll.matchesNumber(&t_token, pronoun) {
+					semantic := ll.getSemantic(&t_token)
+					if ll.isSemanticMatch(semantic, pronoun) && ll.matchesNumber(&t_token, pronoun) {
 						// calculate its salience
-						salience := ll.calculateSalience(seen_existential, &t_token, i, sentence)
+						factor_list := ll.getSalienceFactors(seen_existential, &t_token, i, sentence)
 						// multiply with drop-off for farther away sentences
-						salience *= salient_dropoff
+						salience := sumFactors(factor_list) * salient_dropoff
 						// add new referent
-						referent_array = append(referent_array, &LLReferent{anaphora: t_token.Text, salience: salience})
+						referent_array = append(referent_array, &LLReferent{anaphora: t_token.Text, salience: salience,
+							semantic: semantic, s_index: sentence_id, t_index: i, factor_list: factor_list, dropoff: salient_dropoff})
 
 					} // if is semantic match
 
+					// coordinated noun phrases are a group that plural pronouns can refer to
+					if pronoun.number == "p" {
+						member_list := ll.getGroup(i, sentence)
+						if len(member_list) > 1 && (!is_last || member_list[len(member_list) - 1] < t_index) {
+							group_semantic := ll.getGroupSemantic(member_list, sentence)
+							if ll.isSemanticMatch(group_semantic, pronoun) {
+								text_list := make([]string, 0)
+								for _, m := range member_list {
+									text_list = append(text_list, sentence.TokenList[m].Text)
+								}
+								// the group has the salience of its head
+								factor_list := ll.getSalienceFactors(seen_existential, &t_token, i, sentence)
+								referent_array = append(referent_array, &LLReferent{anaphora: groupText(text_list),
+									anaphora_list: text_list, salience: sumFactors(factor_list) * salient_dropoff, semantic: group_semantic,
+									s_index: sentence_id, t_index: i, factor_list: factor_list, dropoff: salient_dropoff})
+							}
+						}
+					}
+
 				} // if is noun
 
 			} // if right part of the sentence
@@ -260,8 +513,8 @@ func (ll LappinLeass) find_pronouns(pronoun *LLPronoun, s_index int, t_index int
 
 	} // for each back sentence
 
-	// sort salience array
-	sort.Sort(referent_array)
+	// sort salience array, the earliest mention wins a tie
+	sort.Stable(referent_array)
 	return referent_array
 }
 
@@ -270,9 +523,29 @@ func (ll LappinLeass) find_pronouns(pronoun *LLPronoun, s_index int, t_index int
 //   sentence_list: the last sentence is assumed to have a pronoun reference
 // return the number of pronouns that did get resolved in this sentence
 func (ll LappinLeass) ResolvePronouns(sentence_list model.SentenceList) int {
+	return ll.resolvePronounsFrom(0, sentence_list)
+}
+
+// resolve pronouns in a sentence list using previous sentences of the conversation as well
+//   context_list: earlier sentences (oldest first) that can be referred to but aren't resolved again
+//   sentence_list: the new sentences to resolve
+// return the number of pronouns that did get resolved in sentence_list
+func (ll LappinLeass) ResolvePronounsWithContext(context_list model.SentenceList, sentence_list model.SentenceList) int {
+	if len(context_list) == 0 {
+		return ll.ResolvePronouns(sentence_list)
+	}
+	combined_list := make(model.SentenceList, 0)
+	combined_list = append(combined_list, context_list...)
+	combined_list = append(combined_list, sentence_list...)
+	// the token lists are shared with combined_list, so the results land in sentence_list
+	return ll.resolvePronounsFrom(len(context_list), combined_list)
+}
+
+// resolve the pronouns of sentence_list[start:] using all sentences of sentence_list as referents
+func (ll LappinLeass) resolvePronounsFrom(start int, sentence_list model.SentenceList) int {
 	num_pronouns_resolved := 0
 
-	for s_index, _ := range sentence_list {
+	for s_index := start; s_index < len(sentence_list); s_index++ {
 		// find the pronoun(s) to be resolved, from left to right
 		for index, t_token := range sentence_list[s_index].TokenList {
 			if t_token.Tag == "PRP" || t_token.Tag == "PRP$" {
@@ -281,8 +554,10 @@ func (ll LappinLeass) ResolvePronouns(sentence_list model.SentenceList) int {
 					if len(referent_list) > 0 {
 						num_pronouns_resolved += 1
 						sentence_list[s_index].TokenList[index].Anaphora = referent_list[0].anaphora
+						sentence_list[s_index].TokenList[index].AnaphoraList = referent_list[0].anaphora_list
 					} else {
 						sentence_list[s_index].TokenList[index].Anaphora = "?" // not found marker
+						sentence_list[s_index].TokenList[index].AnaphoraList = nil
 					}
 				}
 			}
@@ -308,8 +583,12 @@ func (ll LappinLeass) HasPronoun(sentence model.Sentence) bool {
 var LL LappinLeass
 
 
-// initializer
+// initializer, falls back to the defaultSettings if the settings file can't be used
 func init() {
-	LL.Init()
+	err := LL.LoadFromFile(util.GetDataPath() + "/anaphora/lappin_leass.txt")
+	if err != nil {
+		logger.Log.Warning("anaphora: using the default Lappin Leass settings: %s", err.Error())
+		LL.LoadDefaults()
+	}
 }
 
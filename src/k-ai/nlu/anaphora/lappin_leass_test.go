@@ -12,11 +12,13 @@
 package anaphora
 
 import (
+	"os"
 	"testing"
 	"strings"
 	"runtime/debug"
 	"k-ai/nlu/model"
 	"encoding/json"
+	"k-ai/util"
 	"k-ai/util_ut"
 )
 
@@ -123,3 +125,117 @@ func TestLL3(t *testing.T) {
 }
 
 
+
+// test the settings are loaded from file
+func TestLLSettings1(t *testing.T) {
+	util_ut.IsTrue(t, LL.n_back == 4)
+	util_ut.IsTrue(t, LL.GetWeight(FactorSubject) == 80.0)
+	util_ut.IsTrue(t, LL.GetWeight(FactorCurrentSentence) == 100.0)
+	prp, ok := LL.pronoun_set["they"]
+	util_ut.IsTrue(t, ok && prp.number == "p" && prp.containsSemantic("other"))
+
+	// invalid lines are reported
+	filename := os.TempDir() + "/ll_settings_test.txt"
+	defer os.Remove(filename)
+	util_ut.Check(t, util.SaveTextFile(filename, "n_back:2\npronoun:he:x:male\n"))
+	var ll LappinLeass
+	err := ll.LoadFromFile(filename)
+	util_ut.IsTrue(t, err != nil && strings.Contains(err.Error(), ":2:"))
+
+	// and so are misspelt salience factors
+	util_ut.Check(t, util.SaveTextFile(filename, "weight:subject:80\nweight:subjcet:60\n"))
+	err = ll.LoadFromFile(filename)
+	util_ut.IsTrue(t, err != nil && strings.Contains(err.Error(), ":2:") && strings.Contains(err.Error(), "subjcet"))
+}
+
+// test the default settings are the same as the settings file's
+func TestLLSettings2(t *testing.T) {
+	var ll LappinLeass
+	ll.LoadDefaults()
+	util_ut.IsTrue(t, ll.n_back == LL.n_back && len(ll.weights) == len(salienceFactors))
+	util_ut.IsTrue(t, len(ll.weights) == len(LL.weights) && len(ll.pronoun_set) == len(LL.pronoun_set))
+	for factor, weight := range LL.weights {
+		util_ut.IsTrue(t, ll.GetWeight(factor) == weight)
+	}
+	for text, pronoun := range LL.pronoun_set {
+		util_ut.IsTrue(t, ll.pronoun_set[text].number == pronoun.number)
+		util_ut.IsTrue(t, len(ll.pronoun_set[text].semantics) == len(pronoun.semantics))
+	}
+
+	// a missing settings file is an error, init() then uses the defaults
+	util_ut.IsTrue(t, ll.LoadFromFile(os.TempDir() + "/ll_settings_missing.txt") != nil)
+}
+
+// test the explanation of a resolution has the salience breakdown of each candidate
+func TestLLExplain1(t *testing.T) {
+	// John said he likes dogs.
+	const s_list_1 = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"John","dep":"nsubj","synid":-1,"semantic":"male"},{"index":1,"list":[],"tag":"VBD","text":"said","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"PRP","text":"he","dep":"nsubj","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"VBZ","text":"likes","dep":"ccomp","synid":-1,"semantic":""},{"index":4,"list":[3,1],"tag":"NNS","text":"dogs","dep":"dobj","synid":-1,"semantic":"animal"},{"index":5,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+	sentence_list := jsonToSentenceList(t, s_list_1)
+	explanation_list := LL.ExplainPronouns(sentence_list)
+	util_ut.IsTrue(t, len(explanation_list) == 1)
+	explanation := explanation_list[0]
+	util_ut.IsTrue(t, explanation.Pronoun == "he" && explanation.TokenIndex == 2 && explanation.Anaphora == "John")
+	util_ut.IsTrue(t, len(explanation.CandidateList) == 1)
+	candidate := explanation.CandidateList[0]
+	util_ut.IsTrue(t, len(candidate.FactorList) == 2)
+	util_ut.IsTrue(t, candidate.FactorList[0].Factor == FactorCurrentSentence && candidate.FactorList[1].Factor == FactorSubject)
+	util_ut.IsTrue(t, candidate.Salience == 180.0 && candidate.Dropoff == 1.0)
+
+	// explaining doesn't resolve anything
+	checkPronounReference(t, sentence_list, "", "he")
+}
+
+// test gender is taken from the lexicon's names for people without one
+func TestLLGender1(t *testing.T) {
+	// Peter Smith said she likes dogs.
+	const s_list_1 = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Peter Smith","dep":"nsubj","synid":-1,"semantic":"person"},{"index":1,"list":[],"tag":"VBD","text":"said","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"PRP","text":"she","dep":"nsubj","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"VBZ","text":"likes","dep":"ccomp","synid":-1,"semantic":""},{"index":4,"list":[3,1],"tag":"NNS","text":"dogs","dep":"dobj","synid":-1,"semantic":"animal"},{"index":5,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+	sentence_list := jsonToSentenceList(t, s_list_1)
+	util_ut.IsTrue(t, LL.ResolvePronouns(sentence_list) == 0)
+	checkPronounReference(t, sentence_list, "?", "she")
+
+	sentence_list = jsonToSentenceList(t, strings.Replace(s_list_1, `"she"`, `"he"`, 1))
+	util_ut.IsTrue(t, LL.ResolvePronouns(sentence_list) == 1)
+	checkPronounReference(t, sentence_list, "Peter Smith", "he")
+}
+
+// Peter and Sherry went to the beach.  They watched the boats.
+const peterAndSherry = `[{"tokenList":[{"index":0,"list":[3],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"male"},{"index":1,"list":[0,3],"tag":"CC","text":"and","dep":"cc","synid":-1,"semantic":""},{"index":2,"list":[0,3],"tag":"NNP","text":"Sherry","dep":"conj","synid":-1,"semantic":"female"},{"index":3,"list":[],"tag":"VBD","text":"went","dep":"ROOT","synid":-1,"semantic":""},{"index":4,"list":[3],"tag":"IN","text":"to","dep":"prep","synid":-1,"semantic":""},{"index":5,"list":[6,4,3],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":6,"list":[4,3],"tag":"NN","text":"beach","dep":"pobj","synid":-1,"semantic":"location"},{"index":7,"list":[3],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]},{"tokenList":[{"index":8,"list":[9],"tag":"PRP","text":"They","dep":"nsubj","synid":-1,"semantic":""},{"index":9,"list":[],"tag":"VBD","text":"watched","dep":"ROOT","synid":-1,"semantic":""},{"index":10,"list":[11,9],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":11,"list":[9],"tag":"NNS","text":"boats","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":12,"list":[9],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// Peter, Mark and Sherry went to the beach.  They watched the boats.
+const peterMarkAndSherry = `[{"tokenList":[{"index":0,"list":[5],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"male"},{"index":1,"list":[0,5],"tag":",","text":",","dep":"punct","synid":-1,"semantic":""},{"index":2,"list":[0,5],"tag":"NNP","text":"Mark","dep":"conj","synid":-1,"semantic":"male"},{"index":3,"list":[2,0,5],"tag":"CC","text":"and","dep":"cc","synid":-1,"semantic":""},{"index":4,"list":[2,0,5],"tag":"NNP","text":"Sherry","dep":"conj","synid":-1,"semantic":"female"},{"index":5,"list":[],"tag":"VBD","text":"went","dep":"ROOT","synid":-1,"semantic":""},{"index":6,"list":[5],"tag":"IN","text":"to","dep":"prep","synid":-1,"semantic":""},{"index":7,"list":[8,6,5],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":8,"list":[6,5],"tag":"NN","text":"beach","dep":"pobj","synid":-1,"semantic":"location"},{"index":9,"list":[5],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]},{"tokenList":[{"index":10,"list":[11],"tag":"PRP","text":"They","dep":"nsubj","synid":-1,"semantic":""},{"index":11,"list":[],"tag":"VBD","text":"watched","dep":"ROOT","synid":-1,"semantic":""},{"index":12,"list":[13,11],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":13,"list":[11],"tag":"NNS","text":"boats","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":14,"list":[11],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// test "they" resolves to a group of coordinated nouns
+func TestLLGroup1(t *testing.T) {
+	sentence_list := jsonToSentenceList(t, peterAndSherry)
+	util_ut.IsTrue(t, LL.ResolvePronouns(sentence_list) == 1)
+	checkPronounReference(t, sentence_list, "Peter and Sherry", "they")
+	they := sentence_list[1].TokenList[0]
+	util_ut.IsTrue(t, len(they.GetReferentList()) == 2)
+	util_ut.IsTrue(t, they.GetReferentList()[0] == "Peter" && they.GetReferentList()[1] == "Sherry")
+}
+
+// test groups of more than two, and that singular pronouns still refer to a single member
+func TestLLGroup2(t *testing.T) {
+	sentence_list := jsonToSentenceList(t, peterMarkAndSherry)
+	util_ut.IsTrue(t, LL.ResolvePronouns(sentence_list) == 1)
+	checkPronounReference(t, sentence_list, "Peter, Mark and Sherry", "they")
+	util_ut.IsTrue(t, len(sentence_list[1].TokenList[0].AnaphoraList) == 3)
+
+	sentence_list = jsonToSentenceList(t, strings.Replace(peterAndSherry, `"They"`, `"She"`, 1))
+	util_ut.IsTrue(t, LL.ResolvePronouns(sentence_list) == 1)
+	checkPronounReference(t, sentence_list, "Sherry", "she")
+	util_ut.IsTrue(t, len(sentence_list[1].TokenList[0].GetReferentList()) == 1)
+}
+
+// test semantic agreement uses the semantic hierarchy (a woman is female)
+func TestLLHierarchy1(t *testing.T) {
+	// The woman said she likes dogs.
+	const s_list_1 = `[{"tokenList":[{"index":0,"list":[1],"tag":"DT","text":"The","dep":"det","synid":-1,"semantic":""},{"index":1,"list":[2],"tag":"NN","text":"woman","dep":"nsubj","synid":-1,"semantic":"woman"},{"index":2,"list":[],"tag":"VBD","text":"said","dep":"ROOT","synid":-1,"semantic":""},{"index":3,"list":[4,2],"tag":"PRP","text":"she","dep":"nsubj","synid":-1,"semantic":""},{"index":4,"list":[2],"tag":"VBZ","text":"likes","dep":"ccomp","synid":-1,"semantic":""},{"index":5,"list":[4,2],"tag":"NNS","text":"dogs","dep":"dobj","synid":-1,"semantic":"animal"},{"index":6,"list":[2],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+	sentence_list := jsonToSentenceList(t, s_list_1)
+	util_ut.IsTrue(t, LL.ResolvePronouns(sentence_list) == 1)
+	checkPronounReference(t, sentence_list, "woman", "she")
+
+	sentence_list = jsonToSentenceList(t, strings.Replace(s_list_1, `"she"`, `"he"`, 1))
+	util_ut.IsTrue(t, LL.ResolvePronouns(sentence_list) == 0)
+	checkPronounReference(t, sentence_list, "?", "he")
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package answer
+
+import (
+	"strings"
+	"k-ai/nlu/model"
+	"k-ai/nlu/lexicon"
+	"k-ai/nlu/tokenizer"
+	"k-ai/util"
+)
+
+//
+// Answer span extraction
+//
+// Given a question and a sentence that matched it through the indexes, find the part of the
+// sentence that actually answers the question:
+// * questions with an expected answer (where, who, when, how many) pick the best token
+//   of the right semantic / tag that isn't part of the question and return its sub-tree
+// * all other questions take the object of the verb matched by the question (or the sentence's root)
+//   e.g. "what does Peter have?" + "Peter has a boat in the harbour." -> "a boat"
+//
+
+// dependency labels that make good answers, best first
+var objectDeps = []string{"dobj", "attr", "oprd", "acomp", "pobj", "dative", "nsubjpass"}
+
+// return the set of stemmed words of the question we should never answer with
+func questionWords(question model.Sentence) map[string]bool {
+	word_set := make(map[string]bool, 0)
+	for _, t_token := range question.TokenList {
+		stemmed := lexicon.Lexi.GetStem(t_token.Text)
+		if len(stemmed) > 0 {
+			word_set[stemmed] = true
+		}
+	}
+	return word_set
+}
+
+// is token in the question (by stem)?
+func inQuestion(t_token *model.Token, question_words map[string]bool) bool {
+	_, ok := question_words[lexicon.Lexi.GetStem(t_token.Text)]
+	return ok
+}
+
+// is ancestor an ancestor of t_token?
+func hasAncestor(t_token *model.Token, ancestor int) bool {
+	for _, index := range t_token.AncestorList {
+		if index == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// is t_token a direct child of the token with index parent?
+func isChildOf(t_token *model.Token, parent int) bool {
+	return len(t_token.AncestorList) > 0 && t_token.AncestorList[0] == parent
+}
+
+// return the tokens of the sub-tree rooted at head (in sentence order) minus punctuation
+func SubTree(sentence model.Sentence, head *model.Token) []model.Token {
+	token_list := make([]model.Token, 0)
+	for _, t_token := range sentence.TokenList {
+		if t_token.Index == head.Index || hasAncestor(&t_token, head.Index) {
+			token_list = append(token_list, t_token)
+		}
+	}
+	return tokenizer.FilterOutPunctuation(token_list)
+}
+
+// return the text of the sub-tree rooted at head
+func subTreeText(sentence model.Sentence, head *model.Token) string {
+	return tokenizer.ToString(SubTree(sentence, head))
+}
+
+// rank of a dependency label for an answer, lower is better
+func depRank(dep string) int {
+	for i, d := range objectDeps {
+		if d == dep {
+			return i
+		}
+	}
+	return len(objectDeps)
+}
+
+// pick the answer for a question that expects a particular kind of token
+func typedAnswer(question_type model.QuestionType, sentence model.Sentence, question_words map[string]bool) string {
+	var best *model.Token
+	for i := range sentence.TokenList {
+		t_token := &sentence.TokenList[i]
+		if question_type.IsAnswerToken(t_token) && !inQuestion(t_token, question_words) {
+			if best == nil || depRank(t_token.Dep) < depRank(best.Dep) {
+				best = t_token
+			}
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	// quantities: just the number and what it counts, e.g. "3 boats"
+	if question_type.Type == model.QTQuantity {
+		if len(best.AncestorList) > 0 {
+			for _, t_token := range sentence.TokenList {
+				if t_token.Index == best.AncestorList[0] && strings.HasPrefix(t_token.Tag, "NN") {
+					return best.Text + " " + t_token.Text
+				}
+			}
+		}
+		return best.Text
+	}
+	return subTreeText(sentence, best)
+}
+
+// find the verb of the sentence the question refers to, or the sentence's root
+func matchedVerb(sentence model.Sentence, question_words map[string]bool) *model.Token {
+	var root *model.Token
+	for i := range sentence.TokenList {
+		t_token := &sentence.TokenList[i]
+		if strings.HasPrefix(t_token.Tag, "VB") && t_token.Dep != "aux" && t_token.Dep != "auxpass" {
+			if inQuestion(t_token, question_words) && !lexicon.Lexi.IsUndesirable(lexicon.Lexi.GetStem(t_token.Text)) {
+				return t_token
+			}
+		}
+		if len(t_token.AncestorList) == 0 && root == nil {
+			root = t_token
+		}
+	}
+	return root
+}
+
+// pick the object of the matched verb as the answer
+func objectAnswer(sentence model.Sentence, question_words map[string]bool) string {
+	verb := matchedVerb(sentence, question_words)
+	if verb == nil {
+		return ""
+	}
+	var best *model.Token
+	for i := range sentence.TokenList {
+		t_token := &sentence.TokenList[i]
+		if t_token.Index == verb.Index || inQuestion(t_token, question_words) {
+			continue
+		}
+		rank := depRank(t_token.Dep)
+		if rank == len(objectDeps) {
+			continue
+		}
+		// direct objects of the verb, or objects of the verb's prepositions
+		direct := isChildOf(t_token, verb.Index)
+		via_prep := false
+		if !direct && len(t_token.AncestorList) > 1 && t_token.AncestorList[1] == verb.Index {
+			for _, p_token := range sentence.TokenList {
+				if p_token.Index == t_token.AncestorList[0] && p_token.Dep == "prep" {
+					via_prep = true
+				}
+			}
+		}
+		if (direct || via_prep) && (best == nil || rank < depRank(best.Dep)) {
+			best = t_token
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return subTreeText(sentence, best)
+}
+
+// find the short answer to question inside sentence, returns "" if there isn't an obvious answer
+func ExtractAnswer(question model.Sentence, question_type model.QuestionType, sentence model.Sentence) string {
+	if question_type.Type == model.QTYesNo || len(sentence.TokenList) == 0 {
+		return ""
+	}
+	question_words := questionWords(question)
+	if question_type.HasExpectation() {
+		return typedAnswer(question_type, sentence, question_words)
+	}
+	return objectAnswer(sentence, question_words)
+}
+
+// convert a list of matching sentences to ask results, each with its short answer
+// and the full sentence as supporting evidence
+func ToResults(question model.Sentence, question_type model.QuestionType, sentence_list []model.Sentence) *model.ATResultList {
+	rs := model.ATResultList{ResultList: make([]model.ATResult, 0)}
+	for _, sentence := range sentence_list {
+		rs.ResultList = append(rs.ResultList, model.ATResult{
+			Answer:      ExtractAnswer(question, question_type, sentence),
+			Text:        tokenizer.ToString(sentence.TokenList),
+			Sentence_id: sentence.Id,
+			Topic:       sentence.Topic,
+			Timestamp:   util.GetTimeNowSting()})
+	}
+	return &rs
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package answer
+
+import (
+	"testing"
+	"encoding/json"
+	"k-ai/nlu/model"
+	"k-ai/util_ut"
+)
+
+// Peter has a boat in the harbour.
+const peterHasABoat = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"person"},{"index":1,"list":[],"tag":"VBZ","text":"has","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"DT","text":"a","dep":"det","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NN","text":"boat","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":4,"list":[1],"tag":"IN","text":"in","dep":"prep","synid":-1,"semantic":""},{"index":5,"list":[6,4,1],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":6,"list":[4,1],"tag":"NN","text":"harbour","dep":"pobj","synid":-1,"semantic":"location"},{"index":7,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// Peter has 3 boats.
+const peterHas3Boats = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"person"},{"index":1,"list":[],"tag":"VBZ","text":"has","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"CD","text":"3","dep":"nummod","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NNS","text":"boats","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":4,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// where is the boat?
+const whereIsTheBoat = `[{"tokenList":[{"index":0,"list":[1],"tag":"WRB","text":"where","dep":"advmod","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBZ","text":"is","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"DT","text":"the","dep":"det","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NN","text":"boat","dep":"nsubj","synid":-1,"semantic":"vehicle"},{"index":4,"list":[1],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// what does Peter have?
+const whatDoesPeterHave = `[{"tokenList":[{"index":0,"list":[3],"tag":"WP","text":"what","dep":"dobj","synid":-1,"semantic":""},{"index":1,"list":[3],"tag":"VBZ","text":"does","dep":"aux","synid":-1,"semantic":""},{"index":2,"list":[3],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"person"},{"index":3,"list":[],"tag":"VB","text":"have","dep":"ROOT","synid":-1,"semantic":""},{"index":4,"list":[3],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// how many boats does Peter have?
+const howManyBoats = `[{"tokenList":[{"index":0,"list":[1,2,5],"tag":"WRB","text":"how","dep":"advmod","synid":-1,"semantic":""},{"index":1,"list":[2,5],"tag":"JJ","text":"many","dep":"amod","synid":-1,"semantic":""},{"index":2,"list":[5],"tag":"NNS","text":"boats","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":3,"list":[5],"tag":"VBZ","text":"does","dep":"aux","synid":-1,"semantic":""},{"index":4,"list":[5],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"person"},{"index":5,"list":[],"tag":"VB","text":"have","dep":"ROOT","synid":-1,"semantic":""},{"index":6,"list":[5],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// who has a boat?
+const whoHasABoat = `[{"tokenList":[{"index":0,"list":[1],"tag":"WP","text":"who","dep":"nsubj","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBZ","text":"has","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"DT","text":"a","dep":"det","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NN","text":"boat","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":4,"list":[1],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// from json str back to a single sentence (the first)
+func jsonToSentence(t *testing.T, str string) model.Sentence {
+	var sentence_list []model.Sentence
+	err := json.Unmarshal([]byte(str), &sentence_list)
+	util_ut.Check(t, err)
+	return sentence_list[0]
+}
+
+// helper: check the answer to a question given a sentence
+func checkAnswer(t *testing.T, question_str string, sentence_str string, expected string) {
+	question := jsonToSentence(t, question_str)
+	answer := ExtractAnswer(question, question.GetQuestionType(), jsonToSentence(t, sentence_str))
+	if answer != expected {
+		t.Errorf("expected answer \"%s\" but got \"%s\"", expected, answer)
+		t.FailNow()
+	}
+}
+
+// test the typed answers, where, who, how many
+func TestAnswerSpan1(t *testing.T) {
+	checkAnswer(t, whereIsTheBoat, peterHasABoat, "the harbour")
+	checkAnswer(t, whoHasABoat, peterHasABoat, "Peter")
+	checkAnswer(t, howManyBoats, peterHas3Boats, "3 boats")
+}
+
+// test the object of the matched verb
+func TestAnswerSpan2(t *testing.T) {
+	checkAnswer(t, whatDoesPeterHave, peterHasABoat, "a boat")
+
+	// no number in the sentence - no answer to how many
+	checkAnswer(t, howManyBoats, peterHasABoat, "")
+}
+
+// test the results keep the full sentence as evidence
+func TestAnswerResults1(t *testing.T) {
+	question := jsonToSentence(t, whereIsTheBoat)
+	rs := ToResults(question, question.GetQuestionType(), []model.Sentence{jsonToSentence(t, peterHasABoat)})
+	util_ut.IsTrue(t, len(rs.ResultList) == 1)
+	util_ut.IsTrue(t, rs.ResultList[0].Answer == "the harbour")
+	util_ut.IsTrue(t, rs.ResultList[0].Text == "Peter has a boat in the harbour.")
+}
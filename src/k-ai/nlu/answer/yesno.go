@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package answer
+
+import (
+	"strings"
+	"github.com/gocql/gocql"
+	"k-ai/nlu/model"
+	"k-ai/nlu/lexicon"
+)
+
+//
+// Yes/no question answering
+//
+// A question like "Is Mark living in his car?" is broken into its predicate (live), its
+// polarity (positive) and its arguments (Mark, car).  Each candidate factoid is broken down
+// the same way; a factoid with the same predicate and all the question's arguments supports
+// "Yes" if its polarity agrees, and "No" if it doesn't.  No support either way is "I don't know".
+//
+
+// the possible answers to a yes/no question
+const (
+	YesAnswer     = "Yes"
+	NoAnswer      = "No"
+	UnknownAnswer = "I don't know"
+)
+
+// the answer to a yes/no question and the factoids that support it
+type YesNoResult struct {
+	Answer      string
+	SupportList []gocql.UUID
+}
+
+// the broken down structure of a statement or yes/no question
+type predicateStructure struct {
+	predicate string          // stem of the main verb
+	negated   bool            // polarity
+	arguments map[string]bool // stems of the content words
+}
+
+// forms of "to be", "to have" and "to do" which act as the predicate only if there is no other verb
+var copulaStems = map[string]bool{"be": true, "have": true, "do": true}
+
+// is t_token a negation marker?
+func isNegation(t_token *model.Token) bool {
+	lwr := strings.ToLower(t_token.Text)
+	return t_token.Dep == "neg" || lwr == "not" || lwr == "n't" || lwr == "never"
+}
+
+// break a sentence into its predicate, polarity and arguments
+func getPredicateStructure(sentence model.Sentence) predicateStructure {
+	ps := predicateStructure{arguments: make(map[string]bool, 0)}
+	copula := ""
+	for _, t_token := range sentence.TokenList {
+		if isNegation(&t_token) {
+			ps.negated = !ps.negated
+			continue
+		}
+		stemmed := lexicon.Lexi.GetStemForTag(t_token.Text, t_token.Tag)
+		if len(stemmed) == 0 {
+			continue
+		}
+		if strings.HasPrefix(t_token.Tag, "VB") {
+			if copulaStems[stemmed] || t_token.Dep == "aux" || t_token.Dep == "auxpass" {
+				if len(copula) == 0 {
+					copula = stemmed
+				}
+			} else if len(ps.predicate) == 0 {
+				ps.predicate = stemmed
+			}
+		} else if strings.HasPrefix(t_token.Tag, "NN") || strings.HasPrefix(t_token.Tag, "JJ") || t_token.Tag == "CD" {
+			if !lexicon.Lexi.IsUndesirable(stemmed) {
+				ps.arguments[stemmed] = true
+			}
+		} else if t_token.Tag == "PRP" || t_token.Tag == "PRP$" {
+			// a resolved pronoun counts as a mention of its referent(s)
+			for _, referent := range t_token.GetReferentList() {
+				ps.arguments[lexicon.Lexi.GetStem(referent)] = true
+			}
+		}
+	}
+	if len(ps.predicate) == 0 {
+		ps.predicate = copula
+	}
+	return ps
+}
+
+// do two predicates mean the same thing?
+func samePredicate(p1 string, p2 string) bool {
+	if p1 == p2 {
+		return true
+	}
+	for _, synonym := range lexicon.Lexi.GetSynonymList(p1) {
+		if synonym == p2 {
+			return true
+		}
+	}
+	return false
+}
+
+// does the factoid mention all the arguments of the question?
+func coversArguments(question predicateStructure, factoid predicateStructure) bool {
+	for argument := range question.arguments {
+		if _, ok := factoid.arguments[argument]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// answer a yes/no question using a set of candidate factoids
+func AnswerYesNo(question model.Sentence, candidate_list []model.Sentence) YesNoResult {
+	question_ps := getPredicateStructure(question)
+	yes_list := make([]gocql.UUID, 0)
+	no_list := make([]gocql.UUID, 0)
+
+	if len(question_ps.predicate) > 0 {
+		for _, candidate := range candidate_list {
+			candidate_ps := getPredicateStructure(candidate)
+			if samePredicate(question_ps.predicate, candidate_ps.predicate) && coversArguments(question_ps, candidate_ps) {
+				if question_ps.negated == candidate_ps.negated {
+					yes_list = append(yes_list, candidate.Id)
+				} else {
+					no_list = append(no_list, candidate.Id)
+				}
+			}
+		}
+	}
+
+	// the majority wins, a tie means we can't tell
+	if len(yes_list) > len(no_list) {
+		return YesNoResult{Answer: YesAnswer, SupportList: yes_list}
+	} else if len(no_list) > len(yes_list) {
+		return YesNoResult{Answer: NoAnswer, SupportList: no_list}
+	}
+	return YesNoResult{Answer: UnknownAnswer, SupportList: append(yes_list, no_list...)}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package answer
+
+import (
+	"testing"
+	"k-ai/nlu/model"
+	"k-ai/util_ut"
+)
+
+// is Mark living in his car?
+const isMarkLivingInHisCar = `[{"tokenList":[{"index":0,"list":[2],"tag":"VBZ","text":"is","dep":"aux","synid":-1,"semantic":""},{"index":1,"list":[2],"tag":"NNP","text":"Mark","dep":"nsubj","synid":-1,"semantic":"male"},{"index":2,"list":[],"tag":"VBG","text":"living","dep":"ROOT","synid":-1,"semantic":""},{"index":3,"list":[2],"tag":"IN","text":"in","dep":"prep","synid":-1,"semantic":""},{"index":4,"list":[5,3,2],"tag":"PRP$","text":"his","dep":"poss","synid":-1,"semantic":""},{"index":5,"list":[3,2],"tag":"NN","text":"car","dep":"pobj","synid":-1,"semantic":"vehicle"},{"index":6,"list":[2],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// Mark lives in his car.
+const markLivesInHisCar = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Mark","dep":"nsubj","synid":-1,"semantic":"male"},{"index":1,"list":[],"tag":"VBZ","text":"lives","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[1],"tag":"IN","text":"in","dep":"prep","synid":-1,"semantic":""},{"index":3,"list":[4,2,1],"tag":"PRP$","text":"his","dep":"poss","synid":-1,"semantic":""},{"index":4,"list":[2,1],"tag":"NN","text":"car","dep":"pobj","synid":-1,"semantic":"vehicle"},{"index":5,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// Mark does not live in his car.
+const markDoesNotLiveInHisCar = `[{"tokenList":[{"index":0,"list":[3],"tag":"NNP","text":"Mark","dep":"nsubj","synid":-1,"semantic":"male"},{"index":1,"list":[3],"tag":"VBZ","text":"does","dep":"aux","synid":-1,"semantic":""},{"index":2,"list":[3],"tag":"RB","text":"not","dep":"neg","synid":-1,"semantic":""},{"index":3,"list":[],"tag":"VB","text":"live","dep":"ROOT","synid":-1,"semantic":""},{"index":4,"list":[3],"tag":"IN","text":"in","dep":"prep","synid":-1,"semantic":""},{"index":5,"list":[6,4,3],"tag":"PRP$","text":"his","dep":"poss","synid":-1,"semantic":""},{"index":6,"list":[4,3],"tag":"NN","text":"car","dep":"pobj","synid":-1,"semantic":"vehicle"},{"index":7,"list":[3],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// Mark washes his car.
+const markWashesHisCar = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Mark","dep":"nsubj","synid":-1,"semantic":"male"},{"index":1,"list":[],"tag":"VBZ","text":"washes","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"PRP$","text":"his","dep":"poss","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NN","text":"car","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":4,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+
+// helper: load a factoid with a new id
+func factoid(t *testing.T, str string) model.Sentence {
+	sentence := jsonToSentence(t, str)
+	util_ut.Check(t, sentence.RandomId())
+	return sentence
+}
+
+// test yes, no, and don't know
+func TestYesNo1(t *testing.T) {
+	question := jsonToSentence(t, isMarkLivingInHisCar)
+	util_ut.IsTrue(t, question.GetQuestionType().Type == model.QTYesNo)
+
+	yes := factoid(t, markLivesInHisCar)
+	no := factoid(t, markDoesNotLiveInHisCar)
+	other := factoid(t, markWashesHisCar)
+
+	result := AnswerYesNo(question, []model.Sentence{yes, other})
+	util_ut.IsTrue(t, result.Answer == YesAnswer)
+	util_ut.IsTrue(t, len(result.SupportList) == 1 && result.SupportList[0] == yes.Id)
+
+	result = AnswerYesNo(question, []model.Sentence{no, other})
+	util_ut.IsTrue(t, result.Answer == NoAnswer)
+	util_ut.IsTrue(t, len(result.SupportList) == 1 && result.SupportList[0] == no.Id)
+
+	// a different predicate says nothing about it
+	result = AnswerYesNo(question, []model.Sentence{other})
+	util_ut.IsTrue(t, result.Answer == UnknownAnswer)
+	util_ut.IsTrue(t, len(result.SupportList) == 0)
+
+	// contradicting factoids cancel each other out
+	result = AnswerYesNo(question, []model.Sentence{yes, no})
+	util_ut.IsTrue(t, result.Answer == UnknownAnswer)
+	util_ut.IsTrue(t, len(result.SupportList) == 2)
+}
@@ -12,22 +12,18 @@
 package glove
 
 import (
-	"os"
-	"bufio"
-	"fmt"
-	"strings"
-	"strconv"
-	"k-ai/logger"
 	"math"
-	"errors"
 )
 
+// the word vectors used by the system, nil when none are loaded
+var Vectors *MapSystem
+
 // example use
 
-//g := glove.CreateGloveMap(util.GetDataPath() + "/glove.6B.50d.txt", 1000000)
+//g, err := glove.CreateGloveMap(util.GetDataPath() + "/glove.6B.50d.txt")
 //
-//// test a vector and get its closest relatives
-//relations := g.GetRelatedWords("peter", 1)
+//// get the 10 words closest to a word
+//relations := g.GetRelatedWords("peter", 10)
 //for _, value := range relations {
 //	Printf("score=%f, %s\n", value.Score, value.Text)
 //}
@@ -39,43 +35,21 @@ import (
 // returned is a map of word_str -> []float64 of size whatever the file is
 // the file must be consistent, i.e. all vectors are the same size in the file
 func LoadGlove(filename string) (map[string][]float64, error) {
-
-	g_map := make(map[string][]float64)
-
-	// open the file and check it
-	file, err := os.Open(filename)
+	vs, err := readTextVectors(filename, false, 0)
 	if err != nil { return nil, err }
-	defer file.Close()
-
-	vector_size := 0  // initial size
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		words := strings.Fields(scanner.Text())  // split
-		this_vector_size := len(words) - 1
-		if vector_size == 0 {
-			vector_size = this_vector_size
-		} else {
-			if this_vector_size != vector_size {
-				return nil, errors.New(fmt.Sprintf("inconsistent vector size, expected vectors of size %d but got %d", vector_size, this_vector_size))
-			}
-		}
-		word := words[0]
-		vector := make([]float64, vector_size, vector_size)
-		for i := 0; i < vector_size; i++ {
-			vector[i], _ = strconv.ParseFloat(words[i+1], 64)
+	g_map := make(map[string][]float64, len(vs.word_list))
+	for id, word := range vs.word_list {
+		vector := make([]float64, vs.dim)
+		for i, value := range vs.vectors[id * vs.dim : (id + 1) * vs.dim] {
+			vector[i] = float64(value)
 		}
 		g_map[word] = vector
 	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-
 	return g_map, nil
 }
 
 
-// return the angle between two vectors - their relatedness
+// return the cosine similarity of two vectors - their relatedness (-1..1, 1 for the same direction)
 func GetVectorAngle(v1 []float64, v2 []float64) (float64) {
 	value := 0.0
 	l_v1 := 0.0
@@ -85,19 +59,14 @@ func GetVectorAngle(v1 []float64, v2 []float64) (float64) {
 		l_v2 += v2[i] * v2[i]
 		value += v1[i] * v2[i]  // dot product
 	}
-	dotp := value / (math.Sqrt(l_v1) * math.Sqrt(l_v2))
-	return math.Cosh(dotp)
+	if l_v1 == 0.0 || l_v2 == 0.0 {
+		return 0.0
+	}
+	return value / (math.Sqrt(l_v1) * math.Sqrt(l_v2))
 }
 
-// create a glove lookup map system
-func CreateGloveMap(filename string, index_size int) (*MapSystem, error) {
-	logger.Log.Info("loading glove vectors ")
-	g_map, err := LoadGlove(filename)
-	if err != nil { return nil, err }
-	logger.Log.Info(fmt.Sprintf("%d vectors loaded, setup", len(g_map)))
-	result := new(MapSystem)
-	result.setup(g_map, float64(index_size))
-	logger.Log.Info(" done")
-	return result, nil
+// create a glove lookup map system with a nearest neighbour index
+// for other formats and vocabulary limits see LoadVectors
+func CreateGloveMap(filename string) (*MapSystem, error) {
+	return LoadVectors(filename, FormatGlove, 0)
 }
-
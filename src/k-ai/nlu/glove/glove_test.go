@@ -12,15 +12,359 @@
 package glove
 
 import (
+	"os"
+	"io/ioutil"
+	"fmt"
+	"math"
+	"bytes"
+	"strings"
 	"testing"
+	"math/rand"
+	"path/filepath"
+	"encoding/binary"
+	"k-ai/nlu/model"
 )
 
 func TestGloveAngles(t *testing.T) {
 	v1 := []float64{1.0, 0.0}
 	v2 := []float64{0.0, 1.0}
 	angle := GetVectorAngle(v1,v2)
-	if angle != 1.0 {
+	if angle != 0.0 {
+		t.Errorf("angle != 0.0 but %f", angle)
+	}
+	if angle := GetVectorAngle(v1, []float64{2.0, 0.0}); math.Abs(angle - 1.0) > 1e-9 {
 		t.Errorf("angle != 1.0 but %f", angle)
 	}
+	if angle := GetVectorAngle(v1, []float64{-1.0, 0.0}); math.Abs(angle + 1.0) > 1e-9 {
+		t.Errorf("angle != -1.0 but %f", angle)
+	}
+}
+
+// a glove map of clusters of related words, word c<cluster>_<member>
+func createClusteredMap(num_clusters int, cluster_size int, dim int, seed int64) map[string][]float64 {
+	random := rand.New(rand.NewSource(seed))
+	g_map := make(map[string][]float64)
+	for c := 0; c < num_clusters; c++ {
+		centre := make([]float64, dim)
+		for i := range centre {
+			centre[i] = random.NormFloat64()
+		}
+		for w := 0; w < cluster_size; w++ {
+			vector := make([]float64, dim)
+			for i := range vector {
+				vector[i] = centre[i] + 0.3 * random.NormFloat64()
+			}
+			g_map[fmt.Sprintf("c%d_%d", c, w)] = vector
+		}
+	}
+	return g_map
+}
+
+func TestGloveNearest1(t *testing.T) {
+	g_map := map[string][]float64{"king": {1.0, 0.1}, "queen": {0.9, 0.3}, "apple": {-0.1, 1.0}, "pear": {-0.2, 0.9}}
+	m := new(MapSystem)
+	m.setup(g_map, DefaultIndexOptions)
+	related := m.GetRelatedWords("king", 2)
+	if len(related) != 2 || related[0].Text != "queen" || related[0].Score < related[1].Score {
+		t.Errorf("wrong related words for king %v", related)
+	}
+	if len(m.GetRelatedWords("unknown", 2)) != 0 {
+		t.Errorf("unknown word has related words")
+	}
+	if math.Abs(m.GetVectorAngleUsingNames("apple", "pear") - GetVectorAngle(g_map["apple"], g_map["pear"])) > 1e-6 {
+		t.Errorf("similarity of apple and pear incorrect")
+	}
+}
+
+// the index must find (nearly) all of the exact nearest neighbours
+func TestGloveRecall1(t *testing.T) {
+	m := new(MapSystem)
+	m.setup(createClusteredMap(200, 25, 50, 1), DefaultIndexOptions)
+	recall := m.MeasureRecall(200, 10, 2)
+	if recall < 0.9 {
+		t.Errorf("recall@10 %f below 0.9", recall)
+	}
+	for _, mv := range m.GetRelatedWords("c7_3", 10) {
+		if !strings.HasPrefix(mv.Text, "c7_") {
+			t.Errorf("c7_3 related to %s", mv.Text)
+		}
+	}
+}
+
+var benchmarkMap *MapSystem
+
+func benchmarkSetup() *MapSystem {
+	if benchmarkMap == nil {
+		benchmarkMap = new(MapSystem)
+		benchmarkMap.setup(createClusteredMap(4000, 25, 50, 1), DefaultIndexOptions)
+	}
+	return benchmarkMap
+}
+
+// go test -bench Nearest k-ai/nlu/glove
+func BenchmarkNearestIndex(b *testing.B) {
+	m := benchmarkSetup()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.GetRelatedWords(m.word_list[i % m.Size()], 10)
+	}
+	b.StopTimer()
+	b.Logf("recall@10 %.3f", m.MeasureRecall(100, 10, 3))
+}
+
+func BenchmarkNearestExact(b *testing.B) {
+	m := benchmarkSetup()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		word := m.word_list[i % m.Size()]
+		vector, _ := m.GetVector(word)
+		m.GetNearestExact(vector, 10, word)
+	}
+}
+
+// write the same vectors in each of the file formats
+func writeVectorFiles(t *testing.T, dir string, word_list []string, g_map map[string][]float64) {
+	glove := ""
+	w2v := new(bytes.Buffer)
+	fmt.Fprintf(w2v, "%d %d\n", len(word_list), len(g_map[word_list[0]]))
+	for _, word := range word_list {
+		glove += word
+		w2v.WriteString(word + " ")
+		for _, value := range g_map[word] {
+			glove += fmt.Sprintf(" %f", value)
+			binary.Write(w2v, binary.LittleEndian, float32(value))
+		}
+		glove += "\n"
+		w2v.WriteString("\n")
+	}
+	header := fmt.Sprintf("%d %d\n", len(word_list), len(g_map[word_list[0]]))
+	for filename, contents := range map[string][]byte{"vectors.txt": []byte(glove), "vectors.vec": []byte(header + glove),
+		"vectors.bin": w2v.Bytes()} {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// a temporary directory for the files of a test
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "glove")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// all formats load the same vectors
+func TestVectorFiles1(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	g_map := createClusteredMap(20, 10, 16, 3)
+	word_list := make([]string, 0)
+	for c := 0; c < 20; c++ {
+		for w := 0; w < 10; w++ {
+			word_list = append(word_list, fmt.Sprintf("c%d_%d", c, w))
+		}
+	}
+	writeVectorFiles(t, dir, word_list, g_map)
+
+	expected := new(MapSystem)
+	expected.setup(g_map, DefaultIndexOptions)
+
+	for _, filename := range []string{"vectors.txt", "vectors.vec", "vectors.bin"} {
+		m, err := LoadVectors(filepath.Join(dir, filename), FormatOf(filename), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Size() != len(word_list) || m.Dimension() != 16 {
+			t.Errorf("%s: %d vectors of size %d", filename, m.Size(), m.Dimension())
+		}
+		for _, pair := range [][]string{{"c1_1", "c1_2"}, {"c1_1", "c5_0"}, {"c19_9", "c0_0"}} {
+			if math.Abs(m.GetVectorAngleUsingNames(pair[0], pair[1]) - expected.GetVectorAngleUsingNames(pair[0], pair[1])) > 1e-4 {
+				t.Errorf("%s: similarity of %s and %s incorrect", filename, pair[0], pair[1])
+			}
+		}
+		// a limited vocabulary keeps the first words of the file
+		m, err = LoadVectors(filepath.Join(dir, filename), FormatOf(filename), 15)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, has_first := m.GetVector("c0_0")
+		_, has_last := m.GetVector("c19_9")
+		if m.Size() != 15 || !has_first || has_last {
+			t.Errorf("%s: vocabulary limit not applied, %d words", filename, m.Size())
+		}
+	}
+
+	g, err := CreateGloveMap(filepath.Join(dir, "vectors.txt"))
+	if err != nil || g.Size() != len(word_list) {
+		t.Errorf("CreateGloveMap failed")
+	}
+	g_map2, err := LoadGlove(filepath.Join(dir, "vectors.txt"))
+	if err != nil || len(g_map2) != len(word_list) || math.Abs(g_map2["c3_3"][5] - g_map["c3_3"][5]) > 1e-5 {
+		t.Errorf("LoadGlove failed")
+	}
 }
 
+// the mapped format round trips
+func TestVectorFilesMapped1(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	m := new(MapSystem)
+	m.setup(createClusteredMap(50, 10, 32, 4), DefaultIndexOptions)
+	filename := filepath.Join(dir, "vectors.kvec")
+	if err := m.SaveMapped(filename); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := LoadVectors(filename, FormatOf(filename), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapped.Size() != m.Size() || mapped.Dimension() != m.Dimension() {
+		t.Errorf("mapped %d vectors of size %d", mapped.Size(), mapped.Dimension())
+	}
+	related1 := m.GetRelatedWords("c4_4", 5)
+	related2 := mapped.GetRelatedWords("c4_4", 5)
+	for i := range related1 {
+		if related1[i].Text != related2[i].Text || math.Abs(related1[i].Score - related2[i].Score) > 1e-6 {
+			t.Errorf("mapped related words differ %v %v", related1[i], related2[i])
+		}
+	}
+	if err := mapped.Close(); err != nil || mapped.Size() != 0 {
+		t.Errorf("close failed")
+	}
+
+	limited, err := LoadVectors(filename, FormatMapped, 100)
+	if err != nil || limited.Size() != 100 {
+		t.Errorf("mapped vocabulary limit not applied")
+	}
+	limited.Close()
+
+	ioutil.WriteFile(filepath.Join(dir, "bad.kvec"), []byte("KAIVECS1 not really"), 0644)
+	if _, err := LoadVectors(filepath.Join(dir, "bad.kvec"), FormatMapped, 0); err == nil {
+		t.Errorf("corrupt mapped file loaded")
+	}
+}
+
+// sentences with words of the same meaning are similar
+func TestSentenceVector1(t *testing.T) {
+	m := CreateMapSystem(map[string][]float64{"car": {1.0, 0.1, 0.0}, "automobile": {0.95, 0.15, 0.0},
+		"fast": {0.1, 1.0, 0.0}, "quick": {0.15, 0.9, 0.05}, "the": {0.0, 0.0, 1.0}, "banana": {-1.0, 0.0, 0.2},
+		"new": {0.0, 0.5, 0.5}, "york": {0.5, 0.0, 0.5}})
+	skip := func(word string) bool { return strings.ToLower(word) == "the" }
+
+	v1 := m.SentenceVector([]model.Token{{Text: "The", Tag: "DT"}, {Text: "car", Tag: "NN"}, {Text: "fast", Tag: "RB"}}, skip)
+	v2 := m.SentenceVector([]model.Token{{Text: "automobile", Tag: "NN"}, {Text: "quick", Tag: "JJ"}}, skip)
+	v3 := m.SentenceVector([]model.Token{{Text: "the", Tag: "DT"}, {Text: "banana", Tag: "NN"}}, skip)
+	if CosineSimilarity(v1, v2) < 0.95 || CosineSimilarity(v1, v3) > 0.0 {
+		t.Errorf("incorrect sentence similarities %f %f", CosineSimilarity(v1, v2), CosineSimilarity(v1, v3))
+	}
+	// nothing known, or everything skipped
+	if m.SentenceVector([]model.Token{{Text: "unknown", Tag: "NN"}, {Text: "The", Tag: "DT"}}, skip) != nil {
+		t.Errorf("sentence vector without known words")
+	}
+	// compound words use their parts
+	v4 := m.SentenceVector([]model.Token{{Text: "New York", Tag: "NNP"}}, nil)
+	if v4 == nil || math.Abs(CosineSimilarity(v4, []float32{0.5, 0.5, 1.0}) - 1.0) > 1e-6 {
+		t.Errorf("compound word vector incorrect %v", v4)
+	}
+}
+
+// a is to b as c is to ?
+func TestGloveAnalogy1(t *testing.T) {
+	m := CreateMapSystem(map[string][]float64{"man": {1.0, 0.0, 0.1}, "woman": {1.0, 1.0, 0.1},
+		"king": {1.0, 0.0, 1.0}, "queen": {1.0, 1.0, 1.0}, "apple": {-1.0, 0.2, 0.0}})
+	result, err := m.Analogy("man", "woman", "king", 1)
+	if err != nil || len(result) != 1 || result[0].Text != "queen" {
+		t.Errorf("man:woman::king:queen failed %v %v", result, err)
+	}
+	if _, err := m.Analogy("man", "woman", "pear", 1); err == nil {
+		t.Errorf("analogy with an unknown word")
+	}
+	if word, ok := m.FindWord("Queen"); !ok || word != "queen" {
+		t.Errorf("FindWord failed")
+	}
+}
+
+// unknown words get the semantic of their neighbours
+func TestGuessSemantic1(t *testing.T) {
+	g_map := createClusteredMap(3, 10, 20, 5)
+	m := CreateMapSystem(g_map)
+	// cluster 0 are cities, cluster 1 food, except for a few unlabelled words; cluster 2 is a mix
+	label := func(word string) string {
+		if strings.HasPrefix(word, "c0_") && word != "c0_0" {
+			return "city"
+		} else if strings.HasPrefix(word, "c1_") && word != "c1_0" && word != "c1_1" {
+			return "food"
+		} else if word == "c2_1" || word == "c2_2" {
+			return "animal"
+		} else if word == "c2_3" || word == "c2_4" {
+			return "plant"
+		}
+		return ""
+	}
+	guess, ok := m.GuessSemantic("c0_0", label, 0.6)
+	if !ok || guess.Semantic != "city" || guess.Confidence < 0.99 || len(guess.NeighbourList) != 9 {
+		t.Errorf("c0_0 not a city %v", guess)
+	}
+	guess, ok = m.GuessSemantic("c1_0", label, 0.6)
+	if !ok || guess.Semantic != "food" {
+		t.Errorf("c1_0 not food %v", guess)
+	}
+	// no agreement
+	guess, ok = m.GuessSemantic("c2_0", label, 0.6)
+	if ok || guess.Confidence > 0.6 {
+		t.Errorf("c2_0 guessed without confidence %v", guess)
+	}
+	if _, ok := m.GuessSemantic("unknown", label, 0.0); ok {
+		t.Errorf("guess for an unknown word")
+	}
+}
+
+// a vector index finds the vectors closest to a query, and forgets removed ones
+func TestVectorIndex1(t *testing.T) {
+	g_map := createClusteredMap(20, 10, 16, 5)
+	index := NewVectorIndex(16, len(g_map), DefaultIndexOptions)
+	for word, values := range g_map {
+		vector := make([]float32, len(values))
+		for i, value := range values {
+			vector[i] = float32(value) * 3.0  // scale doesn't matter
+		}
+		index.Add(word, vector)
+	}
+	index.Add("wrong size", []float32{1.0, 2.0})
+	if index.Size() != 200 {
+		t.Fatalf("expected 200 vectors, got %d", index.Size())
+	}
+
+	query := make([]float32, 16)
+	for i, value := range g_map["c3_4"] {
+		query[i] = float32(value)
+	}
+	key_list, score_list := index.Nearest(query, 5, 0.5)
+	if len(key_list) != 5 || key_list[0] != "c3_4" || score_list[0] < 0.99 || score_list[1] > score_list[0] {
+		t.Fatalf("unexpected nearest %v %v", key_list, score_list)
+	}
+	for _, key := range key_list {
+		if !strings.HasPrefix(key, "c3_") {
+			t.Fatalf("%s is not in the cluster of c3_4", key)
+		}
+	}
+
+	// removed vectors are never found again, also after the index is rebuilt
+	for c := 0; c < 20; c++ {
+		for w := 0; w < 10; w++ {
+			if c != 3 || w == 4 {
+				index.Remove(fmt.Sprintf("c%d_%d", c, w))
+			}
+		}
+	}
+	key_list, _ = index.Nearest(query, 5, 0.5)
+	if index.Size() != 9 || len(key_list) != 5 || key_list[0] == "c3_4" {
+		t.Fatalf("unexpected nearest after removal %v", key_list)
+	}
+	key_list, _ = index.Nearest(query, 5, 1.1)
+	if len(key_list) != 0 {
+		t.Fatal("nothing is more similar than the same vector")
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package glove
+
+import (
+	"math"
+	"sort"
+	"math/rand"
+)
+
+//
+// Approximate nearest neighbours: random-projection LSH
+//
+// Each table hashes a (normalised) vector to num_bits bits, a bit being the side of a random
+// hyper-plane the vector is on.  Vectors with a small angle between them are likely to end up
+// in the same bucket in at least one of the tables.  A query collects the vectors in its bucket
+// of every table (and, multi-probe, the buckets of its least certain bits flipped) and these
+// candidates are then scored exactly by their cosine similarity.
+//
+
+// the parameters of the index
+type IndexOptions struct {
+	Tables int   // number of hash tables, more tables: better recall, more memory
+	Bits   int   // bits per hash, 0 for a number of bits suited to the vocabulary size
+	Probes int   // number of extra buckets probed per table per query
+	Seed   int64 // seed of the random hyper-planes
+}
+
+// the default index parameters
+var DefaultIndexOptions = IndexOptions{Tables: 12, Bits: 0, Probes: 4, Seed: 42}
+
+// an LSH index of vectors, by their position in the MapSystem
+type lshIndex struct {
+	dim        int
+	num_bits   int
+	probes     int
+	plane_list [][]float32           // [table * num_bits + bit] -> hyper-plane
+	table_list []map[uint64][]int32  // [table] hash -> vector ids
+}
+
+// the number of bits for a vocabulary of size n, aiming for ~16 vectors per bucket
+func bitsForSize(n int) int {
+	num_bits := int(math.Log2(float64(n) / 16.0))
+	if num_bits < 2 {
+		num_bits = 2
+	} else if num_bits > 24 {
+		num_bits = 24
+	}
+	return num_bits
+}
+
+// create a new empty index for vectors of size dim
+func newLSHIndex(dim int, num_vectors int, options IndexOptions) *lshIndex {
+	x := &lshIndex{dim: dim, num_bits: options.Bits, probes: options.Probes}
+	if x.num_bits <= 0 {
+		x.num_bits = bitsForSize(num_vectors)
+	}
+	if x.probes > x.num_bits {
+		x.probes = x.num_bits
+	}
+	random := rand.New(rand.NewSource(options.Seed))
+	x.plane_list = make([][]float32, options.Tables * x.num_bits)
+	for i := range x.plane_list {
+		plane := make([]float32, dim)
+		for j := range plane {
+			plane[j] = float32(random.NormFloat64())
+		}
+		x.plane_list[i] = plane
+	}
+	x.table_list = make([]map[uint64][]int32, options.Tables)
+	for t := range x.table_list {
+		x.table_list[t] = make(map[uint64][]int32, 0)
+	}
+	return x
+}
+
+// the hash of a vector for a table, and the distance of the vector to each of the table's planes
+func (x *lshIndex) hash(table int, vector []float32, margin_list []float32) uint64 {
+	var hash uint64
+	for b := 0; b < x.num_bits; b++ {
+		projection := dot(x.plane_list[table * x.num_bits + b], vector)
+		if projection >= 0 {
+			hash |= 1 << uint(b)
+		}
+		if margin_list != nil {
+			margin_list[b] = float32(math.Abs(float64(projection)))
+		}
+	}
+	return hash
+}
+
+// add a vector to the index
+func (x *lshIndex) add(id int32, vector []float32) {
+	for t, table := range x.table_list {
+		hash := x.hash(t, vector, nil)
+		table[hash] = append(table[hash], id)
+	}
+}
+
+// the ids of the vectors that are likely to be close to vector
+func (x *lshIndex) candidates(vector []float32) map[int32]bool {
+	candidate_set := make(map[int32]bool, 0)
+	margin_list := make([]float32, x.num_bits)
+	bit_list := make([]int, x.num_bits)
+	for t, table := range x.table_list {
+		hash := x.hash(t, vector, margin_list)
+		for _, id := range table[hash] {
+			candidate_set[id] = true
+		}
+		if x.probes > 0 {
+			// the bits the vector is closest to flipping
+			for b := range bit_list {
+				bit_list[b] = b
+			}
+			sort.Slice(bit_list, func(i, j int) bool { return margin_list[bit_list[i]] < margin_list[bit_list[j]] })
+			for _, b := range bit_list[:x.probes] {
+				for _, id := range table[hash ^ (1 << uint(b))] {
+					candidate_set[id] = true
+				}
+			}
+		}
+	}
+	return candidate_set
+}
+
+// the dot product of two vectors, the cosine similarity of normalised vectors
+func dot(v1 []float32, v2 []float32) float32 {
+	value := float32(0.0)
+	for i := range v1 {
+		value += v1[i] * v2[i]
+	}
+	return value
+}
+
+// normalise a vector in place to length 1, leaves a zero vector alone
+func normalise(vector []float32) {
+	length := math.Sqrt(float64(dot(vector, vector)))
+	if length > 0 {
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / length)
+		}
+	}
+}
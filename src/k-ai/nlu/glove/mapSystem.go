@@ -12,92 +12,262 @@
 package glove
 
 import (
-	"math"
 	"sort"
+	"errors"
+	"strings"
+	"math/rand"
+	"container/heap"
 )
 
 // a system for referencing all lookup information
-// for a glove vector and its distances
+// for a glove vector and its nearest neighbours
 type MapSystem struct {
-	g_map map[string][]float64          // the glove string -> []vector
-	size float64                        // size of the indexes
-	location_array [][]MatchVector      // [index][list of items @ index]
-}
-
-// calculate distance squared between two vectors
-// and return the distance value and the index
-func (m MapSystem)to_index(v2 []float64) (float64, int) {
-	value := 0.0
-	for i := 0; i < len(v2); i++ {
-		diff := v2[i]
-		value += diff * diff
-	}
-	score := math.Sqrt(value) / float64(len(v2))
-	return score, int(score * m.size)
-}
-
-// return the angle between two vectors - their relatedness
-func (m MapSystem) GetVectorAngleUsingNames(v1_name string, v2_name string) (float64) {
-	return GetVectorAngle(m.g_map[v1_name], m.g_map[v2_name])
-}
-
-// test a vector and get its closest relatives
-// word: the word to find relationships for
-// dist: the distance around the word 0..x
-func (m MapSystem) GetRelatedWords(word string, dist int) (MatchVectors) {
-
-	return_value := make(MatchVectors,0)
-	int_size := int(m.size)
-	divisor := float64(dist)
-	if divisor == 0.0 { divisor = 1.0 }
-
-	if val, ok := m.g_map[word]; ok {  // does it exist in the map?
-		_, index := m.to_index(val)  // get the index of the closest neighbour
-		if index < int_size {
-			start := index - dist
-			if start < 0 { start = 0 }
-			end := index + dist + 1
-			if end > int_size { end = int_size }
-			for index_offset := start; index_offset < end; index_offset++ {
-				value := m.location_array[index_offset]
-				if value != nil {
-					for _, mv := range value {
-						return_value = append(return_value,
-							MatchVector{Text: mv.Text,
-								Score: m.GetVectorAngleUsingNames(word, mv.Text),
-								Vector: mv.Vector})
-					}
-				}
-			}
+	dim        int             // the size of each vector
+	word_list  []string        // id -> word
+	word_index map[string]int  // word -> id
+	vectors    []float32       // all normalised vectors, contiguous, dim per id
+	index      *lshIndex       // the approximate nearest neighbour index
+	mapping    []byte          // the memory mapped file holding vectors, if any (see vector_files.go)
+}
+
+// the number of words in the system
+func (m *MapSystem) Size() int {
+	return len(m.word_list)
+}
+
+// the size of the vectors
+func (m *MapSystem) Dimension() int {
+	return m.dim
+}
+
+// the vector of an id
+func (m *MapSystem) vector(id int) []float32 {
+	return m.vectors[id * m.dim : (id + 1) * m.dim]
+}
+
+// the (normalised) vector of a word, do not modify
+func (m *MapSystem) GetVector(word string) ([]float32, bool) {
+	if id, ok := m.word_index[word]; ok {
+		return m.vector(id), true
+	}
+	return nil, false
+}
+
+// the word as the system knows it: as is or in lower case, and whether it's known at all
+func (m *MapSystem) FindWord(word string) (string, bool) {
+	if _, ok := m.word_index[word]; ok {
+		return word, true
+	}
+	if _, ok := m.word_index[strings.ToLower(word)]; ok {
+		return strings.ToLower(word), true
+	}
+	return word, false
+}
+
+// return the cosine similarity of two words (-1..1), 0 if either is unknown
+func (m *MapSystem) GetVectorAngleUsingNames(v1_name string, v2_name string) float64 {
+	v1, ok1 := m.GetVector(v1_name)
+	v2, ok2 := m.GetVector(v2_name)
+	if !ok1 || !ok2 {
+		return 0.0
+	}
+	return float64(dot(v1, v2))
+}
+
+// the k words closest to word (excluding the word itself), most similar first
+func (m *MapSystem) GetRelatedWords(word string, k int) MatchVectors {
+	if vector, ok := m.GetVector(word); ok {
+		return m.GetNearest(vector, k, word)
+	}
+	return make(MatchVectors, 0)
+}
+
+// solve the analogy a is to b as c is to ?, the k words closest to b - a + c (excluding a, b and c)
+func (m *MapSystem) Analogy(a string, b string, c string, k int) (MatchVectors, error) {
+	vector_list := make([][]float32, 0)
+	for _, word := range []string{a, b, c} {
+		vector, ok := m.GetVector(word)
+		if !ok {
+			return nil, errors.New("unknown word \"" + word + "\"")
 		}
+		vector_list = append(vector_list, vector)
 	}
-	if len(return_value) > 0 {
-		sort.Sort(return_value)
+	query := make([]float32, m.dim)
+	for i := range query {
+		query[i] = vector_list[1][i] - vector_list[0][i] + vector_list[2][i]
 	}
-	return return_value
+	return m.GetNearest(query, k, a, b, c), nil
 }
 
-// setup a the MapSystem with related items and distances
-// g_map: the existing map with all glove vectors
-// size: the scaling offset 100,000 to 1,000,000 recommended
-func (m *MapSystem) setup(g_map map[string][]float64, size float64) {
-	m.g_map = g_map
-	// pick an arbitrary vector
-	m.size = size
+// the (approximate) k words closest to a vector, most similar first, leaving out the words in exclude
+func (m *MapSystem) GetNearest(vector []float32, k int, exclude ...string) MatchVectors {
+	query := m.normalisedQuery(vector)
+	if query == nil || m.index == nil {
+		return m.GetNearestExact(vector, k, exclude...)
+	}
+	top := newTopK(k)
+	for id := range m.index.candidates(query) {
+		m.offer(top, int(id), query, exclude)
+	}
+	return top.result(m)
+}
 
-	// setup a new slice for the size of the matches
-	m.location_array = make([][]MatchVector, int(size), int(size))
+// the exact k words closest to a vector (brute force), most similar first, leaving out the words in exclude
+func (m *MapSystem) GetNearestExact(vector []float32, k int, exclude ...string) MatchVectors {
+	query := m.normalisedQuery(vector)
+	top := newTopK(k)
+	if query != nil {
+		for id := range m.word_list {
+			m.offer(top, id, query, exclude)
+		}
+	}
+	return top.result(m)
+}
 
-	// setup this array
-	for key, value := range g_map {
-		_, index := m.to_index(value)
-		if index < int(size) {
-			if m.location_array[index] == nil {
-				m.location_array[index] = make([]MatchVector, 0)
+// measure the recall@k of the index against brute force for sample_size random words
+// i.e. the fraction of the exact k nearest neighbours the index finds
+func (m *MapSystem) MeasureRecall(sample_size int, k int, seed int64) float64 {
+	if m.Size() == 0 || sample_size <= 0 {
+		return 1.0
+	}
+	random := rand.New(rand.NewSource(seed))
+	found := 0
+	total := 0
+	for i := 0; i < sample_size; i++ {
+		word := m.word_list[random.Intn(m.Size())]
+		vector := m.vector(m.word_index[word])
+		approximate_set := make(map[string]bool, 0)
+		for _, mv := range m.GetNearest(vector, k, word) {
+			approximate_set[mv.Text] = true
+		}
+		for _, mv := range m.GetNearestExact(vector, k, word) {
+			if approximate_set[mv.Text] {
+				found += 1
 			}
-			mv := MatchVector {Text: key, Vector: value, Score: 0.0}
-			m.location_array[index] = append(m.location_array[index], mv)
+			total += 1
+		}
+	}
+	if total == 0 {
+		return 1.0
+	}
+	return float64(found) / float64(total)
+}
+
+// a normalised copy of a query vector, nil if it can't be compared with our vectors
+func (m *MapSystem) normalisedQuery(vector []float32) []float32 {
+	if len(vector) != m.dim || m.dim == 0 {
+		return nil
+	}
+	query := make([]float32, m.dim)
+	copy(query, vector)
+	normalise(query)
+	return query
+}
+
+// score an id against a query for a top-k
+func (m *MapSystem) offer(top *topK, id int, query []float32, exclude []string) {
+	for _, word := range exclude {
+		if m.word_list[id] == word {
+			return
+		}
+	}
+	top.offer(id, dot(query, m.vector(id)))
+}
+
+// a new MapSystem of a set of vectors, with its index
+func newMapSystem(vs *vectorSet, options IndexOptions) *MapSystem {
+	m := &MapSystem{dim: vs.dim, word_list: vs.word_list, word_index: vs.word_index, vectors: vs.vectors,
+		mapping: vs.mapping}
+	if !vs.normalised {
+		for id := range m.word_list {
+			normalise(m.vector(id))
 		}
 	}
+	m.BuildIndex(options)
+	return m
+}
+
+// create a MapSystem with a nearest neighbour index from a map of word -> vector
+func CreateMapSystem(g_map map[string][]float64) *MapSystem {
+	m := new(MapSystem)
+	m.setup(g_map, DefaultIndexOptions)
+	return m
+}
+
+// setup the MapSystem from a glove map of word -> vector and build its index
+func (m *MapSystem) setup(g_map map[string][]float64, options IndexOptions) {
+	word_list := make([]string, 0, len(g_map))
+	for word := range g_map {
+		word_list = append(word_list, word)
+	}
+	sort.Strings(word_list)  // same ids each time
+	vs := newVectorSet(0, len(word_list))
+	for _, word := range word_list {
+		vs.dim = len(g_map[word])
+		vector := make([]float32, vs.dim)
+		for i, value := range g_map[word] {
+			vector[i] = float32(value)
+		}
+		vs.add(word, vector)
+	}
+	*m = *newMapSystem(vs, options)
+}
+
+// (re)build the nearest neighbour index of the MapSystem
+func (m *MapSystem) BuildIndex(options IndexOptions) {
+	index := newLSHIndex(m.dim, m.Size(), options)
+	for id := range m.word_list {
+		index.add(int32(id), m.vector(id))
+	}
+	m.index = index
 }
 
+// a scored id for a top-k
+type scoredId struct {
+	id    int
+	score float32
+}
+
+// the k best scoring ids, a min-heap so the worst of the best is on top
+type topK struct {
+	k         int
+	item_list []scoredId
+}
+
+func newTopK(k int) *topK {
+	return &topK{k: k, item_list: make([]scoredId, 0)}
+}
+
+func (t *topK) Len() int { return len(t.item_list) }
+func (t *topK) Less(i, j int) bool { return t.item_list[i].score < t.item_list[j].score }
+func (t *topK) Swap(i, j int) { t.item_list[i], t.item_list[j] = t.item_list[j], t.item_list[i] }
+func (t *topK) Push(x interface{}) { t.item_list = append(t.item_list, x.(scoredId)) }
+func (t *topK) Pop() interface{} {
+	item := t.item_list[len(t.item_list) - 1]
+	t.item_list = t.item_list[:len(t.item_list) - 1]
+	return item
+}
+
+// add an id if it's one of the k best so far
+func (t *topK) offer(id int, score float32) {
+	if t.k <= 0 {
+		return
+	}
+	if len(t.item_list) < t.k {
+		heap.Push(t, scoredId{id: id, score: score})
+	} else if score > t.item_list[0].score {
+		t.item_list[0] = scoredId{id: id, score: score}
+		heap.Fix(t, 0)
+	}
+}
+
+// the words of the top-k, most similar first
+func (t *topK) result(m *MapSystem) MatchVectors {
+	return_value := make(MatchVectors, 0, len(t.item_list))
+	for _, item := range t.item_list {
+		return_value = append(return_value, MatchVector{Text: m.word_list[item.id],
+			Score: float64(item.score), Vector: m.vector(item.id)})
+	}
+	sort.Sort(return_value)
+	return return_value
+}
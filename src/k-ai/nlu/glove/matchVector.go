@@ -13,9 +13,9 @@ package glove
 
 // a single entry - the text, the vector, and its score relative to some query
 type MatchVector struct {
-	Text string             // glove text
-	Score float64           // scoring for searching
-	Vector []float64        // glove vector
+	Text string             `json:"text"`   // glove text
+	Score float64           `json:"score"`  // scoring for searching
+	Vector []float32        `json:"-"`      // normalised glove vector, do not modify
 }
 
 // for sorting the vector - a data-type defn.
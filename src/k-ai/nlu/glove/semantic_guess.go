@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package glove
+
+import (
+	"sort"
+)
+
+//
+// Semantic guesses
+//
+// A word the lexicon has no semantic for can borrow one from its neighbours in vector space:
+// each of its nearest neighbours that has a semantic votes for it, weighed by its similarity
+// to the word.  The guess is the semantic with the most votes, its confidence the share of the
+// votes it got.  e.g. "zurich" is close to "geneva", "basel" and "munich", all cities.
+//
+
+// the number of neighbours consulted for a guess
+const SemanticNeighbours = 25
+
+// the minimum similarity of a neighbour that votes
+const SemanticMinSimilarity = 0.5
+
+// the minimum number of neighbours that have to agree on a semantic
+const SemanticMinVotes = 2
+
+// a semantic proposed for a word by its neighbours
+type SemanticGuess struct {
+	Word          string   `json:"word"`
+	Semantic      string   `json:"semantic"`
+	Confidence    float64  `json:"confidence"`      // the share of the neighbours' votes for the semantic (0..1)
+	NeighbourList []string `json:"neighbour_list"`  // the neighbours that voted for the semantic, closest first
+}
+
+// guess the semantic of a word from its neighbours, if the guess' confidence is at least min_confidence
+// label: the semantic of a word, empty if it has none
+func (m *MapSystem) GuessSemantic(word string, label func(string) string, min_confidence float64) (SemanticGuess, bool) {
+	guess := SemanticGuess{Word: word}
+	word, ok := m.FindWord(word)
+	if !ok {
+		return guess, false
+	}
+	vote_map := make(map[string]float64, 0)
+	voter_map := make(map[string][]string, 0)
+	total := 0.0
+	for _, neighbour := range m.GetRelatedWords(word, SemanticNeighbours) {
+		if neighbour.Score < SemanticMinSimilarity {
+			break  // closest first
+		}
+		semantic := label(neighbour.Text)
+		if len(semantic) > 0 {
+			vote_map[semantic] += neighbour.Score
+			voter_map[semantic] = append(voter_map[semantic], neighbour.Text)
+			total += neighbour.Score
+		}
+	}
+	if total == 0.0 {
+		return guess, false
+	}
+	semantic_list := make([]string, 0)
+	for semantic := range vote_map {
+		semantic_list = append(semantic_list, semantic)
+	}
+	sort.Strings(semantic_list)  // the same guess for a tie, each time
+	for _, semantic := range semantic_list {
+		if vote_map[semantic] > vote_map[guess.Semantic] {
+			guess.Semantic = semantic
+		}
+	}
+	guess.Confidence = vote_map[guess.Semantic] / total
+	guess.NeighbourList = voter_map[guess.Semantic]
+	return guess, guess.Confidence >= min_confidence && len(guess.NeighbourList) >= SemanticMinVotes
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package glove
+
+import (
+	"math"
+	"strings"
+	"k-ai/nlu/model"
+)
+
+//
+// Sentence vectors
+//
+// The vector of a sentence is the weighted average of the vectors of its words, content words
+// (nouns, verbs, ...) weighing more than function words.  Words without a vector, and the words
+// the caller wants skipped (e.g. the lexicon's undesirables), don't count.  Compound words like
+// "New York" use the average of their parts' vectors when they don't have one of their own.
+//
+
+// the weight of a token in a sentence vector, by its tag
+func tokenWeight(tag string) float32 {
+	if strings.HasPrefix(tag, "NN") {
+		return 1.0
+	} else if strings.HasPrefix(tag, "VB") {
+		return 0.75
+	} else if strings.HasPrefix(tag, "JJ") || strings.HasPrefix(tag, "RB") || tag == "CD" {
+		return 0.5
+	}
+	return 0.25
+}
+
+// the vector of a word, trying it in lower case first
+func (m *MapSystem) wordVector(word string) ([]float32, bool) {
+	if vector, ok := m.GetVector(strings.ToLower(word)); ok {
+		return vector, true
+	}
+	return m.GetVector(word)
+}
+
+// the normalised vector of a sentence, nil if none of its words have a vector
+// skip: words to leave out, can be nil
+func (m *MapSystem) SentenceVector(token_list []model.Token, skip func(string) bool) []float32 {
+	sentence_vector := make([]float32, m.dim)
+	total_weight := float32(0.0)
+	for _, t_token := range token_list {
+		if skip != nil && skip(t_token.Text) {
+			continue
+		}
+		part_list := []string{t_token.Text}
+		if _, ok := m.wordVector(t_token.Text); !ok {
+			part_list = strings.FieldsFunc(t_token.Text, func(r rune) bool { return r == ' ' || r == '-' })
+		}
+		weight := tokenWeight(t_token.Tag) / float32(len(part_list))
+		for _, part := range part_list {
+			if skip != nil && skip(part) {
+				continue
+			}
+			if vector, ok := m.wordVector(part); ok {
+				for i, value := range vector {
+					sentence_vector[i] += weight * value
+				}
+				total_weight += weight
+			}
+		}
+	}
+	if total_weight == 0.0 {
+		return nil
+	}
+	normalise(sentence_vector)
+	return sentence_vector
+}
+
+// the cosine similarity of two vectors of the same size (-1..1)
+func CosineSimilarity(v1 []float32, v2 []float32) float64 {
+	l_v1 := dot(v1, v1)
+	l_v2 := dot(v2, v2)
+	if len(v1) != len(v2) || l_v1 == 0.0 || l_v2 == 0.0 {
+		return 0.0
+	}
+	return float64(dot(v1, v2)) / math.Sqrt(float64(l_v1) * float64(l_v2))
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package glove
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"math"
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+	"reflect"
+	"unsafe"
+	"encoding/binary"
+	"path/filepath"
+	"k-ai/logger"
+)
+
+//
+// Word vector files
+//
+// glove:    text, one "word f f ... f" per line
+// fasttext: text (.vec), a "count dim" header line followed by glove lines
+// word2vec: binary (.bin), a "count dim\n" header followed by "word " and dim little-endian
+//           float32s for each word
+// mapped:   our own binary format (.kvec), generated once from any of the above with SaveMapped
+//           and memory-mapped when loaded, so it loads in seconds and its vectors are shared
+//           between processes:
+//             "KAIVECS1", uint32 dim, uint32 count, uint64 offset of the words
+//             count * dim float32 normalised vectors
+//             count words, each a uint16 length followed by its bytes
+//           all little-endian
+//
+// Vector files are ordered most frequent word first, so a vocabulary limit keeps the most
+// useful words.
+//
+
+// the vector file formats
+const (
+	FormatGlove    = "glove"
+	FormatFastText = "fasttext"
+	FormatWord2Vec = "word2vec"
+	FormatMapped   = "mapped"
+)
+
+// the magic of a mapped file and the size of its header
+const mappedMagic = "KAIVECS1"
+const mappedHeaderSize = 24
+
+// the format of a vector file by its extension, glove if unknown
+func FormatOf(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".vec":
+		return FormatFastText
+	case ".bin":
+		return FormatWord2Vec
+	case ".kvec":
+		return FormatMapped
+	}
+	return FormatGlove
+}
+
+// a set of word vectors as read from file
+type vectorSet struct {
+	dim        int
+	word_list  []string
+	word_index map[string]int
+	vectors    []float32       // contiguous, dim per word
+	normalised bool            // are the vectors normalised already?
+	mapping    []byte          // the memory mapped file of the vectors, if mapped
+}
+
+func newVectorSet(dim int, capacity int) *vectorSet {
+	return &vectorSet{dim: dim, word_list: make([]string, 0, capacity), word_index: make(map[string]int, capacity),
+		vectors: make([]float32, 0, capacity * dim)}
+}
+
+// add a word's vector, the first vector of a word wins
+func (vs *vectorSet) add(word string, vector []float32) {
+	if _, ok := vs.word_index[word]; !ok {
+		vs.word_index[word] = len(vs.word_list)
+		vs.word_list = append(vs.word_list, word)
+		vs.vectors = append(vs.vectors, vector...)
+	}
+}
+
+// load word vectors from file into a new MapSystem with a nearest neighbour index
+// format: one of the Format constants
+// max_words: only load the first max_words words of the file, 0 for all
+func LoadVectors(filename string, format string, max_words int) (*MapSystem, error) {
+	logger.Log.Info("loading %s vectors from %s", format, filename)
+	var vs *vectorSet
+	var err error
+	switch format {
+	case FormatGlove:
+		vs, err = readTextVectors(filename, false, max_words)
+	case FormatFastText:
+		vs, err = readTextVectors(filename, true, max_words)
+	case FormatWord2Vec:
+		vs, err = readWord2Vec(filename, max_words)
+	case FormatMapped:
+		vs, err = mapVectors(filename, max_words)
+	default:
+		return nil, errors.New("unknown vector file format \"" + format + "\"")
+	}
+	if err != nil { return nil, err }
+	logger.Log.Info("%d vectors of size %d loaded, indexing", len(vs.word_list), vs.dim)
+	result := newMapSystem(vs, DefaultIndexOptions)
+	logger.Log.Info("vectors indexed")
+	return result, nil
+}
+
+// read a text vector file, with or without a "count dim" header line
+func readTextVectors(filename string, has_header bool, max_words int) (*vectorSet, error) {
+	file, err := os.Open(filename)
+	if err != nil { return nil, err }
+	defer file.Close()
+
+	var vs *vectorSet
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024 * 1024), 16 * 1024 * 1024)
+	line_number := 0
+	for scanner.Scan() && (max_words <= 0 || vs == nil || len(vs.word_list) < max_words) {
+		line_number += 1
+		words := strings.Fields(scanner.Text())  // split
+		if len(words) == 0 {
+			continue
+		}
+		if has_header && line_number == 1 {
+			count, dim, err := parseHeader(words)
+			if err != nil { return nil, errors.New(filename + ": " + err.Error()) }
+			vs = newVectorSet(dim, capacity(count, max_words))
+			continue
+		}
+		if vs == nil {
+			vs = newVectorSet(len(words) - 1, capacity(0, max_words))
+		}
+		if len(words) - 1 != vs.dim {
+			return nil, errors.New(fmt.Sprintf("%s:%d: inconsistent vector size, expected vectors of size %d but got %d",
+				filename, line_number, vs.dim, len(words) - 1))
+		}
+		vector := make([]float32, vs.dim)
+		for i := range vector {
+			value, err := strconv.ParseFloat(words[i + 1], 32)
+			if err != nil { return nil, errors.New(fmt.Sprintf("%s:%d: %s", filename, line_number, err.Error())) }
+			vector[i] = float32(value)
+		}
+		vs.add(words[0], vector)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if vs == nil {
+		return nil, errors.New(filename + ": no vectors")
+	}
+	return vs, nil
+}
+
+// parse a "count dim" header
+func parseHeader(words []string) (int, int, error) {
+	if len(words) != 2 {
+		return 0, 0, errors.New("invalid header, expected \"count dim\"")
+	}
+	count, err1 := strconv.Atoi(words[0])
+	dim, err2 := strconv.Atoi(words[1])
+	if err1 != nil || err2 != nil || count < 0 || dim <= 0 {
+		return 0, 0, errors.New("invalid header, expected \"count dim\"")
+	}
+	return count, dim, nil
+}
+
+// the number of words to make room for
+func capacity(count int, max_words int) int {
+	if max_words > 0 && (count == 0 || max_words < count) {
+		return max_words
+	}
+	return count
+}
+
+// read a binary word2vec file
+func readWord2Vec(filename string, max_words int) (*vectorSet, error) {
+	file, err := os.Open(filename)
+	if err != nil { return nil, err }
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 1024 * 1024)
+	header, err := reader.ReadString('\n')
+	if err != nil { return nil, errors.New(filename + ": missing header") }
+	count, dim, err := parseHeader(strings.Fields(header))
+	if err != nil { return nil, errors.New(filename + ": " + err.Error()) }
+
+	vs := newVectorSet(dim, capacity(count, max_words))
+	buffer := make([]byte, 4 * dim)
+	for i := 0; i < count && (max_words <= 0 || len(vs.word_list) < max_words); i++ {
+		word, err := reader.ReadString(' ')
+		if err != nil { return nil, errors.New(fmt.Sprintf("%s: word %d: %s", filename, i + 1, err.Error())) }
+		word = strings.TrimSpace(word)  // some writers end each vector with a newline
+		_, err = io.ReadFull(reader, buffer)
+		if err != nil { return nil, errors.New(fmt.Sprintf("%s: vector %d: %s", filename, i + 1, err.Error())) }
+		vector := make([]float32, dim)
+		for j := range vector {
+			vector[j] = math.Float32frombits(binary.LittleEndian.Uint32(buffer[j * 4:]))
+		}
+		vs.add(word, vector)
+	}
+	return vs, nil
+}
+
+// save the vectors of a MapSystem to file in the mapped format
+func (m *MapSystem) SaveMapped(filename string) error {
+	temp_filename := filename + ".tmp"
+	file, err := os.Create(temp_filename)
+	if err != nil { return err }
+	writer := bufio.NewWriterSize(file, 1024 * 1024)
+
+	header := make([]byte, mappedHeaderSize)
+	copy(header, mappedMagic)
+	binary.LittleEndian.PutUint32(header[8:], uint32(m.dim))
+	binary.LittleEndian.PutUint32(header[12:], uint32(m.Size()))
+	binary.LittleEndian.PutUint64(header[16:], uint64(mappedHeaderSize + 4 * len(m.vectors)))
+	writer.Write(header)
+	buffer := make([]byte, 4)
+	for _, value := range m.vectors {
+		binary.LittleEndian.PutUint32(buffer, math.Float32bits(value))
+		writer.Write(buffer)
+	}
+	for _, word := range m.word_list {
+		if len(word) > math.MaxUint16 {
+			file.Close()
+			os.Remove(temp_filename)
+			return errors.New("word too long for a mapped vector file: " + word[:32] + "...")
+		}
+		binary.LittleEndian.PutUint16(buffer, uint16(len(word)))
+		writer.Write(buffer[:2])
+		writer.WriteString(word)
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		os.Remove(temp_filename)
+		return err
+	}
+	return os.Rename(temp_filename, filename)
+}
+
+// memory map a mapped vector file
+func mapVectors(filename string, max_words int) (*vectorSet, error) {
+	data, err := mapFile(filename)
+	if err != nil { return nil, err }
+	vs, err := parseMapped(data, max_words)
+	if err != nil {
+		unmapFile(data)
+		return nil, errors.New(filename + ": " + err.Error())
+	}
+	vs.mapping = data
+	return vs, nil
+}
+
+// the vectors and words of a mapped file, the vectors pointing into data
+func parseMapped(data []byte, max_words int) (*vectorSet, error) {
+	if len(data) < mappedHeaderSize || string(data[:8]) != mappedMagic {
+		return nil, errors.New("not a mapped vector file")
+	}
+	if !isLittleEndian() {
+		return nil, errors.New("mapped vector files need a little-endian machine")
+	}
+	dim := int(binary.LittleEndian.Uint32(data[8:]))
+	count := int(binary.LittleEndian.Uint32(data[12:]))
+	words_offset := int(binary.LittleEndian.Uint64(data[16:]))
+	if dim <= 0 || words_offset != mappedHeaderSize + 4 * dim * count || words_offset > len(data) {
+		return nil, errors.New("corrupt mapped vector file")
+	}
+	num_words := capacity(count, max_words)
+	vs := &vectorSet{dim: dim, word_list: make([]string, 0, num_words), word_index: make(map[string]int, num_words),
+		normalised: true}
+	if count > 0 {
+		// the vectors are used where they are, in the mapped memory
+		header := (*reflect.SliceHeader)(unsafe.Pointer(&vs.vectors))
+		header.Data = uintptr(unsafe.Pointer(&data[mappedHeaderSize]))
+		header.Len = dim * num_words
+		header.Cap = dim * num_words
+	}
+	offset := words_offset
+	for i := 0; i < num_words; i++ {
+		if offset + 2 > len(data) {
+			return nil, errors.New("corrupt mapped vector file")
+		}
+		size := int(binary.LittleEndian.Uint16(data[offset:]))
+		if offset + 2 + size > len(data) {
+			return nil, errors.New("corrupt mapped vector file")
+		}
+		word := string(data[offset + 2 : offset + 2 + size])
+		vs.word_index[word] = i
+		vs.word_list = append(vs.word_list, word)
+		offset += 2 + size
+	}
+	return vs, nil
+}
+
+// is this a little-endian machine? (the mapped vectors are used as they are in memory)
+func isLittleEndian() bool {
+	value := uint16(1)
+	return *(*byte)(unsafe.Pointer(&value)) == 1
+}
+
+// release the memory mapped file of a MapSystem, if it has one, the MapSystem can't be used after
+func (m *MapSystem) Close() error {
+	if m.mapping == nil {
+		return nil
+	}
+	data := m.mapping
+	m.mapping = nil
+	m.vectors = nil
+	m.word_list = nil
+	m.word_index = make(map[string]int, 0)
+	m.index = nil
+	return unmapFile(data)
+}
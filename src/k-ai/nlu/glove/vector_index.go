@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package glove
+
+import (
+	"sort"
+	"sync"
+)
+
+// an LSH index of vectors by key that can change after it is built, e.g. the sentence vectors of a topic
+// a removed vector leaves its slot behind, the index is rebuilt once half of them are empty
+type VectorIndex struct {
+	dim         int
+	options     IndexOptions
+	index       *lshIndex
+	key_list    []string          // id -> key, "" if removed
+	vector_list [][]float32       // id -> normalised vector, nil if removed
+	id_map      map[string]int32  // key -> id
+	sync.RWMutex
+}
+
+// create a new empty index for vectors of size dim, expecting about num_vectors of them
+func NewVectorIndex(dim int, num_vectors int, options IndexOptions) *VectorIndex {
+	return &VectorIndex{dim: dim, options: options, index: newLSHIndex(dim, num_vectors, options),
+		key_list: make([]string, 0), vector_list: make([][]float32, 0), id_map: make(map[string]int32, 0)}
+}
+
+// the number of vectors in the index
+func (v *VectorIndex) Size() int {
+	v.RLock()
+	defer v.RUnlock()
+	return len(v.id_map)
+}
+
+// add (or replace) the vector of a key, vectors of the wrong size are ignored
+func (v *VectorIndex) Add(key string, vector []float32) {
+	if len(vector) != v.dim || len(key) == 0 {
+		return
+	}
+	normalised := make([]float32, v.dim)
+	copy(normalised, vector)
+	normalise(normalised)
+
+	v.Lock()
+	defer v.Unlock()
+	v.remove(key)
+	id := int32(len(v.key_list))
+	v.key_list = append(v.key_list, key)
+	v.vector_list = append(v.vector_list, normalised)
+	v.id_map[key] = id
+	v.index.add(id, normalised)
+}
+
+// remove the vector of a key, if it is there
+func (v *VectorIndex) Remove(key string) {
+	v.Lock()
+	defer v.Unlock()
+	v.remove(key)
+	if len(v.key_list) > 16 && len(v.id_map) < len(v.key_list) / 2 {
+		v.rebuild()
+	}
+}
+
+// remove a key, the lock is held
+func (v *VectorIndex) remove(key string) {
+	if id, ok := v.id_map[key]; ok {
+		v.key_list[id] = ""
+		v.vector_list[id] = nil
+		delete(v.id_map, key)
+	}
+}
+
+// index the vectors still there from scratch, the lock is held
+func (v *VectorIndex) rebuild() {
+	key_list := make([]string, 0, len(v.id_map))
+	vector_list := make([][]float32, 0, len(v.id_map))
+	index := newLSHIndex(v.dim, len(v.id_map), v.options)
+	for id, key := range v.key_list {
+		if v.vector_list[id] != nil {
+			new_id := int32(len(key_list))
+			key_list = append(key_list, key)
+			vector_list = append(vector_list, v.vector_list[id])
+			v.id_map[key] = new_id
+			index.add(new_id, v.vector_list[id])
+		}
+	}
+	v.key_list = key_list
+	v.vector_list = vector_list
+	v.index = index
+}
+
+// the keys of the (at most) n vectors closest to vector with a cosine similarity of at least threshold,
+// the most similar first, and their similarities
+func (v *VectorIndex) Nearest(vector []float32, n int, threshold float64) ([]string, []float64) {
+	key_list := make([]string, 0)
+	score_list := make([]float64, 0)
+	if len(vector) != v.dim {
+		return key_list, score_list
+	}
+	query := make([]float32, v.dim)
+	copy(query, vector)
+	normalise(query)
+
+	v.RLock()
+	defer v.RUnlock()
+	top := newTopK(n)
+	for id := range v.index.candidates(query) {
+		if v.vector_list[id] == nil {
+			continue
+		}
+		score := dot(query, v.vector_list[id])
+		if float64(score) >= threshold {
+			top.offer(int(id), score)
+		}
+	}
+	sort.Slice(top.item_list, func(i, j int) bool { return top.item_list[i].score > top.item_list[j].score })
+	for _, item := range top.item_list {
+		key_list = append(key_list, v.key_list[item.id])
+		score_list = append(score_list, float64(item.score))
+	}
+	return key_list, score_list
+}
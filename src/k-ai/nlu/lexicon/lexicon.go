@@ -27,7 +27,12 @@ type SLexicon struct {
 	plural       map[string]string        // lwr(plural) -> lwr(singular)
 	verb         map[string]string        // lwr(non-vb-verb) -> lwr(vb_verb)
 	Semantic     map[string]string        // lwr(noun) -> semantic_for_noun
+	semanticParent map[string]string      // semantic -> the semantic it is a kind of (see semantic_hierarchy.go)
+	overlays     map[string]map[string]string // scope -> word -> semantic (see overlay.go)
+	rejected     map[string]map[string]bool   // scope -> words whose guessed semantic was rejected (see overlay.go)
 	LWord        map[string][]model.Token // longest word multiple nouns
+	compoundTrie *wordTrie                // LWord as a trie for matching (see word_trie.go)
+	compoundSet  map[string]map[string]bool // lwr(part) -> the compound words it is part of
 	Undesirables map[string]bool          // list of undesirable words
 
 	stemSet      map[string]map[string]bool // stemmed word -> list of related words
@@ -35,11 +40,57 @@ type SLexicon struct {
 
 	seen		map[string] bool			// temp map for speeding up loading
 
-	sync.Mutex
+	sync.RWMutex	// the lexicon can change at runtime (see lexicon_updates.go)
+
+	lazy         bool                     // load from file on first use (see load)
+	load_once    sync.Once
+}
+
+// the lexicon global placeholder, loaded when it is first used, not when the package is imported
+var Lexi = SLexicon{lazy: true}
+
+// lock the lexicon for reading, loading it first if needed
+func (l *SLexicon) RLock() {
+	l.load()
+	l.RWMutex.RLock()
 }
 
-// the lexicon global placeholder
-var Lexi = SLexicon{}
+// lock the lexicon for writing, loading it first if needed
+func (l *SLexicon) Lock() {
+	l.load()
+	l.RWMutex.Lock()
+}
+
+// load a lazy lexicon from file, once
+// every access to the lexicon takes its lock, so this happens on first use
+// loading itself takes the lock too, so it is done in a separate lexicon whose contents are then taken over
+func (l *SLexicon) load() {
+	if !l.lazy {
+		return
+	}
+	l.load_once.Do(func() {
+		loaded := &SLexicon{}
+		err := loaded.initFromFile()
+		if err != nil {
+			panic(err)
+		}
+		l.RWMutex.Lock()
+		defer l.RWMutex.Unlock()
+		l.initialised = loaded.initialised
+		l.plural = loaded.plural
+		l.verb = loaded.verb
+		l.Semantic = loaded.Semantic
+		l.semanticParent = loaded.semanticParent
+		l.overlays = loaded.overlays
+		l.rejected = loaded.rejected
+		l.LWord = loaded.LWord
+		l.compoundTrie = loaded.compoundTrie
+		l.compoundSet = loaded.compoundSet
+		l.Undesirables = loaded.Undesirables
+		l.stemSet = loaded.stemSet
+		l.synonymSet = loaded.synonymSet
+	})
+}
 
 // set a related word if dne
 func (l *SLexicon) add_stem_word(baseWord string, relatedWord string) {
@@ -150,25 +201,57 @@ func (l *SLexicon) testAndAddCompoundWordWithCache(word_str string) {
 		if isCompound {
 			parts := tokenizer.FilterOutSpaces(tokenizer.Tokenize(word_str))
 			if len(parts) > 1 {
-				l.LWord[strings.ToLower(word_str)] = parts
+				l.addCompoundWord(word_str, parts)
 			}
 		}
 	}
 }
 
-// see if a word is a compound word and add it tot he system for longest word fixing
-func (l *SLexicon) testAndAddCompoundWord(word_str string) {
-	isCompound := false
+// add a compound word to the longest word set
+func (l *SLexicon) addCompoundWord(word_str string, parts []model.Token) {
+	word_lwr := strings.ToLower(word_str)
+	l.removeCompoundWord(word_lwr) // its parts may change
+	l.LWord[word_lwr] = parts
+	l.compoundTrie.add(word_lwr, parts)
+	for _, part := range parts {
+		part_lwr := strings.ToLower(part.Text)
+		if _, ok := l.compoundSet[part_lwr]; !ok {
+			l.compoundSet[part_lwr] = make(map[string]bool, 0)
+		}
+		l.compoundSet[part_lwr][word_lwr] = true
+	}
+}
+
+// remove a compound word from the longest word set
+func (l *SLexicon) removeCompoundWord(word_str string) {
+	word_lwr := strings.ToLower(word_str)
+	for _, part := range l.LWord[word_lwr] {
+		part_lwr := strings.ToLower(part.Text)
+		delete(l.compoundSet[part_lwr], word_lwr)
+		if len(l.compoundSet[part_lwr]) == 0 {
+			delete(l.compoundSet, part_lwr)
+		}
+	}
+	delete(l.LWord, word_lwr)
+	l.compoundTrie.remove(word_lwr)
+}
+
+// does a word have more than one part?
+func isCompound(word_str string) bool {
 	for _, ch := range word_str {
 		if ch == ' ' || ch == '-' {
-			isCompound = true
-			break
+			return len(tokenizer.FilterOutSpaces(tokenizer.Tokenize(word_str))) > 1
 		}
 	}
-	if isCompound {
+	return false
+}
+
+// see if a word is a compound word and add it tot he system for longest word fixing
+func (l *SLexicon) testAndAddCompoundWord(word_str string) {
+	if isCompound(word_str) {
 		parts := tokenizer.FilterOutSpaces(tokenizer.Tokenize(word_str))
 		if len(parts) > 1 {
-			l.LWord[strings.ToLower(word_str)] = parts
+			l.addCompoundWord(word_str, parts)
 		}
 	}
 }
@@ -191,49 +274,73 @@ func (l *SLexicon) setupUndesirables() {
 	}
 }
 
-// setup the lexicon
-func (l *SLexicon) initFromFile() error {
-	if !l.initialised {
-		l.initialised = true
-		dataDir := util.GetDataPath()
-		logger.Log.Info("NLU: loading %s", dataDir)
+// parse the lexicon's text files
+func (l *SLexicon) loadTextFiles(dataDir string) error {
+	l.stemSet = make(map[string]map[string]bool,0) // setup stem word lookup
+	l.LWord = make(map[string][]model.Token,0) // setup longest word
+	l.compoundTrie = newWordTrie()
+	l.compoundSet = make(map[string]map[string]bool, 0)
 
-		l.stemSet = make(map[string]map[string]bool,0) // setup stem word lookup
-		l.LWord = make(map[string][]model.Token,0) // setup longest word
+	l.seen = make(map[string]bool,0) // temp for speeding up loading
+	defer func() { l.seen = nil }() // release map
 
-		l.seen = make(map[string]bool,0) // temp for speeding up loading
+	err := l.loadPlurals(dataDir)
+	if err != nil { return err }
 
-		err := l.loadPlurals(dataDir)
-		if err != nil { return err }
+	err = l.loadVerbs(dataDir)
+	if err != nil { return err }
 
-		err = l.loadVerbs(dataDir)
-		if err != nil { return err }
+	err = l.loadSemantics(dataDir)
+	if err != nil { return err }
 
-		err = l.loadSemantics(dataDir)
-		if err != nil { return err }
+	err = l.loadSemanticHierarchy(dataDir)
+	if err != nil { return err }
 
-		err = l.loadLongestWords(dataDir)
-		if err != nil { return err }
+	err = l.loadLongestWords(dataDir)
+	if err != nil { return err }
 
-		l.setupUndesirables()
-		err = l.loadSynonyms(dataDir)
-		if err != nil { return err }
+	return l.loadSynonyms(dataDir)
+}
+
+// setup the lexicon, from its snapshot if it is up to date (see snapshot.go)
+func (l *SLexicon) initFromFile() error {
+	if !l.initialised {
+		l.initialised = true
+		dataDir := util.GetDataPath()
+		logger.Log.Info("NLU: loading %s", dataDir)
 
-		l.seen = nil // release map
+		err := l.loadSnapshot(dataDir)
+		if err != nil {
+			logger.Log.Info("NLU: compiling the lexicon, not using its snapshot: %s", err.Error())
+			fingerprint, err := lexiconFingerprint(dataDir)
+			if err != nil { return err }
+			err = l.loadTextFiles(dataDir)
+			if err != nil { return err }
+			err = l.saveSnapshot(dataDir, fingerprint)
+			if err != nil { // not fatal, we'll just compile again next time
+				logger.Log.Warning("NLU: could not save the lexicon snapshot: %s", err.Error())
+			}
+		}
+		l.setupUndesirables()
 
 		logger.Log.Info("NLU: lexicon loaded %d stem items, %d compound words, %d semantics, %d undesirables, and %d synonyms", len(l.plural)+len(l.verb),
 			len(l.LWord), len(l.Semantic), len(l.Undesirables), len(l.synonymSet))
 
 		// apply any updates from the UI to the semantics system
 		l.applySemanticUpdates()
-
-		return err
 	}
 	return nil
 }
 
 // return the stem of a word if it exists, otherwise the word to lower case is returned
 func (l *SLexicon) GetStem(word string) string {
+	l.RLock()
+	defer l.RUnlock()
+	return l.getStem(word)
+}
+
+// GetStem() for callers holding the lock
+func (l *SLexicon) getStem(word string) string {
 	lwrStr := strings.ToLower(word)
 	if l.initialised {
 		if val, ok := l.plural[lwrStr]; ok {
@@ -246,14 +353,31 @@ func (l *SLexicon) GetStem(word string) string {
 	return lwrStr
 }
 
+// return the stem of a word using its Penn tag to pick between verb and noun forms
+// e.g. "lives" as a VBZ is "live", and as an NNS is "life"
+func (l *SLexicon) GetStemForTag(word string, tag string) string {
+	l.RLock()
+	defer l.RUnlock()
+	if l.initialised && strings.HasPrefix(tag, "VB") {
+		if val, ok := l.verb[strings.ToLower(word)]; ok {
+			return val
+		}
+	}
+	return l.getStem(word)
+}
+
 // return true if this word is in the undesirables list
 func (l *SLexicon) IsUndesirable(word string) bool {
+	l.RLock()
+	defer l.RUnlock()
 	_, ok := l.Undesirables[strings.ToLower(word)]
 	return ok
 }
 
 // get a list of related words for a base (stemmed) word if it exists
 func (l *SLexicon) GetStemList(stemmed_word string) []string {
+	l.RLock()
+	defer l.RUnlock()
 	word_list := make([]string,0)
 	if map1, ok := l.stemSet[stemmed_word]; ok {
 		for key, _ := range map1 {
@@ -264,32 +388,34 @@ func (l *SLexicon) GetStemList(stemmed_word string) []string {
 }
 
 // is the tag a noun tag?
-func (l SLexicon)IsNoun(tag string) bool {
+func (l *SLexicon)IsNoun(tag string) bool {
 	return tag == "NN" || tag == "NNS" || tag == "NNP" || tag == "NNPS"
 }
 
 // is the tag a verb tag?
-func (l SLexicon)IsVerb(tag string) bool {
+func (l *SLexicon)IsVerb(tag string) bool {
 	return strings.Contains(tag, "VB")
 }
 
 // is the tag an adjective
-func (l SLexicon)IsAdj(tag string) bool {
+func (l *SLexicon)IsAdj(tag string) bool {
 	return tag == "JJ" || tag == "JJR" || tag == "JJS"
 }
 
 // is the tag an adverb
-func (l SLexicon)IsAdv(tag string) bool {
+func (l *SLexicon)IsAdv(tag string) bool {
 	return tag == "RB" || tag == "RBR" || tag == "RBS"
 }
 
 // is the tag a number
-func (l SLexicon)IsNumber(tag string) bool {
+func (l *SLexicon)IsNumber(tag string) bool {
 	return tag == "CD"
 }
 
 // get a list of synonyms
 func (l *SLexicon) GetSynonymList(stemmed_word string) []string {
+	l.RLock()
+	defer l.RUnlock()
 	word_list := make([]string,0)
 	if map1, ok := l.synonymSet[stemmed_word]; ok {
 		for key, _ := range map1 {
@@ -299,11 +425,9 @@ func (l *SLexicon) GetSynonymList(stemmed_word string) []string {
 	return word_list
 }
 
-// init the lexicon from file
+// the lexicon itself is loaded on first use (see load)
 func init() {
-	err := Lexi.initFromFile()
-	if err != nil {
-		panic(err)
-	}
+	// answer expectations use the semantic hierarchy
+	model.IsSemanticA = Lexi.IsA
 }
 
@@ -15,6 +15,7 @@ import (
 	"testing"
 	"fmt"
 	"k-ai/util_ut"
+	"k-ai/nlu/model"
 	"runtime/debug"
 )
 
@@ -88,3 +89,171 @@ func TestSemantics(t *testing.T) {
 	util_ut.IsTrue(t, Lexi.GetSemantic("john") == "location")
 }
 
+
+// test stemming with a tag picks the right form
+func TestStemForTag1(t *testing.T) {
+	util_ut.IsTrue(t, Lexi.GetStemForTag("lives", "VBZ") == "live")
+	util_ut.IsTrue(t, Lexi.GetStemForTag("lives", "NNS") == "life")
+	util_ut.IsTrue(t, Lexi.GetStemForTag("boats", "NNS") == "boat")
+}
+
+// test applying lexicon updates
+func TestLexiconUpdates1(t *testing.T) {
+	util_ut.IsTrue(t, !Lexi.HasSemantic("Zorblax"))
+	err := Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Zorblax", Operation: OpSave, Value: "Animal"})
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, Lexi.GetSemantic("Zorblax") == "animal")
+	found := Lexi.FindSemantics("zorbl")
+	util_ut.IsTrue(t, len(found) == 1 && found["Zorblax"] == "animal")
+
+	err = Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Zorblax", Operation: OpDelete})
+	util_ut.Check(t, err)
+	util_ut.IsTrue(t, !Lexi.HasSemantic("Zorblax"))
+
+	// unknown updates are refused
+	util_ut.IsTrue(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: "colour", Word: "Zorblax", Operation: OpSave}) != nil)
+	util_ut.IsTrue(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Zorblax", Operation: "add"}) != nil)
+
+	// legacy updates are numbered in order
+	update_list, err := ReadLegacyUpdates()
+	util_ut.Check(t, err)
+	for i, update := range update_list {
+		util_ut.IsTrue(t, update.When == int64(i + 1) && update.Kind == UpdateSemantic)
+	}
+}
+
+// test stem, synonym, compound and undesirable updates
+func TestLexiconUpdates2(t *testing.T) {
+	util_ut.IsTrue(t, Lexi.GetStem("zorblaxes") == "zorblaxes")
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdatePlural, Word: "zorblaxes", Operation: OpSave, Value: "zorblax"}))
+	util_ut.IsTrue(t, Lexi.GetStem("Zorblaxes") == "zorblax")
+	util_ut.IsTrue(t, len(Lexi.GetStemList("zorblax")) == 1)
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdatePlural, Word: "zorblaxes", Operation: OpDelete}))
+	util_ut.IsTrue(t, Lexi.GetStem("zorblaxes") == "zorblaxes")
+	util_ut.IsTrue(t, len(Lexi.GetStemList("zorblax")) == 0)
+
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSynonym, Word: "zorblax", Operation: OpSave, Value: "blorg"}))
+	util_ut.IsTrue(t, len(Lexi.GetSynonymList("blorg")) == 1 && Lexi.GetSynonymList("blorg")[0] == "zorblax")
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSynonym, Word: "zorblax", Operation: OpDelete, Value: "blorg"}))
+	util_ut.IsTrue(t, len(Lexi.GetSynonymList("blorg")) == 0 && len(Lexi.GetSynonymList("zorblax")) == 0)
+
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateCompound, Word: "zorblax wharf", Operation: OpSave}))
+	info := Lexi.LookupWord("Zorblax")
+	util_ut.IsTrue(t, len(info.CompoundList) == 1 && info.CompoundList[0] == "zorblax wharf" && !info.IsCompound)
+	util_ut.IsTrue(t, Lexi.LookupWord("zorblax wharf").IsCompound)
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateCompound, Word: "zorblax wharf", Operation: OpDelete}))
+	util_ut.IsTrue(t, len(Lexi.LookupWord("zorblax").CompoundList) == 0)
+
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateUndesirable, Word: "Zorblax", Operation: OpSave}))
+	util_ut.IsTrue(t, Lexi.IsUndesirable("zorblax") && Lexi.LookupWord("zorblax").Undesirable)
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateUndesirable, Word: "Zorblax", Operation: OpDelete}))
+	util_ut.IsTrue(t, !Lexi.IsUndesirable("zorblax"))
+}
+
+// test lexicon update validation
+func TestLexiconUpdateValidate1(t *testing.T) {
+	util_ut.Check(t, LexiconUpdate{Kind: UpdateSynonym, Word: "car", Operation: OpSave, Value: "automobile"}.Validate())
+	util_ut.Check(t, LexiconUpdate{Kind: UpdateUndesirable, Word: "um", Operation: OpDelete}.Validate())
+	util_ut.Check(t, LexiconUpdate{Kind: UpdateSemantic, Word: "Paris", Operation: OpDelete}.Validate())
+	util_ut.IsTrue(t, LexiconUpdate{Kind: "colour", Word: "car", Operation: OpSave}.Validate() != nil)
+	util_ut.IsTrue(t, LexiconUpdate{Kind: UpdatePlural, Word: "cars", Operation: "add", Value: "car"}.Validate() != nil)
+	util_ut.IsTrue(t, LexiconUpdate{Kind: UpdatePlural, Word: "cars", Operation: OpSave}.Validate() != nil)
+	util_ut.IsTrue(t, LexiconUpdate{Kind: UpdateSynonym, Word: "car", Operation: OpSave, Value: "Car"}.Validate() != nil)
+	util_ut.IsTrue(t, LexiconUpdate{Kind: UpdateVerb, Word: "ran;", Operation: OpSave, Value: "run"}.Validate() != nil)
+	util_ut.IsTrue(t, LexiconUpdate{Kind: UpdateCompound, Word: "york", Operation: OpSave}.Validate() != nil)
+	util_ut.Check(t, LexiconUpdate{Kind: UpdateCompound, Word: "New York", Operation: OpSave}.Validate())
+}
+
+// test looking up a word
+func TestLookupWord1(t *testing.T) {
+	info := Lexi.LookupWord("Boats")
+	util_ut.IsTrue(t, info.Word == "boats" && info.Stem == "boat")
+	found := false
+	for _, word := range info.StemList {
+		found = found || word == "boats"
+	}
+	util_ut.IsTrue(t, found)
+	util_ut.IsTrue(t, Lexi.LookupWord("the").Undesirable)
+
+	// the compound words a word is part of
+	found = false
+	for _, compound := range Lexi.LookupWord("York").CompoundList {
+		found = found || compound == "new york city"
+	}
+	util_ut.IsTrue(t, found)
+}
+
+// test the semantic hierarchy
+func TestSemanticHierarchy1(t *testing.T) {
+	util_ut.IsTrue(t, Lexi.IsA("city", "location") && Lexi.IsA("City", "location"))
+	util_ut.IsTrue(t, Lexi.IsA("man", "person") && Lexi.IsA("man", "male"))
+	util_ut.IsTrue(t, Lexi.IsA("aircraft", "vehicle") && Lexi.IsA("vehicle", "vehicle"))
+	util_ut.IsTrue(t, !Lexi.IsA("location", "city") && !Lexi.IsA("male", "female") && !Lexi.IsA("", ""))
+
+	ancestor_list := Lexi.GetSemanticAncestors("woman")
+	util_ut.IsTrue(t, len(ancestor_list) == 2 && ancestor_list[0] == "female" && ancestor_list[1] == "person")
+
+	sub_list := Lexi.GetSubSemantics("location")
+	util_ut.IsTrue(t, len(sub_list) == 3 && sub_list[0] == "city" && sub_list[1] == "country" && sub_list[2] == "state")
+	util_ut.IsTrue(t, len(Lexi.GetSubSemantics("city")) == 0)
+
+	// answers to location questions include cities
+	util_ut.IsTrue(t, model.IsSemanticA("city", "location"))
+}
+
+// test lexicon overlays keep the semantics of users apart
+func TestLexiconOverlays1(t *testing.T) {
+	peter := UserScope("Peter@peter.co.nz")
+	util_ut.IsTrue(t, peter == "user:peter@peter.co.nz" && IsScope(peter) && IsScope(SchemaScope("bank")))
+	util_ut.IsTrue(t, !IsScope("user:") && !IsScope("peter"))
+	util_ut.IsTrue(t, IsUserScope(peter) && !IsUserScope(SchemaScope("bank")) && !IsUserScope("user:") && !IsUserScope(""))
+
+	base := Lexi.GetSemantic("Zorblax")
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Zorblax", Operation: OpSave, Value: "Company", Scope: peter}))
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Zorblax", Operation: OpSave, Value: "bank", Scope: SchemaScope("bank")}))
+
+	// peter's own semantic first, then the knowledge-base's, the lexicon itself unchanged
+	util_ut.IsTrue(t, Lexi.ViewForUser("peter@peter.co.nz", "bank").GetSemantic("Zorblax") == "company")
+	util_ut.IsTrue(t, Lexi.ViewForUser("mark@peter.co.nz", "bank").GetSemantic("Zorblax") == "bank")
+	util_ut.IsTrue(t, Lexi.View().GetSemantic("Zorblax") == base && Lexi.GetSemantic("Zorblax") == base)
+	util_ut.IsTrue(t, Lexi.ViewForUser("peter@peter.co.nz").FindSemantics("zorbl")["Zorblax"] == "company")
+	util_ut.IsTrue(t, len(Lexi.FindSemantics("zorbl")) == 0)
+
+	// overlays fall back on the lexicon for other words
+	util_ut.IsTrue(t, Lexi.ViewForUser("peter@peter.co.nz").GetSemantic("Tokyo") == Lexi.GetSemantic("Tokyo"))
+
+	util_ut.IsTrue(t, Lexi.HasOverlaySemantic(peter, "Zorblax"))
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Zorblax", Operation: OpDelete, Scope: peter}))
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Zorblax", Operation: OpDelete, Scope: SchemaScope("bank")}))
+	util_ut.IsTrue(t, !Lexi.HasOverlaySemantic(peter, "Zorblax"))
+	util_ut.IsTrue(t, Lexi.ViewForUser("peter@peter.co.nz").GetSemantic("Zorblax") == base)
+
+	// overlays only hold semantics and rejected guesses, rejected guesses only overlays
+	util_ut.IsTrue(t, LexiconUpdate{Kind: UpdateSynonym, Word: "car", Operation: OpSave, Value: "auto", Scope: peter}.Validate() != nil)
+	util_ut.IsTrue(t, LexiconUpdate{Kind: UpdateSemantic, Word: "car", Operation: OpSave, Value: "vehicle", Scope: "peter"}.Validate() != nil)
+	util_ut.Check(t, LexiconUpdate{Kind: UpdateSemantic, Word: "car", Operation: OpSave, Value: "vehicle", Scope: peter}.Validate())
+	util_ut.Check(t, LexiconUpdate{Kind: UpdateRejected, Word: "car", Operation: OpSave, Scope: peter}.Validate())
+	util_ut.IsTrue(t, LexiconUpdate{Kind: UpdateRejected, Word: "car", Operation: OpSave}.Validate() != nil)
+
+	// a rejected guess is only rejected for its own scope
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateRejected, Word: "Zorblax", Operation: OpSave, Scope: peter}))
+	util_ut.IsTrue(t, Lexi.ViewForUser("peter@peter.co.nz").IsRejected("Zorblax") && !Lexi.ViewForUser("mark@peter.co.nz").IsRejected("Zorblax"))
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateRejected, Word: "Zorblax", Operation: OpDelete, Scope: peter}))
+	util_ut.IsTrue(t, !Lexi.ViewForUser("peter@peter.co.nz").IsRejected("Zorblax"))
+}
+
+// test two knowledge-bases giving a word different semantics only change it for their own users
+func TestLexiconOverlays2(t *testing.T) {
+	base := Lexi.GetSemantic("Quorvex")
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Quorvex", Operation: OpSave, Value: "bank", Scope: SchemaScope("banks")}))
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Quorvex", Operation: OpSave, Value: "fruit", Scope: SchemaScope("fruits")}))
+
+	util_ut.IsTrue(t, Lexi.ViewForUser("peter@peter.co.nz", "banks").GetSemantic("Quorvex") == "bank")
+	util_ut.IsTrue(t, Lexi.ViewForUser("mark@peter.co.nz", "fruits").GetSemantic("Quorvex") == "fruit")
+	util_ut.IsTrue(t, Lexi.ViewForUser("mark@peter.co.nz", "fruits", "banks").GetSemantic("Quorvex") == "fruit")
+	util_ut.IsTrue(t, Lexi.ViewForUser("john@peter.co.nz").GetSemantic("Quorvex") == base)
+	util_ut.IsTrue(t, Lexi.ViewForUser("john@peter.co.nz").FindSemantics("quorv")["Quorvex"] == "")
+
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Quorvex", Operation: OpDelete, Scope: SchemaScope("banks")}))
+	util_ut.Check(t, Lexi.ApplyUpdate(LexiconUpdate{Kind: UpdateSemantic, Word: "Quorvex", Operation: OpDelete, Scope: SchemaScope("fruits")}))
+}
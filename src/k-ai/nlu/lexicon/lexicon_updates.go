@@ -12,32 +12,242 @@
 package lexicon
 
 import (
+	"errors"
+	"regexp"
 	"strings"
 	"k-ai/util"
 )
 
-// apply all updates from the lexicon update file to the semantics of the lexicon system
-func (l *SLexicon) applySemanticUpdates() error {
+//
+// Lexicon updates
+//
+// Changes made to the lexicon while the system is running (e.g. by the semantic entity editor)
+// are stored in the database (see db_model.SaveLexiconUpdate) and applied to the lexicon of
+// every running instance.  lexicon_updates.txt is the old, file based, store of these updates;
+// it is still applied at startup and its contents are copied to the database the first time one is connected.
+//
 
-	file_contents, err := util.LoadTextFile(util.GetDataPath() + "/lexicon/lexicon_updates.txt")
-	if err != nil { return err }
+// the kinds of lexicon updates
+const (
+	UpdateSemantic    = "semantic"    // word -> semantic
+	UpdatePlural      = "plural"      // plural -> singular (its stem)
+	UpdateVerb        = "verb"        // verb form -> base verb (its stem)
+	UpdateSynonym     = "synonym"     // word <-> synonym
+	UpdateCompound    = "compound"    // a compound word, e.g. "New York"
+	UpdateUndesirable = "undesirable" // a stop-word, never indexed
+	UpdateRejected    = "rejected"    // a word whose guessed semantic was rejected, overlays only
+)
+
+// all kinds of lexicon updates
+var UpdateKinds = []string{UpdateSemantic, UpdatePlural, UpdateVerb, UpdateSynonym, UpdateCompound, UpdateUndesirable,
+	UpdateRejected}
+
+// words and values of updates
+var validUpdateWord = regexp.MustCompile(`^([a-z]|[A-Z]|[0-9]| |-|')+$`)
+
+// the lexicon update operations
+const (
+	OpSave   = "save"
+	OpDelete = "del"
+)
 
+// a single change to the lexicon
+type LexiconUpdate struct {
+	Kind      string `json:"kind"`      // one of the Update constants
+	When      int64  `json:"when"`      // unix time in nanoseconds
+	Word      string `json:"word"`
+	Operation string `json:"operation"` // OpSave or OpDelete
+	Value     string `json:"value"`     // e.g. the semantic for a save
+	Origin    string `json:"origin"`    // who made the change
+	Instance  string `json:"instance"`  // the server instance that made the change
+	Scope     string `json:"scope"`     // the overlay changed (see overlay.go), empty for the lexicon itself
+}
+
+// the legacy update file
+func legacyUpdatesFilename() string {
+	return util.GetDataPath() + "/lexicon/lexicon_updates.txt"
+}
+
+// read the updates from the legacy update file, in order, numbering them 1, 2, ... as their time
+func ReadLegacyUpdates() ([]LexiconUpdate, error) {
+	file_contents, err := util.LoadTextFile(legacyUpdatesFilename())
+	if err != nil { return nil, err }
+
+	update_list := make([]LexiconUpdate, 0)
 	for _, line := range strings.Split(file_contents, "\n") {
 		parts := strings.Split(line, "|")
 		if len(parts) == 3 {
 			word_sem := strings.Split(parts[2], ":")
 			if len(word_sem) == 2 {
-				switch (parts[0]) {
-				case "del":
-					delete(l.Semantic, word_sem[0])
-				case "save":
-					l.Semantic[word_sem[0]] = word_sem[1]
-				default:
-					panic("unknown instruction in line " + line)
+				if parts[0] != OpSave && parts[0] != OpDelete {
+					return nil, errors.New("unknown instruction in line " + line)
 				}
+				update_list = append(update_list, LexiconUpdate{Kind: UpdateSemantic, When: int64(len(update_list) + 1),
+					Word: word_sem[0], Operation: parts[0], Value: word_sem[1], Origin: parts[1]})
 			}
 		}
 	}
+	return update_list, nil
+}
+
+// apply all updates from the lexicon update file to the semantics of the lexicon system
+func (l *SLexicon) applySemanticUpdates() error {
+	update_list, err := ReadLegacyUpdates()
+	if err != nil { return err }
+	for _, update := range update_list {
+		err = l.ApplyUpdate(update)
+		if err != nil { return err }
+	}
+	return nil
+}
+
+// check an update is sensible before it is stored
+func (u LexiconUpdate) Validate() error {
+	known_kind := false
+	for _, kind := range UpdateKinds {
+		known_kind = known_kind || kind == u.Kind
+	}
+	if !known_kind {
+		return errors.New("unknown lexicon update kind \"" + u.Kind + "\"")
+	}
+	if u.Operation != OpSave && u.Operation != OpDelete {
+		return errors.New("unknown lexicon update operation \"" + u.Operation + "\"")
+	}
+	if len(u.Word) == 0 || len(u.Word) > 255 || !validUpdateWord.MatchString(u.Word) {
+		return errors.New("invalid word, letters, digits, spaces, - and ' only")
+	}
+	// kinds that relate a word to another word
+	if u.Kind == UpdateSemantic || u.Kind == UpdatePlural || u.Kind == UpdateVerb || u.Kind == UpdateSynonym {
+		if u.Operation == OpSave || u.Kind == UpdateSynonym {
+			if len(u.Value) == 0 || len(u.Value) > 255 || !validUpdateWord.MatchString(u.Value) {
+				return errors.New("invalid value, letters, digits, spaces, - and ' only")
+			}
+			if u.Kind != UpdateSemantic && strings.ToLower(u.Value) == strings.ToLower(u.Word) {
+				return errors.New("a word can't be related to itself")
+			}
+		}
+	}
+	if len(u.Scope) > 0 && (!IsScope(u.Scope) || (u.Kind != UpdateSemantic && u.Kind != UpdateRejected)) {
+		return errors.New("invalid scope \"" + u.Scope + "\", overlays only hold semantics and rejected guesses")
+	}
+	if u.Kind == UpdateRejected && len(u.Scope) == 0 {
+		return errors.New("a rejected guess needs a scope")
+	}
+	if u.Kind == UpdateCompound && !isCompound(u.Word) {
+		return errors.New("a compound word needs more than one part, e.g. \"New York\"")
+	}
+	return nil
+}
+
+// the update that replaces this one: the same kind for the same word (and synonym) in the same scope
+func (u LexiconUpdate) Key() string {
+	if u.Kind == UpdateSynonym {
+		return u.Scope + "|" + strings.ToLower(u.Word) + "|" + strings.ToLower(u.Value)
+	}
+	return u.Scope + "|" + u.Word
+}
+
+// apply a single update to the lexicon
+func (l *SLexicon) ApplyUpdate(update LexiconUpdate) error {
+	if update.Operation != OpSave && update.Operation != OpDelete {
+		return errors.New("unknown lexicon update operation " + update.Operation)
+	}
+	save := update.Operation == OpSave
+	if len(update.Scope) > 0 { // an overlay
+		if update.Kind == UpdateRejected {
+			l.setRejected(update.Scope, update.Word, save)
+			return nil
+		}
+		if update.Kind != UpdateSemantic {
+			return errors.New("lexicon overlays only hold semantics and rejected guesses, not " + update.Kind)
+		}
+		if save {
+			l.AddOverlaySemantic(update.Scope, update.Word, update.Value)
+		} else {
+			l.RemoveOverlaySemantic(update.Scope, update.Word)
+		}
+		return nil
+	}
+	switch update.Kind {
+	case UpdateSemantic:
+		if save {
+			l.AddSemantic(update.Word, update.Value)
+		} else {
+			l.RemoveSemantic(update.Word)
+		}
+	case UpdatePlural:
+		l.setStem(l.plural, update.Word, update.Value, save)
+	case UpdateVerb:
+		l.setStem(l.verb, update.Word, update.Value, save)
+	case UpdateSynonym:
+		l.setSynonym(update.Word, update.Value, save)
+	case UpdateCompound:
+		l.setCompound(update.Word, save)
+	case UpdateUndesirable:
+		l.setUndesirable(update.Word, save)
+	default:
+		return errors.New("unknown lexicon update kind " + update.Kind)
+	}
 	return nil
 }
 
+// add or remove a word -> stem relationship to a stem map (plural or verb)
+func (l *SLexicon) setStem(stem_map map[string]string, word string, stem string, save bool) {
+	l.Lock()            // one at a time
+	defer l.Unlock()
+
+	word_lwr := strings.ToLower(word)
+	if old_stem, ok := stem_map[word_lwr]; ok {
+		delete(l.stemSet[old_stem], word_lwr)
+		delete(stem_map, word_lwr)
+	}
+	if save {
+		stem_lwr := strings.ToLower(stem)
+		stem_map[word_lwr] = stem_lwr
+		l.add_stem_word(stem_lwr, word_lwr)
+		l.testAndAddCompoundWord(word_lwr)
+		l.testAndAddCompoundWord(stem_lwr)
+	}
+}
+
+// add or remove a synonym (both ways)
+func (l *SLexicon) setSynonym(word1 string, word2 string, save bool) {
+	l.Lock()            // one at a time
+	defer l.Unlock()
+
+	word1 = strings.ToLower(word1)
+	word2 = strings.ToLower(word2)
+	if save {
+		l.add_synonym(word1, word2)
+		l.add_synonym(word2, word1)
+		l.testAndAddCompoundWord(word1)
+		l.testAndAddCompoundWord(word2)
+	} else {
+		delete(l.synonymSet[word1], word2)
+		delete(l.synonymSet[word2], word1)
+	}
+}
+
+// add or remove a compound word
+func (l *SLexicon) setCompound(word string, save bool) {
+	l.Lock()            // one at a time
+	defer l.Unlock()
+
+	if save {
+		l.testAndAddCompoundWord(word)
+	} else {
+		l.removeCompoundWord(word)
+	}
+}
+
+// add or remove an undesirable
+func (l *SLexicon) setUndesirable(word string, save bool) {
+	l.Lock()            // one at a time
+	defer l.Unlock()
+
+	if save {
+		l.Undesirables[strings.ToLower(word)] = true
+	} else {
+		delete(l.Undesirables, strings.ToLower(word))
+	}
+}
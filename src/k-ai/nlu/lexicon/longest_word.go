@@ -15,7 +15,6 @@ import (
 	"k-ai/nlu/model"
 	"math"
 	"strings"
-	"bytes"
 )
 
 // hold return values of the getLargestMatching system
@@ -86,28 +85,10 @@ func filterByCase(list []model.Token, word string, isStartOfSentence bool) []mod
 // get the largest matching item from the lexicon
 // remap: for remapping ancestors id_that_no_longer_exists -> correct_id
 func (l *SLexicon) getLargestMatching(tokenList []model.Token, index int, remap map[int]int ) *matchingResult {
-	size := maxWordConstituentLength;
-	if index + size > len(tokenList) {
-		size = len(tokenList) - index
-	}
-	resultList := make([]model.Token,0)
-	resultListString := ""
-	resultSize := 0
+	l.RLock()
+	resultSize, resultListString, resultList := l.compoundTrie.longestMatch(tokenList, index, maxWordConstituentLength)
+	l.RUnlock()
 
-	sb := bytes.Buffer{}
-	for i := 0; i < size; i++ {
-		t_token := tokenList[index + i]
-		wordStr := t_token.Text
-		if len(wordStr) > 0 {
-			sb.WriteString(wordStr)
-			if tempList, ok := l.LWord[strings.ToLower(sb.String())]; ok {
-				resultListString = sb.String()
-				resultList = tempList
-				resultSize = i + 1
-			}
-			sb.WriteString(" ")
-		}
-	}
 	// return if we have a matching item
 	if resultSize > 1 && len(resultList) > 0 {
 		resultList = filterByCase(resultList, resultListString, index == 0);
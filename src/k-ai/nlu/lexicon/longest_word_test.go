@@ -12,6 +12,8 @@
 package lexicon
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"k-ai/util_ut"
 	"encoding/json"
@@ -46,3 +48,126 @@ func TestLongestWord_1(t *testing.T) {
 	util_ut.IsTrue(t, len(old_lady.AncestorList) == 1 && old_lady.AncestorList[0] == 1)
 }
 
+
+// the previous longest word match: try every word sequence against the compound word map
+func mapLongestMatch(lword map[string][]model.Token, token_list []model.Token, index int) (int, string) {
+	size := maxWordConstituentLength
+	if index + size > len(token_list) {
+		size = len(token_list) - index
+	}
+	result_size := 0
+	result_text := ""
+	text := ""
+	for i := 0; i < size; i++ {
+		if len(token_list[index + i].Text) > 0 {
+			if len(text) > 0 {
+				text += " "
+			}
+			text += token_list[index + i].Text
+			if _, ok := lword[strings.ToLower(text)]; ok {
+				result_size = i + 1
+				result_text = text
+			}
+		}
+	}
+	return result_size, result_text
+}
+
+// turn text into tokens (no parser, good enough for longest word matching)
+func textToTokenList(text string) []model.Token {
+	token_list := make([]model.Token, 0)
+	for i, word := range strings.Split(text, " ") {
+		token_list = append(token_list, model.Token{Text: word, Tag: "NN", Index: i})
+	}
+	return token_list
+}
+
+// test the trie finds exactly what the compound word map finds, for sentences made of compound words
+func TestLongestWordTrie1(t *testing.T) {
+	text := ""
+	count := 0
+	for compound := range Lexi.LWord {
+		if count == 2000 {
+			break
+		}
+		text += strings.ToUpper(compound[:1]) + compound[1:] + " and the "
+		count += 1
+	}
+	token_list := textToTokenList(text + "New York City . new york")
+	token_list = append(token_list, model.Token{Text: ""}, model.Token{Text: "city"})
+	for i := range token_list {
+		map_size, map_text := mapLongestMatch(Lexi.LWord, token_list, i)
+		trie_size, trie_text, _ := Lexi.compoundTrie.longestMatch(token_list, i, maxWordConstituentLength)
+		if map_size != trie_size || map_text != trie_text {
+			t.Errorf("@ %d: map %d \"%s\", trie %d \"%s\"", i, map_size, map_text, trie_size, trie_text)
+		}
+	}
+}
+
+// test adding and removing compound words keeps the trie in step
+func TestLongestWordTrie2(t *testing.T) {
+	trie := newWordTrie()
+	trie.add("new york", []model.Token{{Text: "New"}, {Text: "York"}})
+	trie.add("new york city", []model.Token{{Text: "New"}, {Text: "York"}, {Text: "City"}})
+	token_list := textToTokenList("in New York City today")
+
+	size, text, parts := trie.longestMatch(token_list, 1, maxWordConstituentLength)
+	util_ut.IsTrue(t, size == 3 && text == "New York City" && len(parts) == 3)
+
+	trie.remove("new york city")
+	size, text, _ = trie.longestMatch(token_list, 1, maxWordConstituentLength)
+	util_ut.IsTrue(t, size == 2 && text == "New York")
+	util_ut.IsTrue(t, len(trie.children["new"].children["york"].children) == 0)
+
+	trie.remove("new york")
+	size, _, _ = trie.longestMatch(token_list, 1, maxWordConstituentLength)
+	util_ut.IsTrue(t, size == 0 && len(trie.children) == 0)
+}
+
+// a lexicon with a large gazetteer of made up compound words, for benchmarking
+func largeGazetteer(size int) (*wordTrie, map[string][]model.Token, []model.Token) {
+	trie := newWordTrie()
+	lword := make(map[string][]model.Token, 0)
+	text := ""
+	for i := 0; i < size; i++ {
+		compound := fmt.Sprintf("place%d north side", i)
+		parts := textToTokenList(compound)
+		trie.add(compound, parts)
+		lword[compound] = parts
+		if i % 1000 == 0 {
+			text += fmt.Sprintf("we went to Place%d North Side and place%d after that . ", i, i + 1)
+		}
+	}
+	return trie, lword, textToTokenList(text)
+}
+
+// benchmark matching against 250,000 compound words with the trie
+func BenchmarkLongestWordTrie(b *testing.B) {
+	trie, _, token_list := largeGazetteer(250000)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range token_list {
+			trie.longestMatch(token_list, i, maxWordConstituentLength)
+		}
+	}
+}
+
+// benchmark matching against 250,000 compound words with the previous map lookups
+func BenchmarkLongestWordMap(b *testing.B) {
+	_, lword, token_list := largeGazetteer(250000)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range token_list {
+			mapLongestMatch(lword, token_list, i)
+		}
+	}
+}
+
+// benchmark the whole longest word sequence with the real lexicon
+func BenchmarkGetLongestWordSequence(b *testing.B) {
+	token_list := textToTokenList("The old lady flew from New York City to the Gulf of Mexico with the Prime Minister of New Zealand")
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		Lexi.GetLongestWordSequence(token_list)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package lexicon
+
+import (
+	"sort"
+	"strings"
+)
+
+// everything the lexicon knows about a word
+type WordInfo struct {
+	Word         string   `json:"word"`
+	Stem         string   `json:"stem"`
+	StemList     []string `json:"stem_list"`     // words with the same stem
+	SynonymList  []string `json:"synonym_list"`
+	Semantic     string   `json:"semantic"`
+	IsCompound   bool     `json:"is_compound"`   // the word itself is a compound word
+	CompoundList []string `json:"compound_list"` // compound words the word is part of
+	Undesirable  bool     `json:"undesirable"`
+}
+
+// look up a word in the lexicon
+func (l *SLexicon) LookupWord(word string) WordInfo {
+	l.RLock()
+	defer l.RUnlock()
+
+	word_lwr := strings.ToLower(strings.TrimSpace(word))
+	info := WordInfo{Word: word_lwr, Stem: l.getStem(word_lwr), StemList: make([]string, 0),
+		SynonymList: make([]string, 0), CompoundList: make([]string, 0)}
+
+	for related := range l.stemSet[info.Stem] {
+		info.StemList = append(info.StemList, related)
+	}
+	for synonym := range l.synonymSet[info.Stem] {
+		info.SynonymList = append(info.SynonymList, synonym)
+	}
+	if info.Stem != word_lwr {
+		for synonym := range l.synonymSet[word_lwr] {
+			info.SynonymList = append(info.SynonymList, synonym)
+		}
+	}
+	if semantic, ok := l.Semantic[strings.TrimSpace(word)]; ok { // case sensitive first, like GetSemantic()
+		info.Semantic = semantic
+	} else {
+		info.Semantic = l.Semantic[info.Stem]
+	}
+	_, info.IsCompound = l.LWord[word_lwr]
+	for compound := range l.compoundSet[word_lwr] {
+		info.CompoundList = append(info.CompoundList, compound)
+	}
+	_, info.Undesirable = l.Undesirables[word_lwr]
+
+	sort.Strings(info.StemList)
+	sort.Strings(info.SynonymList)
+	sort.Strings(info.CompoundList)
+	return info
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package lexicon
+
+import (
+	"strings"
+)
+
+//
+// Lexicon overlays
+//
+// The semantics of the lexicon files are shared by everyone.  Semantics added by a user (the semantic
+// entity editor) or by uploading the instances of a knowledge-base schema go into an overlay of their
+// own, named by its scope (see UserScope and SchemaScope), so one user's "Apple: company" doesn't
+// change what "Apple" means to anyone else.
+//
+// A LexiconView layers overlays over the lexicon: a word's semantic comes from the first overlay that
+// has it, or from the lexicon itself.  A user's view is their own overlay, then the overlays of the
+// knowledge-bases the caller says are theirs, then the lexicon.
+//
+// An overlay also holds the words whose guessed semantic (see parser.Suggestions) was rejected, so
+// they aren't guessed again for its scope.
+//
+
+// the overlay scope prefixes
+const (
+	userScopePrefix   = "user:"
+	schemaScopePrefix = "kb:"
+)
+
+// the scope of a user's overlay
+func UserScope(username string) string {
+	return userScopePrefix + strings.ToLower(strings.TrimSpace(username))
+}
+
+// the scope of a knowledge-base schema's overlay
+func SchemaScope(schema_name string) string {
+	return schemaScopePrefix + strings.TrimSpace(schema_name)
+}
+
+// is this the scope of a user's overlay?
+func IsUserScope(scope string) bool {
+	return strings.HasPrefix(scope, userScopePrefix) && len(scope) > len(userScopePrefix)
+}
+
+// is this the name of an overlay scope?
+func IsScope(scope string) bool {
+	return (strings.HasPrefix(scope, userScopePrefix) && len(scope) > len(userScopePrefix)) ||
+		(strings.HasPrefix(scope, schemaScopePrefix) && len(scope) > len(schemaScopePrefix))
+}
+
+// a lexicon seen through a list of overlays
+type LexiconView struct {
+	lexicon    *SLexicon
+	scope_list []string // most important first
+}
+
+// the lexicon seen through the overlays of scope_list (most important first)
+func (l *SLexicon) View(scope_list ...string) LexiconView {
+	return LexiconView{lexicon: l, scope_list: scope_list}
+}
+
+// the lexicon as seen by a user: their own overlay first, then those of the knowledge-base schemas
+// in schema_list (most important first), the semantics of other schemas don't change what a word means to them
+func (l *SLexicon) ViewForUser(username string, schema_list ...string) LexiconView {
+	scope_list := []string{UserScope(username)}
+	for _, schema_name := range schema_list {
+		scope_list = append(scope_list, SchemaScope(schema_name))
+	}
+	return l.View(scope_list...)
+}
+
+// add a word's semantic to an overlay
+func (l *SLexicon) AddOverlaySemantic(scope string, word string, semantic string) {
+	l.Lock()            // one at a time
+	defer l.Unlock()
+
+	if l.overlays == nil {
+		l.overlays = make(map[string]map[string]string, 0)
+	}
+	if _, ok := l.overlays[scope]; !ok {
+		l.overlays[scope] = make(map[string]string, 0)
+	}
+	l.overlays[scope][word] = strings.ToLower(semantic)
+	l.testAndAddCompoundWord(word) // compound words are shared by all
+}
+
+// remove a word's semantic from an overlay, returns true if it was there
+func (l *SLexicon) RemoveOverlaySemantic(scope string, word string) bool {
+	l.Lock()            // one at a time
+	defer l.Unlock()
+
+	_, ok := l.overlays[scope][word]
+	delete(l.overlays[scope], word)
+	if len(l.overlays[scope]) == 0 {
+		delete(l.overlays, scope)
+	}
+	return ok
+}
+
+// does an overlay have a semantic for exactly this word?
+func (l *SLexicon) HasOverlaySemantic(scope string, word string) bool {
+	l.RLock()
+	defer l.RUnlock()
+	_, ok := l.overlays[scope][word]
+	return ok
+}
+
+// add or remove a word whose guessed semantic was rejected in an overlay
+func (l *SLexicon) setRejected(scope string, word string, save bool) {
+	l.Lock()            // one at a time
+	defer l.Unlock()
+
+	if save {
+		if l.rejected == nil {
+			l.rejected = make(map[string]map[string]bool, 0)
+		}
+		if _, ok := l.rejected[scope]; !ok {
+			l.rejected[scope] = make(map[string]bool, 0)
+		}
+		l.rejected[scope][word] = true
+	} else {
+		delete(l.rejected[scope], word)
+		if len(l.rejected[scope]) == 0 {
+			delete(l.rejected, scope)
+		}
+	}
+}
+
+// the scope of the view's own overlay (its first), empty if it has none
+func (v LexiconView) Scope() string {
+	if len(v.scope_list) == 0 {
+		return ""
+	}
+	return v.scope_list[0]
+}
+
+// was the guessed semantic of a word rejected in one of the view's overlays?
+func (v LexiconView) IsRejected(word string) bool {
+	v.lexicon.RLock()
+	defer v.lexicon.RUnlock()
+	for _, scope := range v.scope_list {
+		if v.lexicon.rejected[scope][word] {
+			return true
+		}
+	}
+	return false
+}
+
+// look a word up in a semantic map, like GetSemantic() does
+func lookupSemantic(l *SLexicon, semantic_map map[string]string, word string) (string, bool) {
+	if val, ok := semantic_map[word]; ok { // non case sensitive first
+		return val, true
+	}
+	val, ok := semantic_map[l.getStem(strings.ToLower(word))]
+	return val, ok
+}
+
+// return the semantic for a noun, from the first overlay that has it or the lexicon, otherwise empty string
+func (v LexiconView) GetSemantic(word string) string {
+	v.lexicon.RLock()
+	defer v.lexicon.RUnlock()
+	for _, scope := range v.scope_list {
+		if val, ok := lookupSemantic(v.lexicon, v.lexicon.overlays[scope], word); ok {
+			return val
+		}
+	}
+	val, _ := lookupSemantic(v.lexicon, v.lexicon.Semantic, word)
+	return val
+}
+
+// find all words (and their semantics) containing find_str as seen through the view
+func (v LexiconView) FindSemantics(find_str string) map[string]string {
+	result_map := v.lexicon.FindSemantics(find_str)
+
+	v.lexicon.RLock()
+	defer v.lexicon.RUnlock()
+	find_lwr := strings.ToLower(find_str)
+	for i := len(v.scope_list) - 1; i >= 0; i-- { // the most important overlay last
+		for word, semantic := range v.lexicon.overlays[v.scope_list[i]] {
+			if strings.Contains(strings.ToLower(word), find_lwr) {
+				result_map[word] = semantic
+			}
+		}
+	}
+	return result_map
+}
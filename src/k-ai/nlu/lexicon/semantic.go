@@ -49,17 +49,51 @@ func (l *SLexicon) AddSemantic(word string, semantic string) {
 
 // return the semantic for a noun if it exists, otherwise empty string
 func (l *SLexicon) GetSemantic(word string) string {
-	l.Lock()            // one at a time
-	defer l.Unlock()
+	l.RLock()
+	defer l.RUnlock()
 
 	if val, ok := l.Semantic[word]; ok { // non case sensitive first
 		return val
 	}
 	lwrStr := strings.ToLower(word)
-	stemmedWord := l.GetStem(lwrStr)
+	stemmedWord := l.getStem(lwrStr)
 	if val, ok := l.Semantic[stemmedWord]; ok {
 		return val
 	}
 	return ""
 }
 
+
+// does this exact word have a semantic?
+func (l *SLexicon) HasSemantic(word string) bool {
+	l.RLock()
+	defer l.RUnlock()
+
+	_, ok := l.Semantic[word]
+	return ok
+}
+
+// remove the semantic of a word, returns true if it had one
+func (l *SLexicon) RemoveSemantic(word string) bool {
+	l.Lock()            // one at a time
+	defer l.Unlock()
+
+	_, ok := l.Semantic[word]
+	delete(l.Semantic, word)
+	return ok
+}
+
+// return a copy of all words (and their semantics) that contain a string, not case sensitive
+func (l *SLexicon) FindSemantics(find_str string) map[string]string {
+	l.RLock()
+	defer l.RUnlock()
+
+	find_lwr := strings.ToLower(find_str)
+	result_map := make(map[string]string, 0)
+	for word, semantic := range l.Semantic {
+		if strings.Contains(strings.ToLower(word), find_lwr) {
+			result_map[word] = semantic
+		}
+	}
+	return result_map
+}
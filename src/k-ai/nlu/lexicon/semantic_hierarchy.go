@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package lexicon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"k-ai/util"
+)
+
+// load the semantic is-a hierarchy (semantic:parent lines) into its map
+func (l *SLexicon) loadSemanticHierarchy(dataDir string) error {
+	l.semanticParent = make(map[string]string, 0)
+	filename := dataDir + "/lexicon/semantic_hierarchy.txt"
+	file_contents, err := util.LoadTextFile(filename)
+	if err != nil { return err }
+	for i, line := range strings.Split(file_contents, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(strings.ToLower(line), ":")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return errors.New(fmt.Sprintf("%s:%d: invalid line, semantic:parent expected", filename, i + 1))
+		}
+		if parent, ok := l.semanticParent[parts[0]]; ok && parent != parts[1] {
+			return errors.New(fmt.Sprintf("%s:%d: %s already has parent %s", filename, i + 1, parts[0], parent))
+		}
+		l.semanticParent[parts[0]] = parts[1]
+		if len(l.getSemanticAncestors(parts[0])) > len(l.semanticParent) {
+			return errors.New(fmt.Sprintf("%s:%d: cycle in the semantic hierarchy at %s", filename, i + 1, parts[0]))
+		}
+	}
+	return nil
+}
+
+// GetSemanticAncestors() for callers holding the lock
+// stops at a cycle, so the list is one longer than the hierarchy when there is one
+func (l *SLexicon) getSemanticAncestors(semantic string) []string {
+	ancestor_list := make([]string, 0)
+	for parent, ok := l.semanticParent[semantic]; ok; parent, ok = l.semanticParent[parent] {
+		ancestor_list = append(ancestor_list, parent)
+		if len(ancestor_list) > len(l.semanticParent) {
+			break
+		}
+	}
+	return ancestor_list
+}
+
+// return the parents of a semantic, nearest first, e.g. man -> [male, person]
+func (l *SLexicon) GetSemanticAncestors(semantic string) []string {
+	l.RLock()
+	defer l.RUnlock()
+	return l.getSemanticAncestors(strings.ToLower(semantic))
+}
+
+// return all semantics that are a semantic (excluding itself), sorted, e.g. location -> [city, country, state]
+func (l *SLexicon) GetSubSemantics(semantic string) []string {
+	l.RLock()
+	defer l.RUnlock()
+	semantic = strings.ToLower(semantic)
+	sub_list := make([]string, 0)
+	for child := range l.semanticParent {
+		for _, ancestor := range l.getSemanticAncestors(child) {
+			if ancestor == semantic {
+				sub_list = append(sub_list, child)
+				break
+			}
+		}
+	}
+	sort.Strings(sub_list)
+	return sub_list
+}
+
+// is semantic an ancestor?  true if they're the same or ancestor is one of semantic's parents
+// e.g. IsA("city", "location") and IsA("man", "person")
+func (l *SLexicon) IsA(semantic string, ancestor string) bool {
+	semantic = strings.ToLower(semantic)
+	ancestor = strings.ToLower(ancestor)
+	if len(semantic) == 0 || len(ancestor) == 0 {
+		return false
+	}
+	if semantic == ancestor {
+		return true
+	}
+	for _, parent := range l.GetSemanticAncestors(semantic) {
+		if parent == ancestor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package lexicon
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"bufio"
+	"errors"
+	"strings"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"k-ai/util"
+	"k-ai/nlu/model"
+)
+
+//
+// Lexicon snapshot
+//
+// Parsing the lexicon's text files takes most of the startup time of every process (and test binary).
+// The lexicon is only loaded when it is first used (see SLexicon.load), so importing it costs nothing,
+// and the parsed lexicon is kept in a binary snapshot next to its text files.  The snapshot records the
+// fingerprint (name, size and modification time) of the text files it was made from and is only used
+// if it has the current snapshot version and the text files haven't changed, otherwise the lexicon is
+// compiled from the text files again and a new snapshot is saved.  Undesirables (undesirables.go) and
+// lexicon updates are never part of a snapshot, they're applied after loading.
+// See BenchmarkLoadSnapshot and BenchmarkLoadTextFiles for what it saves.
+//
+
+// change this whenever what goes into a snapshot changes
+const snapshotVersion = 1
+
+// the snapshot file, relative to the data directory
+const snapshotFilename = "/lexicon/lexicon.snapshot"
+
+// the parsed lexicon files
+type lexiconSnapshot struct {
+	Version        int
+	Fingerprint    string
+	Plural         map[string]string
+	Verb           map[string]string
+	Semantic       map[string]string
+	SemanticParent map[string]string
+	LWord          map[string][]model.Token
+	StemSet        map[string]map[string]bool
+	SynonymSet     map[string]map[string]bool
+}
+
+// the text files the lexicon is compiled from, relative to the data directory
+func lexiconSourceFiles(dataDir string) ([]string, error) {
+	file_list := []string{"/lexicon/plurals.txt", "/lexicon/verbs.txt", "/lexicon/synonyms.txt",
+		"/lexicon/compound_nouns.txt", "/lexicon/semantic_hierarchy.txt"}
+	semantic_list, err := util.GetFilesInDirectory(dataDir + "/lexicon/semantics/*.txt")
+	if err != nil { return nil, err }
+	for _, filename := range semantic_list {
+		file_list = append(file_list, strings.TrimPrefix(filename, dataDir))
+	}
+	sort.Strings(file_list)
+	return file_list, nil
+}
+
+// the fingerprint of the lexicon's text files, changes when any of them does
+func lexiconFingerprint(dataDir string) (string, error) {
+	file_list, err := lexiconSourceFiles(dataDir)
+	if err != nil { return "", err }
+	hash := sha256.New()
+	for _, filename := range file_list {
+		info, err := os.Stat(dataDir + filename)
+		if err != nil { return "", err }
+		fmt.Fprintf(hash, "%s|%d|%d\n", filename, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// load the lexicon from its snapshot, fails if there is no snapshot or it is out of date
+func (l *SLexicon) loadSnapshot(dataDir string) error {
+	fingerprint, err := lexiconFingerprint(dataDir)
+	if err != nil { return err }
+
+	file, err := os.Open(dataDir + snapshotFilename)
+	if err != nil { return err }
+	defer file.Close()
+
+	var snapshot lexiconSnapshot
+	err = gob.NewDecoder(bufio.NewReader(file)).Decode(&snapshot)
+	if err != nil { return err }
+	if snapshot.Version != snapshotVersion {
+		return errors.New(fmt.Sprintf("snapshot version %d, expected %d", snapshot.Version, snapshotVersion))
+	}
+	if snapshot.Fingerprint != fingerprint {
+		return errors.New("lexicon files changed since the snapshot was made")
+	}
+
+	// gob leaves out empty maps
+	for _, string_map := range []*map[string]string{&snapshot.Plural, &snapshot.Verb, &snapshot.Semantic, &snapshot.SemanticParent} {
+		if *string_map == nil {
+			*string_map = make(map[string]string, 0)
+		}
+	}
+	for _, set_map := range []*map[string]map[string]bool{&snapshot.StemSet, &snapshot.SynonymSet} {
+		if *set_map == nil {
+			*set_map = make(map[string]map[string]bool, 0)
+		}
+	}
+	if snapshot.LWord == nil {
+		snapshot.LWord = make(map[string][]model.Token, 0)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	l.plural = snapshot.Plural
+	l.verb = snapshot.Verb
+	l.Semantic = snapshot.Semantic
+	l.semanticParent = snapshot.SemanticParent
+	l.LWord = make(map[string][]model.Token, len(snapshot.LWord))
+	l.stemSet = snapshot.StemSet
+	l.synonymSet = snapshot.SynonymSet
+	l.compoundTrie = newWordTrie()
+	l.compoundSet = make(map[string]map[string]bool, 0)
+	for word_lwr, parts := range snapshot.LWord {
+		l.addCompoundWord(word_lwr, parts)
+	}
+	return nil
+}
+
+// save the lexicon as parsed from its text files as its snapshot
+// the snapshot is written to a temporary file first, so other processes never see half a snapshot
+func (l *SLexicon) saveSnapshot(dataDir string, fingerprint string) error {
+	l.RLock()
+	defer l.RUnlock()
+	snapshot := lexiconSnapshot{Version: snapshotVersion, Fingerprint: fingerprint, Plural: l.plural, Verb: l.verb,
+		Semantic: l.Semantic, SemanticParent: l.semanticParent, LWord: l.LWord, StemSet: l.stemSet, SynonymSet: l.synonymSet}
+
+	temp_filename := fmt.Sprintf("%s%s.%d", dataDir, snapshotFilename, os.Getpid())
+	file, err := os.Create(temp_filename)
+	if err != nil { return err }
+	writer := bufio.NewWriter(file)
+	err = gob.NewEncoder(writer).Encode(&snapshot)
+	if err == nil {
+		err = writer.Flush()
+	}
+	close_err := file.Close()
+	if err == nil {
+		err = close_err
+	}
+	if err != nil {
+		os.Remove(temp_filename)
+		return err
+	}
+	return os.Rename(temp_filename, dataDir + snapshotFilename)
+}
+
+// compile the lexicon's text files and save them as its snapshot, whether the snapshot is up to date or not
+func CompileSnapshot(dataDir string) error {
+	fingerprint, err := lexiconFingerprint(dataDir)
+	if err != nil { return err }
+	l := &SLexicon{initialised: true}
+	err = l.loadTextFiles(dataDir)
+	if err != nil { return err }
+	return l.saveSnapshot(dataDir, fingerprint)
+}
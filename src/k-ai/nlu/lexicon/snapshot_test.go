@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package lexicon
+
+import (
+	"os"
+	"testing"
+	"io/ioutil"
+	"k-ai/util"
+	"k-ai/util_ut"
+)
+
+// write a small lexicon to a temporary data directory
+func writeTestLexicon(t *testing.T) string {
+	dataDir, err := ioutil.TempDir("", "lexicon")
+	util_ut.Check(t, err)
+	util_ut.Check(t, os.MkdirAll(dataDir + "/lexicon/semantics", 0755))
+	file_map := map[string]string{
+		"/lexicon/plurals.txt": "boat|boats\nlady|ladies\n",
+		"/lexicon/verbs.txt": "sail|sailed|sail|sailing|sailed|sails\n",
+		"/lexicon/synonyms.txt": "boat,ship\n",
+		"/lexicon/compound_nouns.txt": "old lady\nNew York City\n",
+		"/lexicon/semantic_hierarchy.txt": "city:location\n",
+		"/lexicon/semantics/cities.txt": "New York:city\n",
+	}
+	for filename, contents := range file_map {
+		util_ut.Check(t, util.SaveTextFile(dataDir + filename, contents))
+	}
+	return dataDir
+}
+
+// test a compiled snapshot loads the same lexicon as its text files, and goes stale when they change
+func TestSnapshot1(t *testing.T) {
+	dataDir := writeTestLexicon(t)
+	defer os.RemoveAll(dataDir)
+
+	l1 := &SLexicon{initialised: true}
+	util_ut.IsTrue(t, l1.loadSnapshot(dataDir) != nil) // no snapshot yet
+	util_ut.Check(t, CompileSnapshot(dataDir))
+
+	l2 := &SLexicon{initialised: true}
+	util_ut.Check(t, l2.loadTextFiles(dataDir))
+	util_ut.Check(t, l1.loadSnapshot(dataDir))
+	for _, l := range []*SLexicon{l1, l2} {
+		util_ut.IsTrue(t, l.GetStem("Boats") == "boat" && l.GetStem("sailing") == "sail")
+		util_ut.IsTrue(t, len(l.GetSynonymList("ship")) == 1)
+		util_ut.IsTrue(t, l.GetSemantic("New York") == "city" && l.IsA("city", "location"))
+		util_ut.IsTrue(t, len(l.LWord) == 3) // old lady, New York City and New York
+		size, text, _ := l.compoundTrie.longestMatch(textToTokenList("the old lady"), 1, maxWordConstituentLength)
+		util_ut.IsTrue(t, size == 2 && text == "old lady")
+	}
+
+	// the lexicon can still change after loading a snapshot
+	l1.AddSemantic("Boston", "city")
+	util_ut.IsTrue(t, l1.GetSemantic("Boston") == "city")
+
+	// changing a lexicon file makes the snapshot stale
+	util_ut.Check(t, util.SaveTextFile(dataDir + "/lexicon/synonyms.txt", "boat,ship,vessel\n"))
+	util_ut.IsTrue(t, l1.loadSnapshot(dataDir) != nil)
+}
+
+// load the real lexicon from its snapshot, compare with BenchmarkLoadTextFiles
+func BenchmarkLoadSnapshot(b *testing.B) {
+	dataDir := util.GetDataPath()
+	err := CompileSnapshot(dataDir)
+	if err != nil {
+		b.Skip("cannot write the lexicon snapshot: " + err.Error())
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := &SLexicon{initialised: true}
+		err := l.loadSnapshot(dataDir)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// compile the real lexicon from its text files, as happens without an up to date snapshot
+func BenchmarkLoadTextFiles(b *testing.B) {
+	dataDir := util.GetDataPath()
+	for i := 0; i < b.N; i++ {
+		l := &SLexicon{initialised: true}
+		err := l.loadTextFiles(dataDir)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
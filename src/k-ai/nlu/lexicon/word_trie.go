@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package lexicon
+
+import (
+	"strings"
+	"k-ai/nlu/model"
+)
+
+// a trie of the compound words for longest word matching, one level per (lower case) word
+// "New York City" is stored as new -> york -> city, so matching a sentence only follows its own words
+// instead of trying every possible word sequence against all compound words
+type wordTrie struct {
+	children map[string]*wordTrie
+	parts    []model.Token // the parts of the compound word ending here, nil if none does
+}
+
+// create an empty trie
+func newWordTrie() *wordTrie {
+	return &wordTrie{children: make(map[string]*wordTrie, 0)}
+}
+
+// add a (lower case) compound word and its parts
+func (t *wordTrie) add(word_lwr string, parts []model.Token) {
+	node := t
+	for _, word := range strings.Split(word_lwr, " ") {
+		child, ok := node.children[word]
+		if !ok {
+			child = newWordTrie()
+			node.children[word] = child
+		}
+		node = child
+	}
+	node.parts = parts
+}
+
+// remove a (lower case) compound word, and the nodes only it used
+func (t *wordTrie) remove(word_lwr string) {
+	path := []*wordTrie{t}
+	word_list := strings.Split(word_lwr, " ")
+	for _, word := range word_list {
+		child, ok := path[len(path) - 1].children[word]
+		if !ok {
+			return // not in the trie
+		}
+		path = append(path, child)
+	}
+	path[len(path) - 1].parts = nil
+	for i := len(word_list) - 1; i >= 0; i-- {
+		node := path[i + 1]
+		if node.parts != nil || len(node.children) > 0 {
+			break
+		}
+		delete(path[i].children, word_list[i])
+	}
+}
+
+// find the longest compound word starting at token_list[index], spanning at most max_size tokens
+// tokens without text are skipped, and a token with spaces in its text counts as its words
+// returns the number of tokens spanned, the text of the compound word, and its parts (0, "", nil if none)
+func (t *wordTrie) longestMatch(token_list []model.Token, index int, max_size int) (int, string, []model.Token) {
+	if index + max_size > len(token_list) {
+		max_size = len(token_list) - index
+	}
+	result_size := 0
+	result_text := ""
+	var result_parts []model.Token
+
+	node := t
+	text := ""
+	for i := 0; i < max_size; i++ {
+		word_str := token_list[index + i].Text
+		if len(word_str) == 0 {
+			continue
+		}
+		for _, word := range strings.Split(strings.ToLower(word_str), " ") {
+			node = node.children[word]
+			if node == nil {
+				return result_size, result_text, result_parts // no compound word continues this way
+			}
+		}
+		if len(text) > 0 {
+			text += " "
+		}
+		text += word_str
+		if node.parts != nil {
+			result_size = i + 1
+			result_text = text
+			result_parts = node.parts
+		}
+	}
+	return result_size, result_text, result_parts
+}
@@ -11,19 +11,48 @@
 
 package model
 
+import "github.com/gocql/gocql"
+
 // aiml structure node
 type Aiml struct {
 	Text         string           // the text to match on
 	Origin       string           // whence it came or its origin
-	TemplateList []string         // possible answers
+	TemplateList []AimlTemplate   // possible answers
 	NodeSet      map[string]*Aiml // other nodes of this node
 }
 
+// an answer of a node
+type AimlTemplate struct {
+	Template string // the AIML template (xml)
+	Text     string // the template's text without its xml tags
+	That     string // the pattern the previous reply must match, empty for any
+	Topic    string // the pattern the conversation's topic must match, empty for any
+}
+
+// an AIML <category> of a module, as stored in the db
+type AimlCategory struct {
+	Id          gocql.UUID `json:"id"`
+	Module      string     `json:"module"`       // the module it belongs to, e.g. "ai" for data/aiml/ai.aiml
+	PatternList []string   `json:"pattern_list"`
+	That        string     `json:"that"`
+	Topic       string     `json:"topic"`
+	Template    string     `json:"template"`     // the template's xml
+}
+
 // binding
 type AimlBinding struct {
 	Text      string // the text
 	Origin    string // whence it came
 	Offset    int
-	TokenList []Token
+	TokenList []Token   // the text bound to the first wildcard
+	Template  string    // the AIML template (xml) of the text, empty for plain text
+	StarList  [][]Token // the text bound to each wildcard
+	Pattern   string    // the pattern matched
+}
+
+// the state of an AIML conversation, kept with its session
+type AimlState struct {
+	Predicates map[string]string `json:"predicates"` // <set>/<get> values, including the topic
+	That       string            `json:"that"`       // the previous reply
 }
 
@@ -15,11 +15,14 @@ import "github.com/gocql/gocql"
 
 // the result of an ask or teach request
 type ATResult struct {
-	Text string						`json:"text"`
+	Answer string					`json:"answer"`         // short answer extracted from Text, if any
+	Text string						`json:"text"`           // the full text (supporting evidence for an Answer)
 	Timestamp string				`json:"timestamp"`
 	Topic string					`json:"topic"`
 	Sentence_id gocql.UUID          `json:"sentence_id"`    // id for the item if applicable
 	KB_id gocql.UUID          		`json:"kb_id"`
+	Support_list []gocql.UUID		`json:"support_list"`   // factoids supporting a yes/no answer
+	Similarity float64				`json:"similarity,omitempty"` // closeness in meaning to the question, for similarity matches
 }
 
 // a list of ask teach results with error / message fields
@@ -27,5 +30,6 @@ type ATResultList struct {
 	Message string				`json:"message"`
 	Error string				`json:"error"`
 	ResultList []ATResult		`json:"result_list"`
+	QuestionType QuestionType	`json:"question_type"`  // the classification of an ask's question
 }
 
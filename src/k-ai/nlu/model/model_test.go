@@ -86,3 +86,57 @@ func TestIsImperative1(t *testing.T) {
 	isTrue(t, !jsonToSentence(t, str1).IsQuestion())
 }
 
+
+
+// test sentence.GetQuestionType()
+func TestQuestionType1(t *testing.T) {
+	// who is Peter
+	const str1 = `[{"tokenList":[{"index":0,"list":[1],"tag":"WP","text":"who","dep":"nsubj","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBZ","text":"is","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[1],"tag":"NNP","text":"Peter","dep":"attr","synid":-1,"semantic":"person"}]}]`
+	// where does Mark live?
+	const str2 = `[{"tokenList":[{"index":0,"list":[3],"tag":"WRB","text":"where","dep":"advmod","synid":-1,"semantic":""},{"index":1,"list":[3],"tag":"VBZ","text":"does","dep":"aux","synid":-1,"semantic":""},{"index":2,"list":[3],"tag":"NNP","text":"Mark","dep":"nsubj","synid":-1,"semantic":"male"},{"index":3,"list":[],"tag":"VB","text":"live","dep":"ROOT","synid":-1,"semantic":""},{"index":4,"list":[3],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+	// how many boats does Peter have?
+	const str3 = `[{"tokenList":[{"index":0,"list":[1,2,5],"tag":"WRB","text":"how","dep":"advmod","synid":-1,"semantic":""},{"index":1,"list":[2,5],"tag":"JJ","text":"many","dep":"amod","synid":-1,"semantic":""},{"index":2,"list":[5],"tag":"NNS","text":"boats","dep":"dobj","synid":-1,"semantic":"vehicle"},{"index":3,"list":[5],"tag":"VBZ","text":"does","dep":"aux","synid":-1,"semantic":""},{"index":4,"list":[5],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"person"},{"index":5,"list":[],"tag":"VB","text":"have","dep":"ROOT","synid":-1,"semantic":""},{"index":6,"list":[5],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+	// is Mark living in his car?
+	const str4 = `[{"tokenList":[{"index":0,"list":[2],"tag":"VBZ","text":"is","dep":"aux","synid":-1,"semantic":""},{"index":1,"list":[2],"tag":"NNP","text":"Mark","dep":"nsubj","synid":-1,"semantic":"male"},{"index":2,"list":[],"tag":"VBG","text":"living","dep":"ROOT","synid":-1,"semantic":""},{"index":3,"list":[2],"tag":"IN","text":"in","dep":"prep","synid":-1,"semantic":""},{"index":4,"list":[5,3,2],"tag":"PRP$","text":"his","dep":"poss","synid":-1,"semantic":""},{"index":5,"list":[3,2],"tag":"NN","text":"car","dep":"pobj","synid":-1,"semantic":"vehicle"},{"index":6,"list":[2],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+	// what is a boat?
+	const str5 = `[{"tokenList":[{"index":0,"list":[1],"tag":"WP","text":"what","dep":"attr","synid":-1,"semantic":""},{"index":1,"list":[],"tag":"VBZ","text":"is","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[3,1],"tag":"DT","text":"a","dep":"det","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":"NN","text":"boat","dep":"nsubj","synid":-1,"semantic":"vehicle"},{"index":4,"list":[1],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+	// when did Peter arrive?
+	const str6 = `[{"tokenList":[{"index":0,"list":[3],"tag":"WRB","text":"when","dep":"advmod","synid":-1,"semantic":""},{"index":1,"list":[3],"tag":"VBD","text":"did","dep":"aux","synid":-1,"semantic":""},{"index":2,"list":[3],"tag":"NNP","text":"Peter","dep":"nsubj","synid":-1,"semantic":"person"},{"index":3,"list":[],"tag":"VB","text":"arrive","dep":"ROOT","synid":-1,"semantic":""},{"index":4,"list":[3],"tag":".","text":"?","dep":"punct","synid":-1,"semantic":""}]}]`
+	// list all boats
+	const str7 = `[{"tokenList":[{"index":0,"list":[],"tag":"VB","text":"list","dep":"ROOT","synid":-1,"semantic":""},{"index":1,"list":[2,0],"tag":"DT","text":"all","dep":"det","synid":-1,"semantic":""},{"index":2,"list":[0],"tag":"NNS","text":"boats","dep":"dobj","synid":-1,"semantic":"vehicle"}]}]`
+
+	isTrue(t, jsonToSentence(t, str1).GetQuestionType().Type == QTPerson)
+	isTrue(t, jsonToSentence(t, str2).GetQuestionType().Type == QTLocation)
+	isTrue(t, jsonToSentence(t, str3).GetQuestionType().Type == QTQuantity)
+	isTrue(t, jsonToSentence(t, str4).GetQuestionType().Type == QTYesNo)
+	isTrue(t, jsonToSentence(t, str5).GetQuestionType().Type == QTDefinition)
+	isTrue(t, jsonToSentence(t, str6).GetQuestionType().Type == QTTime)
+	isTrue(t, jsonToSentence(t, str7).GetQuestionType().Type == QTList)
+}
+
+// test answer filtering by question type
+func TestQuestionTypeFilter1(t *testing.T) {
+	// Mark lives in Sydney.
+	const str1 = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Mark","dep":"nsubj","synid":-1,"semantic":"male"},{"index":1,"list":[],"tag":"VBZ","text":"lives","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[1],"tag":"IN","text":"in","dep":"prep","synid":-1,"semantic":""},{"index":3,"list":[2,1],"tag":"NNP","text":"Sydney","dep":"pobj","synid":-1,"semantic":"city"},{"index":4,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+	// Mark lives alone.
+	const str2 = `[{"tokenList":[{"index":0,"list":[1],"tag":"NNP","text":"Mark","dep":"nsubj","synid":-1,"semantic":"male"},{"index":1,"list":[],"tag":"VBZ","text":"lives","dep":"ROOT","synid":-1,"semantic":""},{"index":2,"list":[1],"tag":"RB","text":"alone","dep":"advmod","synid":-1,"semantic":""},{"index":3,"list":[1],"tag":".","text":".","dep":"punct","synid":-1,"semantic":""}]}]`
+
+	s1 := jsonToSentence(t, str1)
+	s2 := jsonToSentence(t, str2)
+
+	location := NewQuestionType(QTLocation)
+	isTrue(t, location.IsAnswerCompatible(s1))
+	isTrue(t, !location.IsAnswerCompatible(s2))
+
+	// the incompatible answer is removed when a compatible one exists
+	list := location.FilterAnswers([]Sentence{s2, s1})
+	isTrue(t, len(list) == 1 && list[0].TokenList[3].Text == "Sydney")
+
+	// but kept when it's all we've got
+	list = location.FilterAnswers([]Sentence{s2})
+	isTrue(t, len(list) == 1)
+
+	// quantity questions want numbers
+	isTrue(t, !NewQuestionType(QTQuantity).IsAnswerCompatible(s1))
+	isTrue(t, NewQuestionType(QTDefinition).IsAnswerCompatible(s2))
+}
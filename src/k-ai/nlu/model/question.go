@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package model
+
+import (
+	"strings"
+)
+
+// the types of questions we can recognise
+const (
+	QTUnknown    = "unknown"    // can't tell, anything goes
+	QTPerson     = "person"     // who is ..., whom did ...
+	QTLocation   = "location"   // where is ...
+	QTTime       = "time"       // when did ..., what time is ...
+	QTQuantity   = "quantity"   // how many ..., how much ...
+	QTDefinition = "definition" // what is a ...
+	QTYesNo      = "yes/no"     // is Mark living in his car?
+	QTList       = "list"       // which boats ..., list all ...
+)
+
+// the classification of a question and the answer it expects
+type QuestionType struct {
+	Type         string   `json:"type"`          // one of the QT constants above
+	SemanticList []string `json:"semantic_list"` // semantics an answer token must have (empty: any)
+	Tag          string   `json:"tag"`           // Penn tag prefix an answer token can have instead (empty: none)
+}
+
+// expected answer semantics for each question type
+var questionTypeSemantics = map[string][]string{
+	QTPerson:   {"person", "male", "female", "man", "woman", "ai"},
+	QTLocation: {"location", "city", "country", "state"},
+	QTTime:     {"time", "date"},
+}
+
+// is semantic a kind of ancestor?  the lexicon replaces this with its semantic hierarchy (lexicon.IsA)
+var IsSemanticA = func(semantic string, ancestor string) bool {
+	return semantic == ancestor
+}
+
+// words that mark a time-ish answer for "when" questions in the absence of a semantic
+var timeWords = map[string]bool{
+	"today": true, "yesterday": true, "tomorrow": true, "tonight": true, "morning": true, "afternoon": true,
+	"evening": true, "night": true, "noon": true, "midnight": true, "o'clock": true, "am": true, "pm": true,
+	"week": true, "month": true, "year": true, "ago": true, "later": true, "before": true, "after": true,
+	"monday": true, "tuesday": true, "wednesday": true, "thursday": true, "friday": true, "saturday": true,
+	"sunday": true, "january": true, "february": true, "march": true, "april": true, "may": true, "june": true,
+	"july": true, "august": true, "september": true, "october": true, "november": true, "december": true,
+}
+
+// auxiliary verbs that start a yes/no question
+var yesNoAux = map[string]bool{
+	"is": true, "are": true, "was": true, "were": true, "am": true,
+	"do": true, "does": true, "did": true, "have": true, "has": true, "had": true,
+	"can": true, "could": true, "will": true, "would": true, "should": true, "shall": true,
+}
+
+// words in "what {time|year|...}" that make it a time question
+var timeQuestionNouns = map[string]bool{
+	"time": true, "year": true, "date": true, "day": true, "month": true, "century": true,
+}
+
+// create a question type for a type with its default answer expectations
+func NewQuestionType(qtype string) QuestionType {
+	qt := QuestionType{Type: qtype, SemanticList: make([]string, 0)}
+	if list, ok := questionTypeSemantics[qtype]; ok {
+		qt.SemanticList = append(qt.SemanticList, list...)
+	}
+	if qtype == QTQuantity {
+		qt.Tag = "CD"
+	}
+	return qt
+}
+
+// is this token a wh-word (who, what, where, which, when, how, whose, whom)?
+func isWhToken(t_token *Token) bool {
+	return t_token.Tag == "WP" || t_token.Tag == "WP$" || t_token.Tag == "WRB" || t_token.Tag == "WDT"
+}
+
+// return the first non wh- noun following the wh-word at index, or nil
+func nextNoun(token_list []Token, index int) *Token {
+	for i := index + 1; i < len(token_list); i++ {
+		if strings.HasPrefix(token_list[i].Tag, "NN") {
+			return &token_list[i]
+		}
+		if strings.HasPrefix(token_list[i].Tag, "VB") {
+			break
+		}
+	}
+	return nil
+}
+
+// classify this sentence as a type of question and what kind of answer it expects
+// statements and anything we don't recognise are QTUnknown
+func (s Sentence) GetQuestionType() QuestionType {
+	if len(s.TokenList) == 0 {
+		return NewQuestionType(QTUnknown)
+	}
+
+	// imperative requests for lists: list / name / enumerate ...
+	first := strings.ToLower(s.TokenList[0].Text)
+	if first == "list" || first == "enumerate" || (first == "name" && strings.HasPrefix(s.TokenList[0].Tag, "VB")) {
+		return NewQuestionType(QTList)
+	}
+
+	for i, t_token := range s.TokenList {
+		if !isWhToken(&t_token) {
+			continue
+		}
+		word := strings.ToLower(t_token.Text)
+		switch word {
+		case "who", "whom", "whose":
+			return NewQuestionType(QTPerson)
+		case "where":
+			return NewQuestionType(QTLocation)
+		case "when":
+			return NewQuestionType(QTTime)
+		case "how":
+			if i+1 < len(s.TokenList) {
+				next := strings.ToLower(s.TokenList[i+1].Text)
+				if next == "many" || next == "much" || next == "old" || next == "long" || next == "far" {
+					return NewQuestionType(QTQuantity)
+				}
+			}
+			return NewQuestionType(QTUnknown)
+		case "which":
+			noun := nextNoun(s.TokenList, i)
+			if noun != nil && (noun.Tag == "NNS" || noun.Tag == "NNPS") {
+				return NewQuestionType(QTList)
+			}
+			return NewQuestionType(QTUnknown)
+		case "what":
+			noun := nextNoun(s.TokenList, i)
+			if noun != nil && timeQuestionNouns[strings.ToLower(noun.Text)] && noun.Index == t_token.Index+1 {
+				return NewQuestionType(QTTime)
+			}
+			// what is X / what are X  - a definition
+			if i+1 < len(s.TokenList) {
+				verb := strings.ToLower(s.TokenList[i+1].Text)
+				if (verb == "is" || verb == "are" || verb == "was" || verb == "were") && s.numVerbs() == 1 {
+					return NewQuestionType(QTDefinition)
+				}
+			}
+			return NewQuestionType(QTUnknown)
+		}
+	}
+
+	// no wh-word: a question starting with an auxiliary is a yes/no question
+	if yesNoAux[first] && s.IsQuestion() {
+		return NewQuestionType(QTYesNo)
+	}
+	return NewQuestionType(QTUnknown)
+}
+
+// count the number of verbs in this sentence
+func (s Sentence) numVerbs() int {
+	count := 0
+	for _, t_token := range s.TokenList {
+		if strings.HasPrefix(t_token.Tag, "VB") {
+			count += 1
+		}
+	}
+	return count
+}
+
+// does this question type restrict what an answer looks like?
+func (qt QuestionType) HasExpectation() bool {
+	return len(qt.SemanticList) > 0 || len(qt.Tag) > 0 || qt.Type == QTTime
+}
+
+// is this token a suitable answer for this type of question?
+func (qt QuestionType) IsAnswerToken(t_token *Token) bool {
+	semantic := strings.ToLower(t_token.Semantic)
+	for _, sem := range qt.SemanticList {
+		if semantic == sem || IsSemanticA(semantic, sem) {
+			return true
+		}
+	}
+	if len(qt.Tag) > 0 && strings.HasPrefix(t_token.Tag, qt.Tag) {
+		return true
+	}
+	if qt.Type == QTTime {
+		if t_token.Tag == "CD" || timeWords[strings.ToLower(t_token.Text)] {
+			return true
+		}
+	}
+	return false
+}
+
+// does the sentence contain a token that could answer this type of question?
+// question types without expectations accept any sentence
+func (qt QuestionType) IsAnswerCompatible(sentence Sentence) bool {
+	if !qt.HasExpectation() {
+		return true
+	}
+	for i := range sentence.TokenList {
+		if qt.IsAnswerToken(&sentence.TokenList[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// order a set of candidate answers by compatibility with this question type
+// compatible sentences come first; if any are compatible the incompatible ones are dropped
+func (qt QuestionType) FilterAnswers(sentence_list []Sentence) []Sentence {
+	compatible := make([]Sentence, 0)
+	incompatible := make([]Sentence, 0)
+	for _, sentence := range sentence_list {
+		if qt.IsAnswerCompatible(sentence) {
+			compatible = append(compatible, sentence)
+		} else {
+			incompatible = append(incompatible, sentence)
+		}
+	}
+	if len(compatible) > 0 {
+		return compatible
+	}
+	return incompatible
+}
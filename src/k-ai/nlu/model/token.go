@@ -22,9 +22,21 @@ type Token struct {
 	SynId int               `json:"synid"`
 	Semantic string         `json:"semantic"`
 	Anaphora string			`json:"-"`
+	AnaphoraList []string	`json:"-"`  // the members of a group referent, e.g. "they" -> [Peter, Sherry]
 }
 
 func (t Token) ToString() (string) {
 	return fmt.Sprintf("%#v", t)
 }
 
+
+// return what a resolved pronoun refers to, one item per member of a group, or nil if unresolved
+func (t Token) GetReferentList() []string {
+	if len(t.AnaphoraList) > 0 {
+		return t.AnaphoraList
+	}
+	if len(t.Anaphora) > 0 && t.Anaphora != "?" {
+		return []string{t.Anaphora}
+	}
+	return nil
+}
@@ -69,12 +69,16 @@ func PostRequest(url string, text string) ([]model.Sentence, error) {
 }
 
 
-// setup the semantics after a parse
-func setupSemantics(sentenceList []model.Sentence) {
+// setup the semantics after a parse, using the lexicon as seen through view
+// nouns it doesn't know may get the semantic of their neighbours in vector space (see semantic_suggestions.go)
+func setupSemantics(sentenceList []model.Sentence, view lexicon.LexiconView) {
 	for _, sentence := range sentenceList {
 		for i, token := range sentence.TokenList {
 			if len(sentence.TokenList[i].Semantic) == 0 { // only assign if not yet set
-				sentence.TokenList[i].Semantic = lexicon.Lexi.GetSemantic(token.Text)
+				sentence.TokenList[i].Semantic = view.GetSemantic(token.Text)
+			}
+			if len(sentence.TokenList[i].Semantic) == 0 { // unknown, what do its neighbours think?
+				sentence.TokenList[i].Semantic = guessSemantic(&sentence.TokenList[i], view)
 			}
 		}
 	}
@@ -83,6 +87,19 @@ func setupSemantics(sentenceList []model.Sentence) {
 
 // parse a piece of text and return its []model.Sentence
 func ParseText(text string) ([]model.Sentence, error) {
+	return ParseTextWithContext(text, nil)
+}
+
+// parse a piece of text and return its []model.Sentence
+// context_list: previous sentences of the conversation (oldest first) pronouns can refer to, can be nil
+func ParseTextWithContext(text string, context_list model.SentenceList) ([]model.Sentence, error) {
+	return ParseTextWithLexicon(text, context_list, lexicon.Lexi.View())
+}
+
+// parse a piece of text and return its []model.Sentence, with the semantics of a lexicon view
+// (e.g. lexicon.Lexi.ViewForUser(username, schema_list...) for the semantics of a user)
+// context_list: previous sentences of the conversation (oldest first) pronouns can refer to, can be nil
+func ParseTextWithLexicon(text string, context_list model.SentenceList, view lexicon.LexiconView) ([]model.Sentence, error) {
 	// parse the text
 	sentence_list, err := PostRequest(SpacyEndpoint, text)
 	if err != nil { return nil, err }
@@ -91,9 +108,9 @@ func ParseText(text string) ([]model.Sentence, error) {
 	// put spaces back into the sentence after spacy to avoid mistakes
 	sentence_list = lexicon.Lexi.GetLongestWordSequenceForList(sentence_list) // 1. apply longest sentence
 
-	setupSemantics(sentence_list)  // 2. setup semantics for items
+	setupSemantics(sentence_list, view)  // 2. setup semantics for items
 
-	anaphora.LL.ResolvePronouns(sentence_list)  // 3. resolve third person pronouns
+	anaphora.LL.ResolvePronounsWithContext(context_list, sentence_list)  // 3. resolve third person pronouns
 
 	return tokenizer.FilterOutSpacesForSentences(sentence_list), nil
 }
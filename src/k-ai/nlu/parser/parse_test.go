@@ -16,6 +16,8 @@ import (
 	"k-ai/nlu/lexicon"
 	"fmt"
 	"k-ai/util_ut"
+	"k-ai/nlu/glove"
+	"k-ai/nlu/model"
 )
 
 // test we can parse
@@ -70,3 +72,43 @@ func TestParser3(t *testing.T) {
 	str := ttList[0].ToStringIndent()
 	util_ut.IsTrue(t,  str == "_am{VBP}_ (I{nsubj} | KAI{ai} , an Artificial Intelligence .)")
 }
+
+// unknown nouns get the semantic of their neighbours in vector space
+func TestSemanticGuess1(t *testing.T) {
+	glove.Vectors = glove.CreateMapSystem(map[string][]float64{"paris": {1.0, 0.1, 0.0}, "london": {0.95, 0.15, 0.0},
+		"berlin": {0.9, 0.1, 0.1}, "zurbville": {0.97, 0.12, 0.02}, "banana": {-1.0, 0.0, 0.2}, "grumblefruit": {-0.9, 0.1, 0.3}})
+	defer func() { glove.Vectors = nil }()
+
+	sentence_list := []model.Sentence{{TokenList: []model.Token{{Text: "Zurbville", Tag: "NNP"}, {Text: "grumblefruit", Tag: "NN"},
+		{Text: "London", Tag: "NNP"}}}}
+	setupSemantics(sentence_list, lexicon.Lexi.View())
+	util_ut.IsTrue(t, sentence_list[0].TokenList[0].Semantic == "city")
+	util_ut.IsTrue(t, sentence_list[0].TokenList[1].Semantic == "")  // one neighbour, not enough
+	util_ut.IsTrue(t, sentence_list[0].TokenList[2].Semantic == "city")
+
+	// guesses without a user, or for a knowledge base, aren't suggested to anyone
+	util_ut.IsTrue(t, len(Suggestions.List(lexicon.Lexi.View())) == 0)
+	schema := lexicon.Lexi.View(lexicon.SchemaScope("cities"))
+	sentence_list[0].TokenList[0].Semantic = ""
+	setupSemantics(sentence_list, schema)
+	util_ut.IsTrue(t, sentence_list[0].TokenList[0].Semantic == "city" && len(Suggestions.List(schema)) == 0)
+
+	// rejected by peter, no longer guessed for peter, still for mark
+	peter := lexicon.Lexi.ViewForUser("peter@peter.co.nz")
+	mark := lexicon.Lexi.ViewForUser("mark@peter.co.nz")
+	sentence_list[0].TokenList[0].Semantic = ""
+	setupSemantics(sentence_list, mark)
+	suggestion_list := Suggestions.List(mark)
+	util_ut.IsTrue(t, len(suggestion_list) == 1 && suggestion_list[0].Word == "Zurbville" && suggestion_list[0].Semantic == "city")
+	util_ut.IsTrue(t, len(Suggestions.List(peter)) == 0)
+	util_ut.Check(t, lexicon.Lexi.ApplyUpdate(lexicon.LexiconUpdate{Kind: lexicon.UpdateRejected, Word: "Zurbville",
+		Operation: lexicon.OpSave, Scope: peter.Scope()}))
+	sentence_list[0].TokenList[0].Semantic = ""
+	setupSemantics(sentence_list, peter)
+	util_ut.IsTrue(t, sentence_list[0].TokenList[0].Semantic == "" && len(Suggestions.List(peter)) == 0)
+	sentence_list[0].TokenList[0].Semantic = ""
+	setupSemantics(sentence_list, mark)
+	util_ut.IsTrue(t, sentence_list[0].TokenList[0].Semantic == "city" && len(Suggestions.List(mark)) == 1)
+	util_ut.Check(t, lexicon.Lexi.ApplyUpdate(lexicon.LexiconUpdate{Kind: lexicon.UpdateRejected, Word: "Zurbville",
+		Operation: lexicon.OpDelete, Scope: peter.Scope()}))
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package parser
+
+import (
+	"sort"
+	"sync"
+	"strings"
+	"unicode"
+	"k-ai/nlu/glove"
+	"k-ai/nlu/model"
+	"k-ai/nlu/lexicon"
+)
+
+//
+// Semantic suggestions
+//
+// Nouns without a semantic get the semantic their neighbours in vector space agree on (see
+// glove.GuessSemantic), when word vectors are loaded.  Each guess made for a user is also kept as a
+// suggestion for the entities UI, by the scope of their lexicon view, where they can accept it (saving it
+// as a semantic entity) or reject it.  A rejection is a lexicon update (lexicon.UpdateRejected) of the
+// user's overlay, stored like any other, after which the word isn't guessed for them again.  Guesses made
+// without a user (ParseText) or for a knowledge base (a kb: scope) are used, but not suggested, as no one
+// would see them.  Suggestions are kept in memory by each instance.
+//
+
+// the minimum confidence of a guess for it to be used
+const SemanticGuessConfidence = 0.6
+
+// the most suggestions kept per scope
+const maxSemanticSuggestions = 100
+
+// a guessed semantic waiting for a human
+type SemanticSuggestion struct {
+	glove.SemanticGuess
+	Count int `json:"count"` // how often it was guessed
+}
+
+// the suggestions made, by scope
+type semanticSuggestions struct {
+	sync.Mutex
+	suggestion_map map[string]map[string]*SemanticSuggestion  // scope -> word -> suggestion
+}
+
+// the suggestions of this instance
+var Suggestions = &semanticSuggestions{suggestion_map: make(map[string]map[string]*SemanticSuggestion, 0)}
+
+// remember a guess as a suggestion for a scope
+func (s *semanticSuggestions) add(scope string, guess glove.SemanticGuess) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.suggestion_map[scope]; !ok {
+		s.suggestion_map[scope] = make(map[string]*SemanticSuggestion, 0)
+	}
+	if suggestion, ok := s.suggestion_map[scope][guess.Word]; ok {
+		suggestion.SemanticGuess = guess
+		suggestion.Count += 1
+	} else if len(s.suggestion_map[scope]) < maxSemanticSuggestions {
+		s.suggestion_map[scope][guess.Word] = &SemanticSuggestion{SemanticGuess: guess, Count: 1}
+	}
+}
+
+// a human decided on a word for a scope (accepted or rejected), forget its suggestion
+func (s *semanticSuggestions) Remove(scope string, word string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.suggestion_map[scope], word)
+	if len(s.suggestion_map[scope]) == 0 {
+		delete(s.suggestion_map, scope)
+	}
+}
+
+// the suggestions for the scope of a lexicon view, for words it has no semantic for (yet), most often guessed first
+func (s *semanticSuggestions) List(view lexicon.LexiconView) []SemanticSuggestion {
+	s.Lock()
+	suggestion_list := make([]SemanticSuggestion, 0)
+	for _, suggestion := range s.suggestion_map[view.Scope()] {
+		suggestion_list = append(suggestion_list, *suggestion)
+	}
+	s.Unlock()
+
+	result_list := make([]SemanticSuggestion, 0)
+	for _, suggestion := range suggestion_list {
+		if len(view.GetSemantic(suggestion.Word)) == 0 && !view.IsRejected(suggestion.Word) {
+			result_list = append(result_list, suggestion)
+		}
+	}
+	sort.Slice(result_list, func(i, j int) bool {
+		if result_list[i].Count != result_list[j].Count {
+			return result_list[i].Count > result_list[j].Count
+		}
+		return result_list[i].Word < result_list[j].Word
+	})
+	return result_list
+}
+
+// the semantic of a word in vector space (lower case) for a view, where semantics are mostly capitalised
+func vectorLabel(view lexicon.LexiconView) func(string) string {
+	return func(word string) string {
+		semantic := view.GetSemantic(word)
+		if len(semantic) == 0 && len(word) > 0 {
+			runes := []rune(word)
+			runes[0] = unicode.ToUpper(runes[0])
+			semantic = view.GetSemantic(string(runes))
+		}
+		return semantic
+	}
+}
+
+// should the semantic of a token be guessed for a view?  nouns only, unless rejected
+func guessable(t_token *model.Token, view lexicon.LexiconView) bool {
+	return strings.HasPrefix(t_token.Tag, "NN") && len(t_token.Text) > 2 &&
+		!lexicon.Lexi.IsUndesirable(t_token.Text) && !view.IsRejected(t_token.Text)
+}
+
+// guess the semantic of a token from its neighbours in vector space, if there are word vectors
+func guessSemantic(t_token *model.Token, view lexicon.LexiconView) string {
+	if glove.Vectors == nil || !guessable(t_token, view) {
+		return ""
+	}
+	guess, ok := glove.Vectors.GuessSemantic(t_token.Text, vectorLabel(view), SemanticGuessConfidence)
+	if !ok {
+		return ""
+	}
+	guess.Word = t_token.Text
+	if lexicon.IsUserScope(view.Scope()) {
+		Suggestions.add(view.Scope(), guess)
+	}
+	return guess.Semantic
+}
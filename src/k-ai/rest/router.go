@@ -60,6 +60,13 @@ var routes = Routes {
         "/sl/parse-to-png/Peter and Sherry went to the beach at 12:45 to view the boats comming in.",
         service_layer.ParseToPng,
     },
+    Route{
+        "Explain how the pronouns of a parseable piece of text are resolved",
+        "GET",
+        "/sl/anaphora/{text}",
+        "/sl/anaphora/John said he likes dogs.",
+        service_layer.ExplainAnaphora,
+    },
 
     /////////////////////////////////////////////////////////////////
     // KB ui
@@ -118,6 +125,24 @@ var routes = Routes {
         service_layer.UnTeach,
     },
 
+    /////////////////////////////////////////////////////////////////
+    // conversation context
+
+    Route{
+        "Get the conversation context of a session",
+        "GET",
+        "/context/get/{session}",
+        "",
+        service_layer.GetContext,
+    },
+    Route{
+        "Reset the conversation context of a session",
+        "DELETE",
+        "/context/reset/{session}",
+        "",
+        service_layer.ResetContext,
+    },
+
     /////////////////////////////////////////////////////////////////
     // semantic entities
 
@@ -142,6 +167,109 @@ var routes = Routes {
         "",
         service_layer.SaveSemanticEntity,
     },
+    Route{
+        "Semantic Entities: semantics guessed for unknown words",
+        "GET",
+        "/entities/suggestions/{session}",
+        "",
+        service_layer.ListSemanticSuggestions,
+    },
+    Route{
+        "Semantic Entities: reject a guessed semantic",
+        "DELETE",
+        "/entities/suggestions/{session}/{name}",
+        "",
+        service_layer.RejectSemanticSuggestion,
+    },
+
+    /////////////////////////////////////////////////////////////////
+    // aiml categories
+
+    Route{
+        "AIML: list the modules",
+        "GET",
+        "/aiml/modules/{session}",
+        "",
+        service_layer.ListAimlModules,
+    },
+    Route{
+        "AIML: list the categories of a module",
+        "GET",
+        "/aiml/categories/{session}/{module}",
+        "",
+        service_layer.ListAimlCategories,
+    },
+    Route{
+        "AIML: find the categories containing a text",
+        "GET",
+        "/aiml/search/{session}/{text}",
+        "",
+        service_layer.SearchAimlCategories,
+    },
+    Route{
+        "AIML: save a category (insert or update, ?old_module=<module> when it moves)",
+        "POST",
+        "/aiml/save/{session}",
+        "",
+        service_layer.SaveAimlCategory,
+    },
+    Route{
+        "AIML: delete a category",
+        "DELETE",
+        "/aiml/delete/{session}/{module}/{id}",
+        "",
+        service_layer.DeleteAimlCategory,
+    },
+    Route{
+        "AIML: test a sentence, showing the pattern matched and its bindings",
+        "POST",
+        "/aiml/test/{session}",
+        "",
+        service_layer.TestAimlSentence,
+    },
+
+    /////////////////////////////////////////////////////////////////
+    // lexicon
+
+    Route{
+        "Lexicon: look up a word",
+        "GET",
+        "/lexicon/lookup/{session}/{word}",
+        "",
+        service_layer.LookupWord,
+    },
+    Route{
+        "Lexicon: add or remove a stem, synonym, compound word or stop-word",
+        "POST",
+        "/lexicon/update/{session}",
+        "",
+        service_layer.UpdateLexicon,
+    },
+
+    /////////////////////////////////////////////////////////////////
+    // word vectors
+
+    Route{
+        "Word vectors: the k words most related to a word",
+        "GET",
+        "/vectors/related/{session}/{word}/{k}",
+        "",
+        service_layer.GetRelatedWords,
+    },
+    Route{
+        "Word vectors: the similarity of two words",
+        "GET",
+        "/vectors/similarity/{session}/{word1}/{word2}",
+        "",
+        service_layer.GetWordSimilarity,
+    },
+    Route{
+        "Word vectors: a is to b as c is to ?",
+        "GET",
+        "/vectors/analogy/{session}/{a}/{b}/{c}/{k}",
+        "",
+        service_layer.GetWordAnalogy,
+    },
 
     /////////////////////////////////////////////////////////////////
     // topic entities (unstructured topic data)
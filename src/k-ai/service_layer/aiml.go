@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package service_layer
+
+import (
+	"sort"
+	"strings"
+	"net/http"
+	"io/ioutil"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/gocql/gocql"
+	"k-ai/db/db_model"
+	"k-ai/nlu/aiml"
+	"k-ai/nlu/model"
+	"k-ai/nlu/tokenizer"
+	"k-ai/util"
+)
+
+//////////////////////////////////////////////////////////////////////////////////////////
+// AIML categories are stored in the db by module (seeded from data/aiml/*.aiml, see
+// aiml.SetupDb), every change reloads the AIML system
+//////////////////////////////////////////////////////////////////////////////////////////
+
+// the result of testing a sentence against the AIML patterns, one for each template matched
+type AimlTestResult struct {
+	Pattern  string   `json:"pattern"`
+	Origin   string   `json:"origin"`
+	StarList []string `json:"star_list"` // the text bound to each wildcard
+	Template string   `json:"template"`
+	Answer   string   `json:"answer"`
+}
+
+// the AIML conversation of a session, the user's name known from the start
+func getAimlState(session_obj *db_model.Session) (*model.AimlState, error) {
+	aiml_state, err := session_obj.GetAimlState()
+	if err != nil { return nil, err }
+	if _, ok := aiml_state.Predicates["name"]; !ok {
+		aiml_state.Predicates["name"] = session_obj.First_name
+	}
+	return aiml_state, nil
+}
+
+// the AIML categories changed: reload them here, and let the other instances know to reload theirs
+func reloadAiml() error {
+	_, err := db_model.SaveAimlChange()
+	if err != nil { return err }
+	return aiml.Aiml.Reload()
+}
+
+// record a change of the AIML patterns made here, so the other instances reload theirs and this one doesn't
+func recordAimlChange() error {
+	latest, err := db_model.GetAimlChange()
+	if err != nil { return err }
+	change, err := db_model.SaveAimlChange()
+	if err != nil { return err }
+	aiml.Aiml.ChangeRecorded(latest, change)
+	return nil
+}
+
+// set the <that> of a conversation to the first result of a reply, if AIML gave it (the first num_aiml results),
+// otherwise there's no <that>: AIML can't follow up on an answer it didn't give
+// returns true if the <that> changed
+func updateAimlThat(aiml_state *model.AimlState, result_list []model.ATResult, num_aiml int) bool {
+	that := ""
+	if num_aiml > 0 && len(result_list) > 0 {
+		that = result_list[0].Text
+	}
+	changed := aiml_state.That != that
+	aiml_state.That = that
+	return changed
+}
+
+// sort categories by module and first pattern
+func sortCategories(category_list []model.AimlCategory) {
+	sort.Slice(category_list, func(i, j int) bool {
+		if category_list[i].Module != category_list[j].Module {
+			return category_list[i].Module < category_list[j].Module
+		}
+		return strings.Join(category_list[i].PatternList, "\n") < strings.Join(category_list[j].PatternList, "\n")
+	})
+}
+
+// write a list of categories as json
+func writeCategories(w http.ResponseWriter, category_list []model.AimlCategory) {
+	sortCategories(category_list)
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(category_list)
+	w.Write(json_bytes)
+}
+
+// return the names of all AIML modules /aiml/modules/{session}
+func ListAimlModules(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	_, err := db_model.ValidateSession(session)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+
+	category_list, err := db_model.GetAimlCategoryList("")
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	module_set := make(map[string]bool, 0)
+	module_list := make([]string, 0)
+	for _, category := range category_list {
+		if !module_set[category.Module] {
+			module_set[category.Module] = true
+			module_list = append(module_list, category.Module)
+		}
+	}
+	sort.Strings(module_list)
+
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(module_list)
+	w.Write(json_bytes)
+}
+
+// return the categories of a module /aiml/categories/{session}/{module}
+func ListAimlCategories(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	_, err := db_model.ValidateSession(session)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+
+	module := strings.ToLower(strings.TrimSpace(vars["module"]))
+	category_list, err := db_model.GetAimlCategoryList(module)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	writeCategories(w, category_list)
+}
+
+// return the categories of all modules with the text in a pattern, that, topic or template
+// /aiml/search/{session}/{text}
+func SearchAimlCategories(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	_, err := db_model.ValidateSession(session)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+
+	text := strings.ToLower(strings.TrimSpace(vars["text"]))
+	if len(text) == 0 {
+		JsonError(w, "search text missing")
+		return
+	}
+	category_list, err := db_model.GetAimlCategoryList("")
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	found_list := make([]model.AimlCategory, 0)
+	for _, category := range category_list {
+		str := strings.Join(category.PatternList, "\n") + "\n" + category.That + "\n" + category.Topic + "\n" + category.Template
+		if strings.Contains(strings.ToLower(str), text) {
+			found_list = append(found_list, category)
+		}
+	}
+	writeCategories(w, found_list)
+}
+
+// add a new category (without an id) or change an existing one, returns the category saved
+// a category moved to another module says which one it was in: /aiml/save/{session}?old_module=<module>
+// the categories are shared by all users, only administrators change them
+func SaveAimlCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	if !isAdministrator(session_obj.GetUserName()) {
+		JsonError(w, "only an administrator can change the aiml")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	var category model.AimlCategory
+	err = decoder.Decode(&category)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	category.Module = strings.ToLower(strings.TrimSpace(category.Module))
+	pattern_list := make([]string, 0)
+	for _, pattern := range category.PatternList {
+		if pattern = strings.TrimSpace(pattern); len(pattern) > 0 {
+			pattern_list = append(pattern_list, pattern)
+		}
+	}
+	category.PatternList = pattern_list
+	category.That = strings.TrimSpace(category.That)
+	category.Topic = strings.TrimSpace(category.Topic)
+	category.Template = strings.TrimSpace(category.Template)
+	err = aiml.ValidateCategory(category)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	if util.IsEmpty(&category.Id) {
+		category.Id = gocql.TimeUUID()
+	} else {
+		// the module is part of a category's key: moved to another module, it must leave the old one
+		old_module := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("old_module")))
+		if len(old_module) > 0 && old_module != category.Module {
+			err = db_model.DeleteAimlCategory(old_module, category.Id)
+			if err != nil {
+				JsonError(w, err.Error())
+				return
+			}
+		}
+	}
+
+	// log the event
+	db_model.AddLogEntry(session_obj.GetUserName(), "save aiml category " + category.Id.String() + "," + category.Module)
+
+	err = db_model.SaveAimlCategory(category)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	err = reloadAiml()
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(category)
+	w.Write(json_bytes)
+}
+
+// remove a category /aiml/delete/{session}/{module}/{id}, administrators only
+func DeleteAimlCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	if !isAdministrator(session_obj.GetUserName()) {
+		JsonError(w, "only an administrator can change the aiml")
+		return
+	}
+
+	module := strings.ToLower(strings.TrimSpace(vars["module"]))
+	id, err := gocql.ParseUUID(vars["id"])
+	if err != nil {
+		JsonError(w, "invalid, 'id' is not a valid guid")
+		return
+	}
+
+	// log the event
+	db_model.AddLogEntry(session_obj.GetUserName(), "delete aiml category " + id.String() + "," + module)
+
+	err = db_model.DeleteAimlCategory(module, id)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	err = reloadAiml()
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	JsonMessage(w, http.StatusOK, "ok")
+}
+
+// match the text of the body against the live AIML patterns in the session's conversation,
+// without changing the conversation /aiml/test/{session}
+func TestAimlSentence(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		JsonError(w, "read error:" + err.Error())
+		return
+	}
+	if len(body) == 0 || len(body) >= 255 {
+		JsonError(w, "text empty or too large, invalid")
+		return
+	}
+
+	aiml_state, err := getAimlState(session_obj)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+
+	result_list := make([]AimlTestResult, 0)
+	for _, binding := range aiml.Aiml.MatchTokenListInContext(tokenizer.Tokenize(string(body)), aiml_state) {
+		// evaluate in a copy of the conversation, so a <set> doesn't stick
+		state := model.AimlState{That: aiml_state.That, Predicates: make(map[string]string, 0)}
+		for name, value := range aiml_state.Predicates {
+			state.Predicates[name] = value
+		}
+		star_list := make([]string, 0)
+		for _, star := range binding.StarList {
+			star_list = append(star_list, tokenizer.ToString(star))
+		}
+		template := binding.Template
+		if len(template) == 0 {
+			template = binding.Text
+		}
+		result_list = append(result_list, AimlTestResult{Pattern: binding.Pattern, Origin: binding.Origin,
+			StarList: star_list, Template: template, Answer: aiml.Aiml.Evaluate(binding, &state)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(result_list)
+	w.Write(json_bytes)
+}
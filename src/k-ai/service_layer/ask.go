@@ -12,9 +12,11 @@
 package service_layer
 
 import (
+	"errors"
 	"net/http"
 	"io/ioutil"
 	"k-ai/util"
+	"k-ai/logger"
 	"k-ai/nlu/parser"
 	"k-ai/nlu/aiml"
 	"k-ai/nlu/model"
@@ -24,10 +26,13 @@ import (
 	"github.com/gorilla/mux"
 	"strings"
 	"k-ai/db/freebase"
+	"k-ai/nlu/answer"
+	"k-ai/nlu/anaphora"
+	"github.com/gocql/gocql"
 )
 
-// perform an ask
-//
+// perform an ask, see answerSentence
+// the search expands the question with synonyms, unless asked not to with ?synonyms=false
 func Ask(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -40,6 +45,7 @@ func Ask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	username := session_obj.GetUserName()
+	use_synonyms := useSynonyms(r)
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -51,8 +57,9 @@ func Ask(w http.ResponseWriter, r *http.Request) {
 		// log the event
 		db_model.AddLogEntry(username, "query:" + bodyStr)
 
-		// 1. parse it
-		sentence_list, err := parser.ParseText(bodyStr)
+		// 1. parse it with the user's semantics, resolving pronouns against the conversation so far
+		discourse := anaphora.Discourses.Get(session)
+		sentence_list, err := parser.ParseTextWithLexicon(bodyStr, discourse.GetSentenceList(), userLexicon(username))
 		if err != nil {
 			ATJsonError(w, "Unexpected parser error:" + err.Error())
 			return
@@ -62,95 +69,193 @@ func Ask(w http.ResponseWriter, r *http.Request) {
 		} else if len(sentence_list) > 1 {
 			ATJsonError(w, "Question too complex, more than one sentence")
 		} else {
-			sentence := sentence_list[0]  // the sentence
-
-			if !sentence.IsQuestion() && !sentence.IsImperative() {
-				ATJsonError(w, "That does not look like a question.  Ask me question or give me a command please.")
+			aiml_state, err := getAimlState(session_obj)
+			if err != nil {
+				ATJsonError(w, err.Error())
+				return
+			}
+			ask_teach_result, aiml_changed, err := answerSentence(sentence_list[0], username, use_synonyms, aiml_state, discourse)
+			if err != nil {
+				ATJsonError(w, err.Error())
 				return
 			}
+			// what we replied becomes the <that> of the next question, and the AIML may have <set>s
+			if aiml_changed {
+				err = session_obj.SaveAimlState(aiml_state)
+				if err != nil {
+					ATJsonError(w, err.Error())
+					return
+				}
+			}
 
-			ask_teach_result := model.ATResultList{ ResultList: make([]model.ATResult,0) }
+			// write the return result
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Content-Type", "application/json")
+			json_bytes, _ := json.Marshal(ask_teach_result)
+			w.Write(json_bytes)
+		}
 
-			//////////////////////////////////////////////////////////////////////
-			// 1. perform an AIML query
-			{
-				binding_list := aiml.Aiml.MatchTokenList(sentence.TokenList)
-				if len(binding_list) > 0 {
+	} else {
+		ATJsonError(w, "Query empty or too large, invalid")
+	}
+}
 
-					// if it has more than one binding, pick a random one from the list
-					if len(binding_list) > 1 {
-						answer := binding_list[rand.Intn(len(binding_list))]
-						binding_list = []model.AimlBinding{answer}
-					}
+// add AIML's (first) reply to the conversation, it isn't parsed yet
+// a reply the parser can't handle is left out, it still got answered
+func addAimlReplyTurn(text string, discourse *anaphora.Discourse) {
+	reply_list, err := parser.ParseText(text)
+	if err != nil {
+		logger.Log.Error("aiml reply not added to the conversation: %s", err.Error())
+		return
+	}
+	for _, reply := range reply_list {
+		discourse.AddTurn(reply, true)
+	}
+}
 
-					rs, err := aiml.Aiml.PerformSpecialOps(binding_list, username)
-					if err != nil {
-						ATJsonError(w, err.Error())
-						return
-					}
-					// append results to return set
-					for _, item := range rs.ResultList {
-						ask_teach_result.ResultList = append(ask_teach_result.ResultList, item)
-					}
-				}
+// answer a sentence of a conversation: AIML first, then the factoids and Freebase
+// a sentence that isn't a question or a command only gets an AIML answer, e.g. the "yes please" following
+// up on what we said last, or the "my name is Bob" setting a predicate
+// aiml_state becomes the state after the answer, returns true if it changed (and needs saving)
+func answerSentence(sentence model.Sentence, username string, use_synonyms bool, aiml_state *model.AimlState,
+					discourse *anaphora.Discourse) (*model.ATResultList, bool, error) {
+
+	// what kind of answer are we looking for?
+	question_type := sentence.GetQuestionType()
+
+	ask_teach_result := model.ATResultList{ ResultList: make([]model.ATResult,0), QuestionType: question_type }
+
+	//////////////////////////////////////////////////////////////////////
+	// 1. perform an AIML query
+	aiml_matched := false
+	{
+		binding_list := aiml.Aiml.MatchTokenListInContext(sentence.TokenList, aiml_state)
+		if len(binding_list) > 0 {
+			aiml_matched = true
+
+			// if it has more than one binding, pick a random one from the list
+			if len(binding_list) > 1 {
+				binding := binding_list[rand.Intn(len(binding_list))]
+				binding_list = []model.AimlBinding{binding}
 			}
 
-			// replace you, your, yourself pronoun references with KAI
-			db_model.ResolveFirstAndSecondPerson(username, "Kai", &sentence)
+			rs, err := aiml.Aiml.PerformSpecialOps(binding_list, username, use_synonyms, aiml_state)
+			if err != nil { return nil, false, err }
+			// append results to return set
+			for _, item := range rs.ResultList {
+				ask_teach_result.ResultList = append(ask_teach_result.ResultList, item)
+			}
+		}
+	}
+	num_aiml := len(ask_teach_result.ResultList)  // the AIML results come first
 
-			//////////////////////////////////////////////////////////////////////
-			// 2. only search if we can find enough tokens (more than one)
-			{
-				if db_model.GetNumSearchTokens(sentence.TokenList) > 1 {
+	// only AIML answers what isn't a question or a command
+	is_question := sentence.IsQuestion() || sentence.IsImperative()
+	if !is_question && !aiml_matched {
+		return nil, false, errors.New("That does not look like a question.  Ask me question or give me a command please.")
+	}
 
-					// 3. perform an index search in the factoid system
-					rs, err := db_model.FindText(sentence.TokenList, username)
-					if err != nil {
-						ATJsonError(w, err.Error())
-						return
-					}
-					// 4. if we cannot find any results for the user, go global
-					if len(rs.ResultList) == 0 {
-						rs, err = db_model.FindText(sentence.TokenList, "global")
-						if err != nil {
-							ATJsonError(w, err.Error())
-							return
-						}
-					}
-					// append results to return set
-					for _, item := range rs.ResultList {
-						ask_teach_result.ResultList = append(ask_teach_result.ResultList, item)
+	// this sentence becomes part of the conversation, and so does what AIML replied to it
+	discourse.AddTurn(sentence, false)
+	if num_aiml > 0 {
+		addAimlReplyTurn(ask_teach_result.ResultList[0].Text, discourse)
+	}
+
+	if is_question {
+		// replace you, your, yourself pronoun references with KAI
+		db_model.ResolveFirstAndSecondPerson(username, "Kai", &sentence)
+
+		//////////////////////////////////////////////////////////////////////
+		// 2. only search the indexes if we can find enough tokens (more than one)
+		sentence_list := make([]model.Sentence, 0)
+		if db_model.GetNumSearchTokens(sentence.TokenList) > 1 {
+			var err error
+			// 3. perform an index search in the factoid system
+			sentence_list, err = db_model.FindSentences(sentence.TokenList, username, use_synonyms)
+			if err != nil { return nil, false, err }
+			// 4. if we cannot find any results for the user, go global
+			if len(sentence_list) == 0 {
+				sentence_list, err = db_model.FindSentences(sentence.TokenList, "global", use_synonyms)
+				if err != nil { return nil, false, err }
+			}
+		}
+		// and if the words of the question find nothing (or there are too few), find the factoids closest to it in meaning
+		similarity_map := make(map[gocql.UUID]float64, 0)
+		if len(sentence_list) == 0 {
+			var err error
+			sentence_list, similarity_map, err = findSimilarSentences(sentence.TokenList, username)
+			if err != nil { return nil, false, err }
+		}
+		if question_type.Type == model.QTYesNo {
+			// 5. yes/no questions get a single answer with the factoids that support it
+			// without any factoids there's nothing to say, others may still answer
+			if len(sentence_list) > 0 {
+				yes_no := answer.AnswerYesNo(sentence, sentence_list)
+				similarity := 0.0
+				for _, id := range yes_no.SupportList {
+					if similarity_map[id] > similarity {
+						similarity = similarity_map[id]
 					}
 				}
+				ask_teach_result.ResultList = append(ask_teach_result.ResultList,
+					model.ATResult{Text: yes_no.Answer, Answer: yes_no.Answer, Support_list: yes_no.SupportList,
+						Topic: "K/AI", Timestamp: util.GetTimeNowSting(), Similarity: similarity})
 			}
 
-			//////////////////////////////////////////////////////////////////////
-			// 3. search Freebase
-			{
-				// todo: pagination, page / page_size put it through the uri
-				tuple_set, err := freebase.FreebaseQueryBySearch(sentence.TokenList, 0, 10)
-				if err == nil {
-					for _, tuple := range tuple_set {
-						item := model.ATResult{Text: tuple.String(), Topic: "K/AI", Timestamp: util.GetTimeNowSting()}
-						ask_teach_result.ResultList = append(ask_teach_result.ResultList, item)
-					}
-				}
+		} else {
+			// 5. demote / remove factoids that can't answer this type of question
+			// 6. and extract the part of each factoid that answers the question
+			answer_list := question_type.FilterAnswers(sentence_list)
+			rs := answer.ToResults(sentence, question_type, answer_list)
+
+			// the best answer becomes part of the conversation
+			if len(answer_list) > 0 {
+				discourse.AddTurn(answer_list[0], true)
 			}
 
-			// write the return result
-			w.WriteHeader(http.StatusOK)
-			w.Header().Set("Content-Type", "application/json")
-			if len(ask_teach_result.ResultList) == 0 {  // nothing?
-				ask_teach_result.ResultList = append(ask_teach_result.ResultList,
-					model.ATResult{Text: "Sorry, I don't know.",
-						Topic: "K/AI", Timestamp: util.GetTimeNowSting()})
+			// append results to return set
+			for _, item := range rs.ResultList {
+				item.Similarity = similarity_map[item.Sentence_id]
+				ask_teach_result.ResultList = append(ask_teach_result.ResultList, item)
 			}
-			json_bytes, _ := json.Marshal(ask_teach_result)
-			w.Write(json_bytes)
 		}
 
-	} else {
-		ATJsonError(w, "Query empty or too large, invalid")
+		//////////////////////////////////////////////////////////////////////
+		// 3. search Freebase
+		{
+			// todo: pagination, page / page_size put it through the uri
+			tuple_set, err := freebase.FreebaseQueryBySearch(sentence.TokenList, 0, 10)
+			if err == nil {
+				for _, tuple := range tuple_set {
+					item := model.ATResult{Text: tuple.String(), Topic: "K/AI", Timestamp: util.GetTimeNowSting()}
+					ask_teach_result.ResultList = append(ask_teach_result.ResultList, item)
+				}
+			}
+		}
+	}
+
+	if len(ask_teach_result.ResultList) == 0 {  // nothing?
+		ask_teach_result.ResultList = append(ask_teach_result.ResultList,
+			model.ATResult{Text: "Sorry, I don't know.",
+				Topic: "K/AI", Timestamp: util.GetTimeNowSting()})
 	}
+
+	// what we replied becomes the <that> of the next question (its <set>s were made by the AIML query)
+	aiml_changed := updateAimlThat(aiml_state, ask_teach_result.ResultList, num_aiml) || aiml_matched
+	return &ask_teach_result, aiml_changed, nil
 }
 
+// find the factoids closest in meaning to a question, the user's own first, then global ones
+// returns the factoids and their similarity to the question by id
+func findSimilarSentences(token_list []model.Token, username string) ([]model.Sentence, map[gocql.UUID]float64, error) {
+	similarity_map := make(map[gocql.UUID]float64, 0)
+	sentence_list, score_list, err := db_model.FindSimilarSentences(token_list, username)
+	if err == nil && len(sentence_list) == 0 {
+		sentence_list, score_list, err = db_model.FindSimilarSentences(token_list, "global")
+	}
+	if err != nil { return nil, nil, err }
+	for i, sentence := range sentence_list {
+		similarity_map[sentence.Id] = score_list[i]
+	}
+	return sentence_list, similarity_map, nil
+}
@@ -20,6 +20,9 @@ import (
 	"github.com/gocql/gocql"
 	"k-ai/db/db_model"
 	"k-ai/util_ut"
+	"k-ai/nlu/aiml"
+	"k-ai/nlu/tokenizer"
+	"k-ai/nlu/anaphora"
 )
 
 // test fn
@@ -62,7 +65,7 @@ func TestAsk1(t *testing.T) {
 	err = json.Unmarshal([]byte(q_str), &qTokenList)
 	util_ut.Check(t, err)
 
-	rs, err := db_model.FindText(qTokenList, "unit test")
+	rs, err := db_model.FindText(qTokenList, "unit test", true)
 	util_ut.Check(t, err)
 	isTrue(t, len(rs.ResultList) == 1)
 
@@ -70,3 +73,46 @@ func TestAsk1(t *testing.T) {
 	db.DropKeyspace("localhost", "kai_ask_text")
 }
 
+
+// the <that> of a conversation follows AIML answers only: an answer found elsewhere clears it
+// a follow-up that isn't a question or a command still gets its AIML answer
+func TestAimlThat1(t *testing.T) {
+
+	// init cassandra
+	db.DropKeyspace("localhost", "kai_ask_text")
+	db.Cassandra.InitCassandraConnection("localhost", "kai_ask_text", 1)
+
+	aiml.Aiml.AddPattern([]string{"OFFER ZORBLAX"}, "test module", []model.AimlTemplate{{Text: "Do you want some zorblax tea?"}})
+	aiml.Aiml.AddPattern([]string{"YES ZORBLAX"}, "test module", []model.AimlTemplate{{Text: "Coming up.", That: "DO YOU WANT * TEA"}})
+	aiml.Aiml.AddPattern([]string{"YES ZORBLAX"}, "test module", []model.AimlTemplate{{Text: "Yes what?"}})
+	state := &model.AimlState{Predicates: make(map[string]string, 0)}
+	discourse := anaphora.Discourses.Get("aiml that test")
+
+	// the text of the first answer to text, and whether the state needs saving
+	ask := func(text string) (string, bool) {
+		sentence := model.Sentence{TokenList: tokenizer.FilterOutSpaces(tokenizer.Tokenize(text))}
+		rs, changed, err := answerSentence(sentence, "peter@k-ai.com", false, state, discourse)
+		util_ut.Check(t, err)
+		return rs.ResultList[0].Text, changed
+	}
+
+	text, changed := ask("offer zorblax")
+	util_ut.IsTrue(t, text == "Do you want some zorblax tea?" && changed)
+	text, _ = ask("yes zorblax")
+	util_ut.IsTrue(t, text == "Coming up.")
+
+	// tea offered, but the next question was answered elsewhere
+	text, _ = ask("offer zorblax")
+	util_ut.IsTrue(t, text == "Do you want some zorblax tea?" && state.That != "")
+	text, changed = ask("what is zorblax tea?")
+	util_ut.IsTrue(t, text == "Sorry, I don't know." && changed && state.That == "")
+	text, _ = ask("yes zorblax")
+	util_ut.IsTrue(t, text == "Yes what?")
+
+	// a statement AIML doesn't answer isn't a question
+	_, _, err := answerSentence(model.Sentence{TokenList: tokenizer.FilterOutSpaces(tokenizer.Tokenize("zorblax tea is green"))},
+		"peter@k-ai.com", false, state, discourse)
+	util_ut.IsTrue(t, err != nil)
+
+	db.DropKeyspace("localhost", "kai_ask_text")
+}
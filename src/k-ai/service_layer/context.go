@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package service_layer
+
+import (
+	"net/http"
+	"github.com/gorilla/mux"
+	"strings"
+	"encoding/json"
+	"k-ai/db/db_model"
+	"k-ai/nlu/anaphora"
+)
+
+// return the conversation context (recent turns and their referents) of a session
+func GetContext(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	_, err := db_model.ValidateSession(session)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+
+	turn_list := anaphora.Discourses.Get(session).GetTurnList()
+
+	// return the json
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(turn_list)
+	w.Write(json_bytes)
+}
+
+// forget the conversation context of a session, so that pronouns no longer refer to earlier turns
+func ResetContext(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+
+	// log the event
+	db_model.AddLogEntry(session_obj.GetUserName(), "reset conversation context")
+
+	anaphora.Discourses.Reset(session)
+	JsonMessage(w, http.StatusOK, "conversation context reset")
+}
@@ -24,10 +24,7 @@ import (
 	"k-ai/db/db_model"
 	"k-ai/nlu/aiml"
 	"regexp"
-	"k-ai/util"
-	"os"
 	"k-ai/nlu/lexicon"
-	"errors"
 	"k-ai/nlu/model"
 )
 
@@ -141,6 +138,15 @@ func DeleteEntity(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			JsonError(w,err.Error())
 		} else {
+			// a schema's AIML patterns go with it, here and (at their next reload) on the other instances
+			if topic == "schema" {
+				aiml.Aiml.RemoveSchema(uuid)
+				err = recordAimlChange()
+				if err != nil {
+					JsonError(w, err.Error())
+					return
+				}
+			}
 			JsonMessage(w, http.StatusOK,"ok")
 		}
 	}
@@ -177,13 +183,23 @@ func SaveEntity(w http.ResponseWriter, r *http.Request) {
 			// log the event
 			db_model.AddLogEntry(username, "save entity " + schema_item.Id.String() + "," + schema_item.Topic)
 
-			// tell the AIML system to reload - new information
-			err = aiml.Aiml.Reload()
-			if err != nil {
-				JsonError(w, err.Error())
-			} else {
-				JsonMessage(w, http.StatusOK,"ok")
+			// a schema's aiml are AIML patterns - rebuild them if they changed
+			if schema_item.Topic == "schema" {
+				var schema db_model.KBSchema
+				err = json.Unmarshal([]byte(schema_item.Json_data), &schema)
+				if err != nil {
+					JsonError(w, err.Error())
+					return
+				}
+				if aiml.Aiml.UpdateSchema(schema) {
+					err = recordAimlChange()  // the other instances reload theirs
+					if err != nil {
+						JsonError(w, err.Error())
+						return
+					}
+				}
 			}
+			JsonMessage(w, http.StatusOK,"ok")
 		}
 	}
 }
@@ -200,7 +216,7 @@ func indexKBEntry(entry *db_model.KBEntry, schema_semantic_map map[string]string
 				if _, ok := schema_semantic_map[key]; ok {
 					valueStr := db.TypeToString(value)
 					if len(valueStr) > 0 {
-						sentence_list, err := parser.ParseText(valueStr)
+						sentence_list, err := parser.ParseTextWithLexicon(valueStr, nil, lexicon.Lexi.View(lexicon.SchemaScope(entry.Topic)))
 						if err != nil { return err }
 						for _, sentence := range sentence_list {
 							for _, t_token := range sentence.TokenList {
@@ -224,34 +240,8 @@ func indexKBEntry(entry *db_model.KBEntry, schema_semantic_map map[string]string
 	return err
 }
 
-// create a new lexicon for a given word and permanent storage
-func writeToLexicon(lexicon_id string, semantic_map map[string][]string) error {
-	if len(lexicon_id) > 0 {
-		filename := util.GetDataPath() + "/lexicon/semantics/" + lexicon_id + ".txt"
-		f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		if err == nil {
-			defer f.Close()
-			for key, word_list := range semantic_map {
-				for _, word := range word_list {
-					_, err = f.WriteString(word + ":" + key + "\n")
-					if err != nil {
-						return err
-					}
-				}
-			}
-		} else {
-			return err
-		}
-	} else {
-		return errors.New("invalid filename")
-	}
-	return nil
-}
-
-// create a semantic lexicon for these items - skip numbers for now
-func updateSemanticLexicon(entry *db_model.KBEntry,
-							schema_semantic_map map[string]string,
-							word_semantic_map map[string][]string) error {
+// add the semantics of these items to the schema's lexicon overlay - skip numbers for now
+func updateSemanticLexicon(entry *db_model.KBEntry, schema_semantic_map map[string]string, username string) error {
 	var data_map map[string]interface{}
 	err := json.Unmarshal([]byte(entry.Json_data), &data_map)
 	var isAscii = regexp.MustCompile(`^([a-z]|[A-Z]| |-)+$`)
@@ -263,13 +253,10 @@ func updateSemanticLexicon(entry *db_model.KBEntry,
 					valueStr := strings.TrimSpace(db.TypeToString(value))
 					// ascii only for now
 					if len(semantic) > 0 && len(valueStr) > 0 && isAscii.MatchString(valueStr) {
-						if word_list, ok := word_semantic_map[semantic]; ok {
-							word_semantic_map[semantic] = append(word_list, valueStr)
-						} else {
-							word_semantic_map[semantic] = make([]string,0)
-							word_semantic_map[semantic] = append(word_semantic_map[semantic], valueStr)
-						}
-						lexicon.Lexi.AddSemantic(valueStr, semantic)
+						// store the change, and apply it to the lexicon
+						err = db_model.SaveLexiconUpdate(lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Word: valueStr,
+							Operation: lexicon.OpSave, Value: semantic, Origin: username, Scope: lexicon.SchemaScope(entry.Topic)})
+						if err != nil { return err }
 					}
 				}
 
@@ -279,20 +266,6 @@ func updateSemanticLexicon(entry *db_model.KBEntry,
 	return err
 }
 
-// take all "wrong" characters out of an email address to use it as a filename
-func sanitizeForFilename(username string) string {
-	str := make([]byte,0)
-	for i := 0; i < len(username); i++ {
-		ch := username[i]
-		if (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') {
-			str = append(str, username[i])
-		} else {
-			str = append(str, '_')
-		}
-	}
-	return string(str)
-}
-
 /**
  * upload a set of instances
  * @return returns 200 on success
@@ -334,9 +307,6 @@ func UploadInstances(w http.ResponseWriter, r *http.Request) {
 				field_map[field.Name] = field.Semantic
 			}
 
-			// record all words and their semantics
-			word_semantic_map := make(map[string][]string,0)
-
 			// process all lines
 			for _, line := range strings.Split(string(contents), "\n") {
 				if strings.HasPrefix(line, "{") && strings.HasSuffix(line, "}") {
@@ -376,18 +346,15 @@ func UploadInstances(w http.ResponseWriter, r *http.Request) {
 					// save the item to the db
 					kb_entry.Save()
 
+					// update the schema's lexicon with these new entities
+					updateSemanticLexicon(&kb_entry, field_map, username)
+
 					// index the item for retrieval
 					indexKBEntry(&kb_entry, field_map)
 
-					// update the lexicon with these new entities
-					updateSemanticLexicon(&kb_entry, field_map, word_semantic_map)
-
 				} // valid line?
 			}
 
-			// write this data to a new lexicon
-			writeToLexicon(sanitizeForFilename(username), word_semantic_map)
-
 			JsonMessage(w, http.StatusCreated,"ok")
 		}
 	}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package service_layer
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"k-ai/nlu/lexicon"
+	"k-ai/nlu/aiml"
+	"k-ai/db/db_model"
+)
+
+// lexicon administration
+// look up a word, and add/remove stems, synonyms, compound words and stop-words at runtime
+
+// the lexicon as seen by a user: their own semantics, then those of the kb schemas they created
+func userLexicon(username string) lexicon.LexiconView {
+	return lexicon.Lexi.ViewForUser(username, aiml.Aiml.GetSchemaNames(username)...)
+}
+
+// look up everything the lexicon knows about a word: /lexicon/lookup/{session}/{word}
+func LookupWord(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		ATJsonError(w, err.Error())
+		return
+	}
+	username := session_obj.GetUserName()
+
+	word := strings.TrimSpace(vars["word"])
+	if len(word) == 0 || len(word) > 255 {
+		JsonError(w, "invalid word, too small or large")
+		return
+	}
+
+	// log the event
+	db_model.AddLogEntry(username, "lexicon lookup " + word)
+
+	// the semantic the user sees, which may come from their own lexicon
+	info := lexicon.Lexi.LookupWord(word)
+	info.Semantic = userLexicon(username).GetSemantic(word)
+
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(info)
+	w.Write(json_bytes)
+}
+
+// check who changes what: users only change their own overlay, a semantic without a scope goes into it
+// the lexicon itself is shared by all users (and instances), only administrators change it
+func scopeLexiconUpdate(update *lexicon.LexiconUpdate, username string) error {
+	user_scope := lexicon.UserScope(username)
+	if len(update.Scope) > 0 && update.Scope != user_scope {
+		return errors.New("invalid scope, only your own lexicon (" + user_scope + ") can be changed")
+	}
+	if len(update.Scope) == 0 && !isAdministrator(username) {
+		if update.Kind != lexicon.UpdateSemantic {
+			return errors.New("only an administrator can change the lexicon itself")
+		}
+		update.Scope = user_scope
+	}
+	return nil
+}
+
+// add or remove a lexicon entry: /lexicon/update/{session}
+// the body is a json lexicon update, e.g. {"kind": "synonym", "operation": "save", "word": "car", "value": "automobile"}
+// semantics go into the user's own lexicon ("scope": "user:<username>"), only administrators change the lexicon itself
+func UpdateLexicon(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		ATJsonError(w, err.Error())
+		return
+	}
+	username := session_obj.GetUserName()
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	var update lexicon.LexiconUpdate
+	err = decoder.Decode(&update)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	update.Kind = strings.ToLower(strings.TrimSpace(update.Kind))
+	update.Operation = strings.ToLower(strings.TrimSpace(update.Operation))
+	update.Word = strings.TrimSpace(update.Word)
+	update.Value = strings.TrimSpace(update.Value)
+	update.Origin = username
+	err = scopeLexiconUpdate(&update, username)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	err = update.Validate()
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+
+	// log the event
+	db_model.AddLogEntry(username, "lexicon " + update.Operation + " " + update.Kind + " " + update.Word + "=" + update.Value)
+
+	// store the change, and apply it to the lexicon
+	err = db_model.SaveLexiconUpdate(update)
+	if err != nil {
+		JsonError(w, err.Error())
+	} else {
+		JsonMessage(w, http.StatusOK,"ok")
+	}
+}
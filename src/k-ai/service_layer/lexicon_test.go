@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package service_layer
+
+import (
+	"testing"
+	"k-ai/nlu/lexicon"
+	"k-ai/util_ut"
+)
+
+// a user's semantic goes into their own lexicon, what Apple means to them doesn't change it for anyone else
+func TestLexiconUpdateScope1(t *testing.T) {
+	Administrators = []string{"admin@k-ai.com"}
+	defer func() { Administrators = nil }()
+
+	global_semantic := lexicon.Lexi.GetSemantic("Apple")
+	update := lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Operation: lexicon.OpSave, Word: "Apple", Value: "company"}
+	util_ut.Check(t, scopeLexiconUpdate(&update, "peter@k-ai.com"))
+	util_ut.IsTrue(t, update.Scope == lexicon.UserScope("peter@k-ai.com"))
+	util_ut.Check(t, update.Validate())
+	util_ut.Check(t, lexicon.Lexi.ApplyUpdate(update))
+
+	util_ut.IsTrue(t, lexicon.Lexi.ViewForUser("peter@k-ai.com").GetSemantic("Apple") == "company")
+	util_ut.IsTrue(t, lexicon.Lexi.ViewForUser("mark@k-ai.com").GetSemantic("Apple") == global_semantic)
+	util_ut.IsTrue(t, lexicon.Lexi.GetSemantic("Apple") == global_semantic)
+
+	update.Operation = lexicon.OpDelete
+	util_ut.Check(t, lexicon.Lexi.ApplyUpdate(update))
+
+	// only administrators change the lexicon itself, and no one changes another user's lexicon
+	synonym := lexicon.LexiconUpdate{Kind: lexicon.UpdateSynonym, Operation: lexicon.OpSave, Word: "car", Value: "automobile"}
+	util_ut.IsTrue(t, scopeLexiconUpdate(&synonym, "peter@k-ai.com") != nil)
+	util_ut.Check(t, scopeLexiconUpdate(&synonym, "Admin@k-ai.com"))
+	util_ut.IsTrue(t, len(synonym.Scope) == 0)
+	other := lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Operation: lexicon.OpSave, Word: "Apple", Value: "company",
+		Scope: lexicon.UserScope("mark@k-ai.com")}
+	util_ut.IsTrue(t, scopeLexiconUpdate(&other, "peter@k-ai.com") != nil)
+	admin := lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Operation: lexicon.OpSave, Word: "Apple", Value: "company"}
+	util_ut.Check(t, scopeLexiconUpdate(&admin, "admin@k-ai.com"))
+	util_ut.IsTrue(t, len(admin.Scope) == 0)
+}
@@ -17,6 +17,7 @@ import (
     "github.com/gorilla/mux"
     "k-ai/nlu/parser"
     "k-ai/nlu/model"
+    "k-ai/nlu/anaphora"
 )
 
 // parse a piece of raw text from the query string
@@ -57,3 +58,19 @@ func ParseToPng(w http.ResponseWriter, r *http.Request) {
     }
 }
 
+
+// parse a piece of raw text from the query string and explain how its pronouns were resolved
+//
+func ExplainAnaphora(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    text_to_parse := vars["text"]
+    sentenceList, err := parser.ParseText(text_to_parse)
+    if err != nil {
+        JsonError(w, "Unexpected parser error:" + err.Error())
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    if err := json.NewEncoder(w).Encode(anaphora.LL.ExplainPronouns(sentenceList)); err != nil {
+        panic(err)
+    }
+}
@@ -17,16 +17,15 @@ import (
 	"strings"
 	"regexp"
 	"k-ai/nlu/lexicon"
-	"k-ai/util"
-	"os"
 	"encoding/json"
 	"sort"
 	"k-ai/db/db_model"
+	"k-ai/nlu/parser"
 )
 
 //////////////////////////////////////////////////////////////////////////////////////////
-// todo: semantic entities ARE saved with who dunnit, but aren't filtered as yet
-// todo: this means that any user can overwrite another user's semantic entities
+// semantic entities are saved in the user's own lexicon overlay (see lexicon/overlay.go)
+// so they never change the semantics of other users
 //////////////////////////////////////////////////////////////////////////////////////////
 
 type SEResult struct {
@@ -41,23 +40,6 @@ func (s SEResultList) Len() int      { return len(s) }
 func (s SEResultList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
 
-// add an operation to the end of the lexicon updates file
-func appendToLexiconUpdates(operation string, origin string, word string, semantic string) error {
-	filename := util.GetDataPath() + "/lexicon/lexicon_updates.txt"
-	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
-	if err == nil {
-		defer f.Close()
-		_, err = f.WriteString(operation + "|" + origin + "|" + word + ":" + semantic + "\n")
-		if err != nil {
-			return err
-		}
-	} else {
-		return err
-	}
-	return nil
-}
-
-
 // lexicon based semantics
 // create, save, and find
 
@@ -96,13 +78,13 @@ func SaveSemanticEntity(w http.ResponseWriter, r *http.Request) {
 		JsonError(w, "invalid semantic value")
 		return
 	}
-	lexicon.Lexi.Semantic[name] = semantic
-
-	// and save it to make a note of it
-	err = appendToLexiconUpdates("save", username, name, semantic)
+	// store the change, and apply it to the user's lexicon
+	err = db_model.SaveLexiconUpdate(lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Word: name,
+		Operation: lexicon.OpSave, Value: semantic, Origin: username, Scope: lexicon.UserScope(username)})
 	if err != nil {
 		JsonError(w, err.Error())
 	} else {
+		parser.Suggestions.Remove(lexicon.UserScope(username), name)  // decided, if it was a suggestion
 		JsonMessage(w, http.StatusAccepted,"ok")
 	}
 }
@@ -132,14 +114,13 @@ func DeleteSemanticEntity(w http.ResponseWriter, r *http.Request) {
 	// log the event
 	db_model.AddLogEntry(username, "delete semantic entity " + name)
 
-	if _, ok := lexicon.Lexi.Semantic[name]; ok {
-		// remove it from the map
-		delete(lexicon.Lexi.Semantic, name)
-
-		// and save it to make a note of it
-		err := appendToLexiconUpdates("del", username, name, "")
+	if lexicon.Lexi.HasOverlaySemantic(lexicon.UserScope(username), name) {
+		// store the change, and apply it to the user's lexicon
+		err := db_model.SaveLexiconUpdate(lexicon.LexiconUpdate{Kind: lexicon.UpdateSemantic, Word: name,
+			Operation: lexicon.OpDelete, Origin: username, Scope: lexicon.UserScope(username)})
 		if err != nil {
 			JsonError(w, err.Error())
+			return
 		}
 	}
 	JsonMessage(w, http.StatusOK,"ok")
@@ -168,10 +149,8 @@ func FindSemanticEntities(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result_list := make(SEResultList,0)
-	for name, semantic := range lexicon.Lexi.Semantic {
-		if strings.Contains(strings.ToLower(name), find_name) {
-			result_list = append(result_list, SEResult{Name: name, Semantic: semantic})
-		}
+	for name, semantic := range userLexicon(username).FindSemantics(find_name) {
+		result_list = append(result_list, SEResult{Name: name, Semantic: semantic})
 	}
 
 	// sort list by name
@@ -183,3 +162,54 @@ func FindSemanticEntities(w http.ResponseWriter, r *http.Request) {
 	w.Write(json_bytes)
 }
 
+// semantics guessed for unknown nouns from word vectors, to accept (save) or reject: /entities/suggestions/{session}
+func ListSemanticSuggestions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		ATJsonError(w, err.Error())
+		return
+	}
+	username := session_obj.GetUserName()
+
+	// return the json
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(parser.Suggestions.List(userLexicon(username)))
+	w.Write(json_bytes)
+}
+
+// reject a guessed semantic, the word won't be guessed again: /entities/suggestions/{session}/{name}
+func RejectSemanticSuggestion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// check session is valid
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		ATJsonError(w, err.Error())
+		return
+	}
+	username := session_obj.GetUserName()
+
+	name := strings.TrimSpace(vars["name"])
+	if len(name) == 0 {
+		JsonError(w, "invalid name value")
+		return
+	}
+
+	// log the event
+	db_model.AddLogEntry(username, "reject semantic suggestion " + name)
+
+	// store the rejection in the user's lexicon, so no instance guesses the word for them again
+	err = db_model.SaveLexiconUpdate(lexicon.LexiconUpdate{Kind: lexicon.UpdateRejected, Word: name,
+		Operation: lexicon.OpSave, Origin: username, Scope: lexicon.UserScope(username)})
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	parser.Suggestions.Remove(lexicon.UserScope(username), name)
+	JsonMessage(w, http.StatusOK,"ok")
+}
@@ -19,6 +19,7 @@ import (
 	"strings"
 	"github.com/gorilla/mux"
 	"fmt"
+	"k-ai/nlu/anaphora"
 )
 
 // perform a teach
@@ -46,8 +47,9 @@ func Teach(w http.ResponseWriter, r *http.Request) {
 		// log the event
 		db_model.AddLogEntry(username, "teach:" + bodyStr)
 
-		// 1. parse it
-		sentence_list, err := parser.ParseText(bodyStr)
+		// 1. parse it with the user's semantics, resolving pronouns against the conversation so far
+		discourse := anaphora.Discourses.Get(session)
+		sentence_list, err := parser.ParseTextWithLexicon(bodyStr, discourse.GetSentenceList(), userLexicon(username))
 		if err != nil {
 			ATJsonError(w, "Unexpected parser error:" + err.Error())
 			return
@@ -89,6 +91,9 @@ func Teach(w http.ResponseWriter, r *http.Request) {
 							ATJsonError(w, err.Error()+" (global indexes)")
 						} else {
 
+							// what we've been taught becomes part of the conversation
+							discourse.AddTurn(sentence_list[0], false)
+
 							guid_str := sentence_list[0].Id.String()
 							ATJsonMessage(w, http.StatusAccepted, fmt.Sprintf("ok, got that and stored \"%s\" away as factoid \"%s\".", bodyStr, guid_str))
 						}
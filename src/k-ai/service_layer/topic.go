@@ -116,8 +116,8 @@ func SaveTopic(w http.ResponseWriter, r *http.Request) {
 		// log the event
 		db_model.AddLogEntry(username, "save topic: " + topic_name)
 
-		// body to sentence list
-		sentence_list, err := parser.ParseText(bodyStr)
+		// body to sentence list, with the user's semantics
+		sentence_list, err := parser.ParseTextWithLexicon(bodyStr, nil, userLexicon(username))
 		if err != nil {
 			ATJsonError(w, "Unexpected parser error:" + err.Error())
 			return
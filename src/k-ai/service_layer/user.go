@@ -22,6 +22,7 @@ import (
 	"encoding/hex"
 	"github.com/gorilla/mux"
 	"strings"
+	"k-ai/nlu/anaphora"
 )
 
 // create a new user
@@ -157,6 +158,7 @@ func Signout(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			ATJsonError(w, "invalid session id: "+err.Error())
 		} else {
+			anaphora.Discourses.Reset(session)
 			ATJsonMessage(w, http.StatusOK, "session deleted")
 		}
 	}
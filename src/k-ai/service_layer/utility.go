@@ -16,8 +16,22 @@ import (
 	"k-ai/nlu/model"
 	"encoding/json"
 	"k-ai/util"
+	"strings"
 )
 
+// the users (their email addresses) allowed to change what all users share, set from properties.ini
+var Administrators []string
+
+// can this user change what all users share?
+func isAdministrator(username string) bool {
+	for _, administrator := range Administrators {
+		if strings.EqualFold(strings.TrimSpace(administrator), strings.TrimSpace(username)) {
+			return true
+		}
+	}
+	return false
+}
+
 // write a json error with header to the output
 func JsonError(writer http.ResponseWriter, error_message string) {
 	writer.WriteHeader(http.StatusInternalServerError)
@@ -52,3 +66,8 @@ func ATJsonMessage(writer http.ResponseWriter, info_code int, info_message strin
 	writer.Write(json_bytes)
 }
 
+
+// should a search expand its query with synonyms?  yes, unless the request says ?synonyms=false
+func useSynonyms(r *http.Request) bool {
+	return r.URL.Query().Get("synonyms") != "false"
+}
@@ -0,0 +1,25 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package service_layer
+
+import (
+	"testing"
+	"net/http/httptest"
+	"k-ai/util_ut"
+)
+
+// searches expand with synonyms unless a request turns it off
+func TestUseSynonyms1(t *testing.T) {
+	util_ut.IsTrue(t, useSynonyms(httptest.NewRequest("POST", "/ask/session", nil)))
+	util_ut.IsTrue(t, useSynonyms(httptest.NewRequest("POST", "/ask/session?synonyms=true", nil)))
+	util_ut.IsTrue(t, !useSynonyms(httptest.NewRequest("POST", "/ask/session?synonyms=false", nil)))
+}
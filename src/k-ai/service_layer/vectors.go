@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package service_layer
+
+import (
+	"strconv"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"k-ai/nlu/glove"
+	"k-ai/db/db_model"
+)
+
+// word vector exploration
+// related words, the similarity of two words and analogies in the vector space of the
+// word vectors configured in properties.ini (WordVectorFile)
+
+// the most results a vector query returns
+const maxVectorResults = 100
+
+// words related to a word
+type RelatedWords struct {
+	Word       string             `json:"word"`
+	ResultList glove.MatchVectors `json:"result_list"`
+}
+
+// the similarity of two words
+type WordSimilarity struct {
+	Word1      string  `json:"word1"`
+	Word2      string  `json:"word2"`
+	Similarity float64 `json:"similarity"`
+}
+
+// a is to b as c is to result_list
+type WordAnalogy struct {
+	A          string             `json:"a"`
+	B          string             `json:"b"`
+	C          string             `json:"c"`
+	ResultList glove.MatchVectors `json:"result_list"`
+}
+
+// check the session and that there are word vectors, returns the user's name, or writes an error
+func vectorSession(w http.ResponseWriter, vars map[string]string) (string, bool) {
+	session := strings.ToLower(strings.TrimSpace(vars["session"]))
+	session_obj, err := db_model.ValidateSession(session)
+	if err != nil {
+		ATJsonError(w, err.Error())
+		return "", false
+	}
+	if glove.Vectors == nil {
+		JsonError(w, "no word vectors loaded (see WordVectorFile in properties.ini)")
+		return "", false
+	}
+	return session_obj.GetUserName(), true
+}
+
+// the words of a request as the word vectors know them, or writes an error
+func vectorWords(w http.ResponseWriter, vars map[string]string, names ...string) ([]string, bool) {
+	word_list := make([]string, 0)
+	for _, name := range names {
+		word, ok := glove.Vectors.FindWord(strings.TrimSpace(vars[name]))
+		if !ok {
+			JsonError(w, "unknown word \"" + word + "\"")
+			return nil, false
+		}
+		word_list = append(word_list, word)
+	}
+	return word_list, true
+}
+
+// the number of results asked for, or writes an error
+func vectorResultSize(w http.ResponseWriter, vars map[string]string) (int, bool) {
+	k, err := strconv.Atoi(vars["k"])
+	if err != nil || k <= 0 || k > maxVectorResults {
+		JsonError(w, "invalid number of results, 1 to " + strconv.Itoa(maxVectorResults))
+		return 0, false
+	}
+	return k, true
+}
+
+// the k words closest to a word: /vectors/related/{session}/{word}/{k}
+func GetRelatedWords(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	username, ok := vectorSession(w, vars)
+	if !ok { return }
+	word_list, ok := vectorWords(w, vars, "word")
+	if !ok { return }
+	k, ok := vectorResultSize(w, vars)
+	if !ok { return }
+
+	// log the event
+	db_model.AddLogEntry(username, "vectors related " + word_list[0])
+
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(RelatedWords{Word: word_list[0], ResultList: glove.Vectors.GetRelatedWords(word_list[0], k)})
+	w.Write(json_bytes)
+}
+
+// the cosine similarity of two words: /vectors/similarity/{session}/{word1}/{word2}
+func GetWordSimilarity(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	username, ok := vectorSession(w, vars)
+	if !ok { return }
+	word_list, ok := vectorWords(w, vars, "word1", "word2")
+	if !ok { return }
+
+	// log the event
+	db_model.AddLogEntry(username, "vectors similarity " + word_list[0] + " " + word_list[1])
+
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(WordSimilarity{Word1: word_list[0], Word2: word_list[1],
+		Similarity: glove.Vectors.GetVectorAngleUsingNames(word_list[0], word_list[1])})
+	w.Write(json_bytes)
+}
+
+// a is to b as c is to ?: /vectors/analogy/{session}/{a}/{b}/{c}/{k}
+func GetWordAnalogy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	username, ok := vectorSession(w, vars)
+	if !ok { return }
+	word_list, ok := vectorWords(w, vars, "a", "b", "c")
+	if !ok { return }
+	k, ok := vectorResultSize(w, vars)
+	if !ok { return }
+
+	// log the event
+	db_model.AddLogEntry(username, "vectors analogy " + strings.Join(word_list, " "))
+
+	result_list, err := glove.Vectors.Analogy(word_list[0], word_list[1], word_list[2], k)
+	if err != nil {
+		JsonError(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json_bytes, _ := json.Marshal(WordAnalogy{A: word_list[0], B: word_list[1], C: word_list[2], ResultList: result_list})
+	w.Write(json_bytes)
+}
@@ -17,18 +17,20 @@ import (
 	"fmt"
 	"k-ai/db/db_model"
 	"k-ai/nlu/tokenizer"
+	"k-ai/nlu/lexicon"
 	"github.com/gocql/gocql"
 )
 
 /**
  * perfom the serach using the objects itself
  * @param query_str a super search query string to be parsed
+ * @param use_synonyms expand the words of the query with their synonyms (except for exact words)
  * @return the matching indexes
  */
-func SuperSearch(query_str string, origin string) (map[gocql.UUID][]model.IndexMatch, error) {
+func SuperSearch(query_str string, origin string, use_synonyms bool) (map[gocql.UUID][]model.IndexMatch, error) {
 	query, err := parse_string(query_str)
 	if err != nil { return nil, err }
-	return doSearch(query, origin)
+	return doSearch(query, origin, use_synonyms)
 }
 
 
@@ -37,7 +39,7 @@ func SuperSearch(query_str string, origin string) (map[gocql.UUID][]model.IndexM
  * @param searchItem a series of search object
  * @return the matching indexes
  */
-func doSearch(searchItem *SSTree, origin string) (map[gocql.UUID][]model.IndexMatch, error) {
+func doSearch(searchItem *SSTree, origin string, use_synonyms bool) (map[gocql.UUID][]model.IndexMatch, error) {
 
 	if searchItem != nil {
 
@@ -46,9 +48,9 @@ func doSearch(searchItem *SSTree, origin string) (map[gocql.UUID][]model.IndexMa
 				if searchItem.Left == nil || searchItem.Right == nil {
 					return nil, errors.New("and: left or right nil")
 				}
-				set1, err := doSearch(searchItem.Left, origin)
+				set1, err := doSearch(searchItem.Left, origin, use_synonyms)
 				if err != nil { return nil, err }
-				set2, err := doSearch(searchItem.Right, origin)
+				set2, err := doSearch(searchItem.Right, origin, use_synonyms)
 				if err != nil { return nil, err }
 				return intersection(set1, set2)
 			}
@@ -56,9 +58,9 @@ func doSearch(searchItem *SSTree, origin string) (map[gocql.UUID][]model.IndexMa
 				if searchItem.Left == nil || searchItem.Right == nil {
 					return nil, errors.New("and not: left or right nil")
 				}
-				set1, err := doSearch(searchItem.Left, origin)
+				set1, err := doSearch(searchItem.Left, origin, use_synonyms)
 				if err != nil { return nil, err }
-				set2, err := doSearch(searchItem.Right, origin)
+				set2, err := doSearch(searchItem.Right, origin, use_synonyms)
 				if err != nil { return nil, err }
 				return intersectionNot(set1, set2)
 			}
@@ -66,14 +68,14 @@ func doSearch(searchItem *SSTree, origin string) (map[gocql.UUID][]model.IndexMa
 				if searchItem.Left == nil || searchItem.Right == nil {
 					return nil, errors.New("or: left or right nil")
 				}
-				set1, err := doSearch(searchItem.Left, origin)
+				set1, err := doSearch(searchItem.Left, origin, use_synonyms)
 				if err != nil { return nil, err }
-				set2, err := doSearch(searchItem.Right, origin)
+				set2, err := doSearch(searchItem.Right, origin, use_synonyms)
 				if err != nil { return nil, err }
 				return union(set1, set2)
 			}
 			case "word": {
-				return readIndexesForTerm(searchItem, origin)
+				return readIndexesForTerm(searchItem, origin, use_synonyms)
 			}
 			default: {
 				return nil, errors.New(fmt.Sprintf("unknown/unhandled super search type (%s)", searchItem.TType))
@@ -178,11 +180,18 @@ func union(set1 map[gocql.UUID][]model.IndexMatch, set2 map[gocql.UUID][]model.I
 	return result_set, nil
 }
 
-// read indexes for a "word"
-func readIndexesForTerm(item *SSTree, topic string) (map[gocql.UUID][]model.IndexMatch, error) {
+// read indexes for a "word", exact words are never expanded with synonyms
+// a word with a semantic, e.g. location(Paris), must be a kind of that semantic if the lexicon knows it
+func readIndexesForTerm(item *SSTree, topic string, use_synonyms bool) (map[gocql.UUID][]model.IndexMatch, error) {
 	if item != nil {
+		if len(item.Semantic) > 0 {
+			word_semantic := lexicon.Lexi.GetSemantic(item.Word)
+			if len(word_semantic) > 0 && !lexicon.Lexi.IsA(word_semantic, item.Semantic) {
+				return make(map[gocql.UUID][]model.IndexMatch, 0), nil
+			}
+		}
 		token_list := tokenizer.Tokenize(item.Word)
-		return db_model.ReadIndexesWithFilterForTokens(token_list, topic,  0)
+		return db_model.ReadIndexesForTokens(token_list, topic,  0, use_synonyms && !item.Exact)
 	}
 	return nil, nil
 }
@@ -67,25 +67,25 @@ func TestSS1(t *testing.T) {
 	db_model.IndexText(origin, 0, sentence_list_2, 1.0)
 
 	// perform the super searches for testing
-	rs1, err := SuperSearch("any(Peter)", origin)
+	rs1, err := SuperSearch("any(Peter)", origin, true)
 	util_ut.Check(t, err)
 	isTrue(t, rs1 != nil && len(rs1) == 2)
 	contains(t, rs1, sentence_list_1[0].Id, sentence_list_2[0].Id)
 
 	// Peter exists in boy, boat only in url1
-	rs2, err := SuperSearch("any(Peter) and any(boat)", origin)
+	rs2, err := SuperSearch("any(Peter) and any(boat)", origin, true)
 	util_ut.Check(t, err)
 	isTrue(t, rs2 != nil && len(rs2) == 1)
 	contains(t, rs1, sentence_list_1[0].Id)
 
 	// union test
-	rs3, err := SuperSearch("any(boat) or any(movie)", origin)
+	rs3, err := SuperSearch("any(boat) or any(movie)", origin, true)
 	util_ut.Check(t, err)
 	isTrue(t, rs3 != nil && len(rs3) == 2)
 	contains(t, rs1, sentence_list_1[0].Id, sentence_list_2[0].Id)
 
 	// and not test
-	rs4, err := SuperSearch("any(Peter) and not any(movie)", origin)
+	rs4, err := SuperSearch("any(Peter) and not any(movie)", origin, true)
 	util_ut.Check(t, err)
 	isTrue(t, rs4 != nil && len(rs4) == 1)
 	contains(t, rs1, sentence_list_1[0].Id)
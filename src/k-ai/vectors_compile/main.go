@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017 by Peter de Vocht
+ *
+ * All rights reserved. No part of this publication may be reproduced, distributed, or
+ * transmitted in any form or by any means, including photocopying, recording, or other
+ * electronic or mechanical methods, without the prior written permission of the publisher,
+ * except in the case of brief quotations embodied in critical reviews and certain other
+ * noncommercial uses permitted by copyright law.
+ *
+ */
+
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"time"
+	"strings"
+	"path/filepath"
+	"k-ai/nlu/glove"
+)
+
+//
+// convert a word vector file (glove, fastText .vec or word2vec .bin) into the memory mapped
+// format (see nlu/glove/vector_files.go), which loads in a fraction of the time
+//
+func main() {
+	in := flag.String("in", "", "the word vector file to convert")
+	format := flag.String("format", "", "the format of the file: glove, fasttext or word2vec (default: by its extension)")
+	out := flag.String("out", "", "the mapped file to write (default: the input file with extension .kvec)")
+	max_words := flag.Int("max", 0, "only keep the first max words of the file (0: all)")
+	flag.Parse()
+
+	if len(*in) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if len(*format) == 0 {
+		*format = glove.FormatOf(*in)
+	}
+	if len(*out) == 0 {
+		*out = strings.TrimSuffix(*in, filepath.Ext(*in)) + ".kvec"
+	}
+
+	start := time.Now()
+	m, err := glove.LoadVectors(*in, *format, *max_words)
+	if err == nil {
+		err = m.SaveMapped(*out)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("%d vectors of size %d written to %s in %v\n", m.Size(), m.Dimension(), *out, time.Since(start))
+}